@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/screener"
+)
+
+type queueRequest struct {
+	Screen  string     `json:"screen"`  /* run a named screen from SCREENS_PATH */
+	Work    etl.EtlJob `json:"work"`    /* or queue these symbols for a job */
+	Symbols []string   `json:"symbols"` /* must exist in Macros */
+}
+
+func (s *server) queueJobs(c *fiber.Ctx) error {
+	var req queueRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if req.Screen != "" {
+		if s.screensPath == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "SCREENS_PATH is not configured")
+		}
+		config, err := screener.Load(s.screensPath)
+		if err != nil {
+			return err
+		}
+		screen, ok := config.Screen(req.Screen)
+		if !ok {
+			return fiber.NewError(fiber.StatusNotFound, "unknown screen "+req.Screen)
+		}
+		if err := screener.Run(s.store, screen); err != nil {
+			return err
+		}
+		return s.queueDepth(c.Status(fiber.StatusAccepted))
+	}
+
+	switch req.Work {
+	case etl.Macros, etl.Medium, etl.Short, etl.Signals:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "work must be Macros, Medium, Short or Signals")
+	}
+	if len(req.Symbols) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "screen or symbols required")
+	}
+	for i := range req.Symbols {
+		req.Symbols[i] = strings.ToUpper(req.Symbols[i])
+	}
+	var docs []etl.SymbolDoc
+	known := etl.Filter{Field: "symbol", Op: "in", Value: req.Symbols}
+	if err := s.store.Fundamentals.Find(etl.Query{Filters: []etl.Filter{known}}, &docs); err != nil {
+		return err
+	}
+	symbols := make([]string, len(docs))
+	for i, doc := range docs {
+		symbols[i] = doc.Symbol
+	}
+	if err := s.store.ApiQueue.Enqueue(symbols, req.Work); err != nil {
+		return err
+	}
+	return s.queueDepth(c.Status(fiber.StatusAccepted))
+}
+
+func (s *server) queueDepth(c *fiber.Ctx) error {
+	depth, err := s.store.ApiQueue.Depth()
+	if err != nil {
+		return err
+	}
+	if depth == nil {
+		depth = []etl.QueueDepth{}
+	}
+	return c.JSON(fiber.Map{"depth": depth})
+}
+
+// tailLogs returns the newest Logs documents first
+func (s *server) tailLogs(c *fiber.Ctx) error {
+	p, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+	docs, err := s.store.Logs.List(p.Offset + p.Limit)
+	if err != nil {
+		return err
+	}
+	if p.Offset >= int64(len(docs)) {
+		docs = []etl.LogDocument{}
+	} else {
+		docs = docs[p.Offset:]
+	}
+	return c.JSON(fiber.Map{"data": docs})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/events"
+)
+
+func TestParsePage(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		p, err := parsePage(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(p)
+	})
+
+	cases := map[string]int{
+		"/":                    200,
+		"/?limit=10&offset=20": 200,
+		"/?limit=0":            400,
+		"/?limit=501":          400,
+		"/?offset=-1":          400,
+		"/?limit=ten":          400,
+	}
+	for url, code := range cases {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != code {
+			t.Error(url, " expected ", code, " got ", resp.StatusCode)
+		}
+	}
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/?limit=10&offset=20", nil))
+	var p page
+	json.NewDecoder(resp.Body).Decode(&p)
+	if p.Limit != 10 || p.Offset != 20 {
+		t.Error("Unexpected page ", p)
+	}
+}
+
+func TestFundamentalsFilter(t *testing.T) {
+	var filter bson.M
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		filters, err := fundamentalsFilter(c)
+		if err != nil {
+			return err
+		}
+		filter = etl.MongoFilter(filters)
+		return c.SendStatus(200)
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/?symbol=aapl,msft&signal=true&marketCap.gte=1000&marketCap.lt=5000&peRatio.lte=30", nil))
+	if resp.StatusCode != 200 {
+		t.Fatal("Expected valid filter got ", resp.StatusCode)
+	}
+	symbols := filter["symbol"].(bson.M)["$in"].([]string)
+	if len(symbols) != 2 || symbols[0] != "AAPL" {
+		t.Error("Unexpected symbol filter ", filter["symbol"])
+	}
+	if signal, _ := filter["signal"].(bson.M); signal["$eq"] != true {
+		t.Error("Expected signal filter")
+	}
+	marketCap := filter["fundamental.marketCap"].(bson.M)
+	if marketCap["$gte"] != 1000.0 || marketCap["$lt"] != 5000.0 {
+		t.Error("Unexpected marketCap filter ", marketCap)
+	}
+
+	for _, url := range []string{"/?description.gte=1", "/?marketCap.between=1", "/?marketCap.gt=big", "/?signal=maybe"} {
+		resp, _ := app.Test(httptest.NewRequest("GET", url, nil))
+		if resp.StatusCode != 400 {
+			t.Error(url, " expected 400 got ", resp.StatusCode)
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	store := etl.NewMemoryStore()
+	for symbol, marketCap := range map[string]float64{"TSLA": 500, "MSFT": 2000, "AAPL": 3000} {
+		symbol, marketCap := symbol, marketCap
+		store.Fundamentals.Upsert(symbol, &etl.Instrument{Symbol: &symbol, Fundamental: etl.Fundamental{MarketCap: &marketCap}})
+	}
+	store.Fundamentals.Update(map[string]etl.FieldUpdate{"MSFT": {Set: bson.M{"signal": true, "signalReasons": []string{"test"}, "signalAt": time.Now()}}})
+	store.Snapshots.Save(etl.Short, &etl.PriceHistory{Symbol: "TSLA"})
+	app := newApp(&server{store: store})
+
+	get := func(url string, v interface{}) int {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(v)
+		return resp.StatusCode
+	}
+	var fundamentals struct {
+		Data  []bson.M `json:"data"`
+		Total int64    `json:"total"`
+	}
+	if code := get("/api/v1/fundamentals?marketCap.gte=1000&sort=-marketCap&limit=1", &fundamentals); code != 200 {
+		t.Fatal("Expected 200 got ", code)
+	}
+	if fundamentals.Total != 2 || len(fundamentals.Data) != 1 || fundamentals.Data[0]["symbol"] != "AAPL" {
+		t.Error("Unexpected fundamentals page ", fundamentals)
+	}
+	var signals struct {
+		Data []signalDocument `json:"data"`
+	}
+	get("/api/v1/signals", &signals)
+	if len(signals.Data) != 1 || signals.Data[0].Symbol != "MSFT" || signals.Data[0].SignalAt == nil {
+		t.Error("Unexpected signals ", signals)
+	}
+	var ph etl.PriceHistory
+	if code := get("/api/v1/pricehistory/Short/tsla", &ph); code != 200 || ph.Symbol != "TSLA" {
+		t.Error("Expected the TSLA snapshot ", code, ph)
+	}
+	var missing fiber.Map
+	if code := get("/api/v1/fundamentals/NOPE", &missing); code != 404 || missing["error"] != "not found" {
+		t.Error("Expected 404 for an unknown symbol ", code, missing)
+	}
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	app := newApp(&server{adminToken: "secret"})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/api/v1/admin/queue", nil))
+	if resp.StatusCode != 401 {
+		t.Error("Expected 401 without a token got ", resp.StatusCode)
+	}
+	wrong := httptest.NewRequest("GET", "/api/v1/admin/queue", nil)
+	wrong.Header.Set("Authorization", "Bearer secreT")
+	if resp, _ = app.Test(wrong); resp.StatusCode != 401 {
+		t.Error("Expected 401 with a wrong token got ", resp.StatusCode)
+	}
+	req := httptest.NewRequest("GET", "/api/v1/admin/logs?limit=1000", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, _ = app.Test(req)
+	if resp.StatusCode != 400 {
+		t.Error("Expected the token to pass and the limit to fail got ", resp.StatusCode)
+	}
+
+	disabled := newApp(&server{})
+	resp, _ = disabled.Test(httptest.NewRequest("GET", "/api/v1/admin/queue", nil))
+	if resp.StatusCode != 404 {
+		t.Error("Expected admin routes off without ADMIN_TOKEN got ", resp.StatusCode)
+	}
+}
+
+func TestStream(t *testing.T) {
+	bus := events.NewBus()
+	app := newApp(&server{bus: bus})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.ShutdownWithTimeout(100 * time.Millisecond)
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/api/v1/stream?symbol=aapl&kind=signal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Error("Unexpected content type ", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ": subscribed") {
+		t.Fatal("Expected subscribe comment got ", line)
+	}
+	reader.ReadString('\n')
+
+	bus.Publish(events.Event{Kind: events.CandlesLoaded, Symbol: "AAPL"})
+	bus.Publish(events.Event{Kind: events.SignalChanged, Symbol: "MSFT"})
+	bus.Publish(events.Event{Kind: events.SignalChanged, Symbol: "AAPL", Signal: &events.SignalChange{Active: true}})
+
+	reader.ReadString('\n') // id
+	if line, _ := reader.ReadString('\n'); line != "event: signal\n" {
+		t.Error("Unexpected event line ", line)
+	}
+	line, _ := reader.ReadString('\n')
+	var e events.Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Symbol != "AAPL" || e.Signal == nil || !e.Signal.Active {
+		t.Error("Unexpected event ", e)
+	}
+}
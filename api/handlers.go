@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/resample"
+	"github.com/jaredtokuz/market-trader/signals"
+)
+
+func (s *server) listFundamentals(c *fiber.Ctx) error {
+	p, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+	filter, err := fundamentalsFilter(c)
+	if err != nil {
+		return err
+	}
+	sort, err := parseSort(c)
+	if err != nil {
+		return err
+	}
+	docs := []bson.M{}
+	return s.paginate(c, s.store.Fundamentals, p.query(filter, sort...), &docs)
+}
+
+func (s *server) getFundamental(c *fiber.Ctx) error {
+	var docs []bson.M
+	symbol := etl.Filter{Field: "symbol", Op: "eq", Value: strings.ToUpper(c.Params("symbol"))}
+	if err := s.store.Fundamentals.Find(etl.Query{Filters: []etl.Filter{symbol}, Limit: 1}, &docs); err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return errNotFound
+	}
+	return c.JSON(docs[0])
+}
+
+// getCandles serves bars by ?timeframe= or the timeframe of ?job=, defaulting to
+// the last 5 days of Short bars. Timeframes that aren't stored are resampled,
+// ?extended=true includes pre and post market bars.
+func (s *server) getCandles(c *fiber.Ctx) error {
+	p, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+	timeframe := etl.Timeframe(c.Query("timeframe"))
+	if job := c.Query("job"); job != "" {
+		timeframe = etl.JobTimeframe(etl.EtlJob(job))
+	}
+	if timeframe == "" {
+		timeframe = etl.JobTimeframe(etl.Short)
+	}
+	if !resample.Valid(timeframe) {
+		return fiber.NewError(fiber.StatusBadRequest, "unknown timeframe "+string(timeframe))
+	}
+
+	to, err := parseTime(c.Query("to"), time.Now())
+	if err != nil {
+		return err
+	}
+	from, err := parseTime(c.Query("from"), to.AddDate(0, 0, -5))
+	if err != nil {
+		return err
+	}
+
+	opts := resample.Options{Extended: c.QueryBool("extended")}
+	candles, err := resample.Query(s.store.Candles, strings.ToUpper(c.Params("symbol")), timeframe, from, to, opts)
+	if err != nil {
+		return err
+	}
+	total := int64(len(candles))
+	start, end := p.Offset, p.Offset+p.Limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return c.JSON(pageResponse{Data: candles[start:end], Total: total, page: p})
+}
+
+// getPriceHistory is the latest Medium, Short or Signals snapshot with indicators
+func (s *server) getPriceHistory(c *fiber.Ctx) error {
+	work := etl.EtlJob(c.Params("job"))
+	switch work {
+	case etl.Medium, etl.Short, etl.Signals:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "job must be Medium, Short or Signals")
+	}
+	ph, err := s.store.Snapshots.Get(work, strings.ToUpper(c.Params("symbol")))
+	if err != nil {
+		return err
+	}
+	if ph == nil {
+		return errNotFound
+	}
+	return c.JSON(ph)
+}
+
+func (s *server) listSignals(c *fiber.Ctx) error {
+	p, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+	signal := []etl.Filter{{Field: "signal", Op: "eq", Value: true}}
+	docs := []signalDocument{}
+	return s.paginate(c, s.store.Fundamentals, p.query(signal, "-signalAt", "symbol"), &docs)
+}
+
+// signalDocument is the part of a Macros document listSignals returns
+type signalDocument struct {
+	Symbol            string     `json:"symbol" bson:"symbol"`
+	SignalReasons     []string   `json:"signalReasons" bson:"signalReasons"`
+	SignalAt          *time.Time `json:"signalAt,omitempty" bson:"signalAt"`
+	SignalEvaluatedAt *time.Time `json:"signalEvaluatedAt,omitempty" bson:"signalEvaluatedAt"`
+}
+
+func (s *server) listSignalHistory(c *fiber.Ctx) error {
+	p, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+	var filters []etl.Filter
+	if v := c.Query("symbol"); v != "" {
+		filters = append(filters, etl.Filter{Field: "symbol", Op: "eq", Value: strings.ToUpper(v)})
+	}
+	if v := c.Query("event"); v != "" {
+		if v != signals.Entered && v != signals.Exited {
+			return fiber.NewError(fiber.StatusBadRequest, "event must be entered or exited")
+		}
+		filters = append(filters, etl.Filter{Field: "event", Op: "eq", Value: v})
+	}
+	docs := []signals.HistoryDocument{}
+	return s.paginate(c, s.store.Documents(signals.SignalHistory), p.query(filters, "-at"), &docs)
+}
+
+// paginate decodes a page of query into docs, a pointer to an empty slice
+func (s *server) paginate(c *fiber.Ctx, finder etl.Finder, query etl.Query, docs interface{}) error {
+	total, err := finder.Count(query.Filters...)
+	if err != nil {
+		return err
+	}
+	if err := finder.Find(query, docs); err != nil {
+		return err
+	}
+	return c.JSON(pageResponse{Data: docs, Total: total, page: page{Limit: query.Limit, Offset: query.Skip}})
+}
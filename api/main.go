@@ -0,0 +1,42 @@
+// The api server exposes stored fundamentals, candles and signals over REST
+// so dashboards don't need a database connection of their own.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/events"
+)
+
+func main() {
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+
+	var bus *events.Bus
+	if store.TailEvents != nil {
+		bus = events.NewBus()
+		go store.TailEvents(context.Background(), bus)
+	} else {
+		log.Println("STORAGE has no event feed, /stream disabled")
+	}
+
+	app := newApp(&server{
+		store:       store,
+		bus:         bus,
+		adminToken:  os.Getenv("ADMIN_TOKEN"),
+		screensPath: os.Getenv("SCREENS_PATH"),
+	})
+	log.Fatal(app.Listen(":" + port()))
+}
+
+func port() string {
+	if p := os.Getenv("PORT"); p != "" {
+		return p
+	}
+	return "3000"
+}
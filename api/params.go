@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jaredtokuz/market-trader/etl"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+type page struct {
+	Limit  int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+type pageResponse struct {
+	Data  interface{} `json:"data"`
+	Total int64       `json:"total"`
+	page
+}
+
+func parsePage(c *fiber.Ctx) (page, error) {
+	p := page{Limit: defaultLimit}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > maxLimit {
+			return p, fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxLimit))
+		}
+		p.Limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return p, fiber.NewError(fiber.StatusBadRequest, "offset must be a positive number")
+		}
+		p.Offset = n
+	}
+	return p, nil
+}
+
+func (p page) query(filters []etl.Filter, sort ...string) etl.Query {
+	return etl.Query{Filters: filters, Sort: sort, Skip: p.Offset, Limit: p.Limit}
+}
+
+/* bson names of the numeric fundamental fields, the only ones that range filter or sort */
+var fundamentalFields = func() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(etl.Fundamental{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		switch f.Type.Elem().Kind() {
+		case reflect.Float64, reflect.Int:
+			fields[strings.Split(f.Tag.Get("bson"), ",")[0]] = true
+		}
+	}
+	return fields
+}()
+
+var rangeOps = map[string]bool{"gt": true, "gte": true, "lt": true, "lte": true}
+
+// fundamentalsFilter reads symbol, exchange, signal and <field>.<op> range
+// params ex ?marketCap.gte=1000&peRatio.lt=30
+func fundamentalsFilter(c *fiber.Ctx) ([]etl.Filter, error) {
+	var filters []etl.Filter
+	if v := c.Query("symbol"); v != "" {
+		filters = append(filters, etl.Filter{Field: "symbol", Op: "in", Value: strings.Split(strings.ToUpper(v), ",")})
+	}
+	if v := c.Query("exchange"); v != "" {
+		filters = append(filters, etl.Filter{Field: "exchange", Op: "eq", Value: v})
+	}
+	if v := c.Query("signal"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "signal must be true or false")
+		}
+		filters = append(filters, etl.Filter{Field: "signal", Op: "eq", Value: b})
+	}
+
+	var err error
+	c.Context().QueryArgs().VisitAll(func(key []byte, value []byte) {
+		field, op, ok := strings.Cut(string(key), ".")
+		if !ok || err != nil {
+			return
+		}
+		if !rangeOps[op] || !fundamentalFields[field] {
+			err = fiber.NewError(fiber.StatusBadRequest, "unknown filter "+string(key))
+			return
+		}
+		n, parseErr := strconv.ParseFloat(string(value), 64)
+		if parseErr != nil {
+			err = fiber.NewError(fiber.StatusBadRequest, string(key)+" must be a number")
+			return
+		}
+		filters = append(filters, etl.Filter{Field: "fundamental." + field, Op: op, Value: n})
+	})
+	return filters, err
+}
+
+// parseSort accepts symbol or a fundamental field, prefixed with - for descending
+func parseSort(c *fiber.Ctx) ([]string, error) {
+	v := c.Query("sort", "symbol")
+	order := ""
+	if strings.HasPrefix(v, "-") {
+		order, v = "-", v[1:]
+	}
+	if v == "symbol" {
+		return []string{order + "symbol"}, nil
+	}
+	if !fundamentalFields[v] {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "cannot sort by "+v)
+	}
+	return []string{order + "fundamental." + v, "symbol"}, nil
+}
+
+// parseTime accepts RFC3339 or a plain date
+func parseTime(v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return t, fiber.NewError(fiber.StatusBadRequest, "invalid time "+v)
+	}
+	return t, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/events"
+)
+
+type server struct {
+	store       *etl.Store
+	bus         *events.Bus /* fed by store.TailEvents, nil disables /stream */
+	adminToken  string      /* bearer token for /admin, admin routes are off when empty */
+	screensPath string
+}
+
+func newApp(s *server) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+
+	v1 := app.Group("/api/v1")
+	v1.Get("/fundamentals", s.listFundamentals)
+	v1.Get("/fundamentals/:symbol", s.getFundamental)
+	v1.Get("/candles/:symbol", s.getCandles)
+	v1.Get("/pricehistory/:job/:symbol", s.getPriceHistory)
+	v1.Get("/signals", s.listSignals)
+	v1.Get("/signals/history", s.listSignalHistory)
+	if s.bus != nil {
+		v1.Get("/stream", s.stream)
+	}
+
+	if s.adminToken == "" {
+		log.Println("ADMIN_TOKEN not set, admin endpoints disabled")
+		return app
+	}
+	admin := v1.Group("/admin", s.requireAdmin)
+	admin.Post("/queue", s.queueJobs)
+	admin.Get("/queue", s.queueDepth)
+	admin.Get("/logs", s.tailLogs)
+	return app
+}
+
+func (s *server) requireAdmin(c *fiber.Ctx) error {
+	got := []byte(c.Get(fiber.HeaderAuthorization))
+	if subtle.ConstantTimeCompare(got, []byte("Bearer "+s.adminToken)) != 1 {
+		return fiber.ErrUnauthorized
+	}
+	return c.Next()
+}
+
+var errNotFound = fiber.NewError(fiber.StatusNotFound, "not found")
+
+func errorHandler(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	var e *fiber.Error
+	switch {
+	case errors.As(err, &e):
+		code = e.Code
+	}
+	if code == fiber.StatusInternalServerError {
+		log.Println(c.Method(), c.Path(), err)
+	}
+	return c.Status(code).JSON(fiber.Map{"error": err.Error()})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jaredtokuz/market-trader/events"
+)
+
+const keepAlive = 15 * time.Second
+
+// stream pushes events as server sent events. Subscribe with comma separated
+// ?symbol=AAPL,MSFT &job=Signals &kind=signal,candles, all optional.
+func (s *server) stream(c *fiber.Ctx) error {
+	filter := events.Filter{
+		Symbols: splitParam(strings.ToUpper(c.Query("symbol"))),
+		Jobs:    splitParam(c.Query("job")),
+	}
+	for _, k := range splitParam(c.Query("kind")) {
+		filter.Kinds = append(filter.Kinds, events.Kind(k))
+	}
+	sub := s.bus.Subscribe(filter, 64)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		fmt.Fprint(w, ": subscribed\n\n")
+		if w.Flush() != nil {
+			return
+		}
+		for {
+			select {
+			case e := <-sub.C:
+				b, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", e.ID.Hex(), e.Kind, b)
+			case <-ticker.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+			// a failed flush means the client went away
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func splitParam(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
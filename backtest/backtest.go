@@ -0,0 +1,166 @@
+// Package backtest replays stored candles bar by bar into a Strategy and
+// simulates its orders with commissions and slippage.
+package backtest
+
+import (
+	"strconv"
+
+	"github.com/jaredtokuz/market-trader/orders"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+type Strategy interface {
+	// OnBar runs after the bar closes. Orders submitted here are matched
+	// from the next bar on, so a strategy never trades on a bar it has seen.
+	OnBar(ctx *Context, bar shared.Candle)
+}
+
+// FillHandler is implemented by strategies that want to hear about fills
+type FillHandler interface {
+	OnFill(ctx *Context, fill Fill)
+}
+
+type Config struct {
+	Symbol         string
+	Cash           float64
+	Commission     float64 /* per share */
+	MinCommission  float64 /* per order */
+	SlippageBps    float64 /* basis points against the trader on every fill */
+	PeriodsPerYear float64 /* bars in a year, annualizes sharpe and sortino */
+}
+
+type Fill struct {
+	OrderID    string      `json:"orderId"`
+	Side       orders.Side `json:"side"`
+	Quantity   int         `json:"quantity"`
+	Price      float64     `json:"price"`
+	Commission float64     `json:"commission"`
+	Datetime   uint64      `json:"datetime"`
+}
+
+// Context is the strategy's view of the running backtest
+type Context struct {
+	config   Config
+	bars     []shared.Candle
+	open     []orders.Order
+	position orders.Position
+	cash     float64
+	nextID   int
+	trades   tradeBook
+	fills    []Fill
+}
+
+// Submit queues an order, the symbol defaults to the backtest symbol
+func (c *Context) Submit(order orders.Order) (string, error) {
+	if err := order.Validate(); err != nil {
+		return "", err
+	}
+	c.nextID++
+	order.ID = strconv.Itoa(c.nextID)
+	if order.Symbol == "" {
+		order.Symbol = c.config.Symbol
+	}
+	c.open = append(c.open, order)
+	return order.ID, nil
+}
+
+func (c *Context) Cancel(id string) bool {
+	for i, o := range c.open {
+		if o.ID == id {
+			c.open = append(c.open[:i], c.open[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Context) CancelAll() {
+	c.open = nil
+}
+
+func (c *Context) OpenOrders() []orders.Order {
+	return append([]orders.Order(nil), c.open...)
+}
+
+func (c *Context) Position() orders.Position {
+	return c.position
+}
+
+func (c *Context) Cash() float64 {
+	return c.cash
+}
+
+// Equity is cash plus the position marked at the last close
+func (c *Context) Equity() float64 {
+	if len(c.bars) == 0 {
+		return c.cash
+	}
+	return c.cash + c.position.MarketValue(c.bars[len(c.bars)-1].Close)
+}
+
+// History is every bar up to and including the current one
+func (c *Context) History() []shared.Candle {
+	return c.bars
+}
+
+// Run replays candles, oldest first, through the strategy
+func Run(config Config, candles []shared.Candle, strategy Strategy) Report {
+	ctx := &Context{config: config, cash: config.Cash, position: orders.Position{Symbol: config.Symbol}}
+	curve := make([]EquityPoint, 0, len(candles))
+
+	for i, bar := range candles {
+		ctx.bars = candles[:i+1]
+		ctx.match(bar, strategy)
+		curve = append(curve, EquityPoint{Datetime: bar.Datetime, Equity: ctx.Equity()})
+		strategy.OnBar(ctx, bar)
+	}
+
+	return newReport(config, curve, ctx.fills, ctx.trades.closed)
+}
+
+func (c *Context) match(bar shared.Candle, strategy Strategy) {
+	remaining := c.open[:0]
+	var filled []Fill
+	for _, o := range c.open {
+		price, ok := orders.Match(&o, bar)
+		if !ok {
+			remaining = append(remaining, o)
+			continue
+		}
+		filled = append(filled, c.fill(o, price, bar.Datetime))
+	}
+	c.open = remaining
+
+	if handler, ok := strategy.(FillHandler); ok {
+		for _, f := range filled {
+			handler.OnFill(c, f)
+		}
+	}
+}
+
+func (c *Context) fill(o orders.Order, price float64, datetime uint64) Fill {
+	slip := price * c.config.SlippageBps / 10000
+	if o.Side == orders.Buy {
+		price += slip
+	} else {
+		price -= slip
+	}
+	commission := c.config.Commission * float64(o.Quantity)
+	if commission < c.config.MinCommission {
+		commission = c.config.MinCommission
+	}
+
+	value := price * float64(o.Quantity)
+	if o.Side == orders.Buy {
+		c.cash -= value + commission
+	} else {
+		c.cash += value - commission
+	}
+
+	f := Fill{OrderID: o.ID, Side: o.Side, Quantity: o.Quantity, Price: price, Commission: commission, Datetime: datetime}
+	before := c.position
+	realized, closed := c.position.Apply(o.Side, o.Quantity, price)
+	c.trades.record(c.config.Symbol, before, c.position, f, realized, closed)
+	c.fills = append(c.fills, f)
+	return f
+}
@@ -0,0 +1,135 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jaredtokuz/market-trader/orders"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+/* submits the order for a bar index when that bar closes */
+type scripted struct {
+	orders map[int]orders.Order
+	bar    int
+	fills  []Fill
+}
+
+func (s *scripted) OnBar(ctx *Context, bar shared.Candle) {
+	if o, ok := s.orders[s.bar]; ok {
+		ctx.Submit(o)
+	}
+	s.bar++
+}
+
+func (s *scripted) OnFill(ctx *Context, fill Fill) {
+	s.fills = append(s.fills, fill)
+}
+
+func bars(opens ...float64) []shared.Candle {
+	candles := make([]shared.Candle, len(opens))
+	for i, o := range opens {
+		candles[i] = shared.Candle{Datetime: uint64(i) * 60000, Open: o, High: o + 1, Low: o - 1, Close: o}
+	}
+	return candles
+}
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRoundTrip(t *testing.T) {
+	strategy := &scripted{orders: map[int]orders.Order{
+		0: {Side: orders.Buy, Type: orders.Market, Quantity: 10},
+		2: {Side: orders.Sell, Type: orders.Market, Quantity: 10},
+	}}
+	config := Config{Symbol: "TEST", Cash: 10000, Commission: 0.1, MinCommission: 2, SlippageBps: 100}
+	report := Run(config, bars(100, 110, 90, 120, 130), strategy)
+
+	if len(report.Fills) != 2 || len(strategy.fills) != 2 {
+		t.Fatal("Expected two fills got ", len(report.Fills), len(strategy.fills))
+	}
+	// orders fill at the next bar's open, slipped 1% against us, min commission
+	if buy := report.Fills[0]; !near(buy.Price, 111.1) || buy.Commission != 2 || buy.Datetime != 60000 {
+		t.Error("Unexpected buy fill ", buy)
+	}
+	if sell := report.Fills[1]; !near(sell.Price, 118.8) {
+		t.Error("Unexpected sell fill ", sell)
+	}
+
+	if len(report.Trades) != 1 {
+		t.Fatal("Expected one trade got ", len(report.Trades))
+	}
+	trade := report.Trades[0]
+	if trade.Side != "long" || trade.Quantity != 10 || !near(trade.PnL, 77-4) {
+		t.Error("Unexpected trade ", trade)
+	}
+	if report.WinRate != 1 {
+		t.Error("Expected win rate 1 got ", report.WinRate)
+	}
+	if !near(report.EndEquity, 10073) || !near(report.TotalReturn, 0.0073) {
+		t.Error("Unexpected end equity ", report.EndEquity, report.TotalReturn)
+	}
+	if len(report.EquityCurve) != 5 {
+		t.Error("Expected a point per bar got ", len(report.EquityCurve))
+	}
+	// bar 2 closes at 90 holding 10 bought at 111.1
+	if report.MaxDrawdown <= 0 {
+		t.Error("Expected a drawdown")
+	}
+}
+
+func TestShortAndFlip(t *testing.T) {
+	strategy := &scripted{orders: map[int]orders.Order{
+		0: {Side: orders.Sell, Type: orders.Market, Quantity: 5},
+		1: {Side: orders.Buy, Type: orders.Market, Quantity: 10},
+		2: {Side: orders.Sell, Type: orders.Limit, Quantity: 5, LimitPrice: 200},
+	}}
+	report := Run(Config{Symbol: "TEST", Cash: 1000}, bars(100, 90, 80, 85, 95), strategy)
+
+	if len(report.Trades) != 1 {
+		t.Fatal("Expected the short to close and a long to stay open got ", report.Trades)
+	}
+	if short := report.Trades[0]; short.Side != "short" || !near(short.PnL, 50) {
+		t.Error("Unexpected short trade ", short)
+	}
+	// long 5 from 80 marked at 95, the limit never fills
+	if !near(report.EndEquity, 1000+50+75) {
+		t.Error("Unexpected end equity ", report.EndEquity)
+	}
+}
+
+func TestSMACross(t *testing.T) {
+	var candles []shared.Candle
+	for i := 0; i < 200; i++ {
+		price := 100 + 10*math.Sin(float64(i)/10)
+		candles = append(candles, shared.Candle{Datetime: uint64(i), Open: price, High: price + 0.5, Low: price - 0.5, Close: price})
+	}
+	report := Run(Config{Symbol: "TEST", Cash: 10000, PeriodsPerYear: 252}, candles, NewSMACross(5, 20, 10))
+	if len(report.Trades) < 2 {
+		t.Fatal("Expected several trades on a sine wave got ", len(report.Trades))
+	}
+	for _, trade := range report.Trades {
+		if trade.Side != "long" || trade.Quantity != 10 {
+			t.Error("Unexpected trade ", trade)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	curve := []EquityPoint{{Equity: 100}, {Equity: 120}, {Equity: 90}, {Equity: 130}, {Equity: 104}}
+	if dd := MaxDrawdown(curve); !near(dd, 0.25) {
+		t.Error("Expected drawdown 0.25 got ", dd)
+	}
+
+	returns := []float64{0.01, 0.02, -0.01, 0.03}
+	if s := Sharpe(returns, 1); !near(s, 0.0125/math.Sqrt(0.000291666666666667)) {
+		t.Error("Unexpected sharpe ", s)
+	}
+	if s := Sortino(returns, 4); !near(s, 0.0125/math.Sqrt(0.0001/4)*2) {
+		t.Error("Unexpected sortino ", s)
+	}
+	if Sortino([]float64{0.01, 0.02}, 252) != 0 {
+		t.Error("Sortino without losses should be 0")
+	}
+}
@@ -0,0 +1,137 @@
+package backtest
+
+import (
+	"math"
+)
+
+type EquityPoint struct {
+	Datetime uint64  `json:"datetime"`
+	Equity   float64 `json:"equity"`
+}
+
+type Report struct {
+	StartEquity float64       `json:"startEquity"`
+	EndEquity   float64       `json:"endEquity"`
+	TotalReturn float64       `json:"totalReturn"`
+	WinRate     float64       `json:"winRate"`
+	Sharpe      float64       `json:"sharpe"`
+	Sortino     float64       `json:"sortino"`
+	MaxDrawdown float64       `json:"maxDrawdown"` /* fraction of the peak */
+	Commissions float64       `json:"commissions"`
+	EquityCurve []EquityPoint `json:"equityCurve"`
+	Trades      []Trade       `json:"trades"`
+	Fills       []Fill        `json:"fills"`
+}
+
+func newReport(config Config, curve []EquityPoint, fills []Fill, trades []Trade) Report {
+	r := Report{
+		StartEquity: config.Cash,
+		EndEquity:   config.Cash,
+		EquityCurve: curve,
+		Trades:      trades,
+		Fills:       fills,
+	}
+	if len(curve) > 0 {
+		r.EndEquity = curve[len(curve)-1].Equity
+	}
+	if r.StartEquity != 0 {
+		r.TotalReturn = r.EndEquity/r.StartEquity - 1
+	}
+	for _, f := range fills {
+		r.Commissions += f.Commission
+	}
+
+	wins := 0
+	for _, t := range trades {
+		if t.PnL > 0 {
+			wins++
+		}
+	}
+	if len(trades) > 0 {
+		r.WinRate = float64(wins) / float64(len(trades))
+	}
+
+	returns := periodReturns(config.Cash, curve)
+	r.Sharpe = Sharpe(returns, config.PeriodsPerYear)
+	r.Sortino = Sortino(returns, config.PeriodsPerYear)
+	r.MaxDrawdown = MaxDrawdown(curve)
+	return r
+}
+
+func periodReturns(start float64, curve []EquityPoint) []float64 {
+	returns := make([]float64, 0, len(curve))
+	prev := start
+	for _, p := range curve {
+		if prev != 0 {
+			returns = append(returns, p.Equity/prev-1)
+		}
+		prev = p.Equity
+	}
+	return returns
+}
+
+// Sharpe is the annualized mean over standard deviation of period returns
+// with a zero risk free rate
+func Sharpe(returns []float64, periodsPerYear float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	mean := mean(returns)
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return 0
+	}
+	return mean / std * math.Sqrt(annualize(periodsPerYear))
+}
+
+// Sortino is Sharpe with only the downside deviation in the denominator
+func Sortino(returns []float64, periodsPerYear float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	downside := 0.0
+	for _, r := range returns {
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	dev := math.Sqrt(downside / float64(len(returns)))
+	if dev == 0 {
+		return 0
+	}
+	return mean(returns) / dev * math.Sqrt(annualize(periodsPerYear))
+}
+
+func MaxDrawdown(curve []EquityPoint) float64 {
+	peak, worst := 0.0, 0.0
+	for _, p := range curve {
+		if p.Equity > peak {
+			peak = p.Equity
+		}
+		if peak > 0 {
+			if dd := (peak - p.Equity) / peak; dd > worst {
+				worst = dd
+			}
+		}
+	}
+	return worst
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func annualize(periodsPerYear float64) float64 {
+	if periodsPerYear <= 0 {
+		return 1
+	}
+	return periodsPerYear
+}
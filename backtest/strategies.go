@@ -0,0 +1,41 @@
+package backtest
+
+import (
+	"github.com/jaredtokuz/market-trader/indicators"
+	"github.com/jaredtokuz/market-trader/orders"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+// SMACross goes long Quantity shares when the fast average crosses above
+// the slow one and goes flat when it crosses back under
+type SMACross struct {
+	Quantity int
+	fast     *indicators.SMA
+	slow     *indicators.SMA
+	above    *bool
+}
+
+func NewSMACross(fast int, slow int, quantity int) *SMACross {
+	return &SMACross{Quantity: quantity, fast: indicators.NewSMA(fast), slow: indicators.NewSMA(slow)}
+}
+
+func (s *SMACross) OnBar(ctx *Context, bar shared.Candle) {
+	fast, slow := s.fast.Update(bar.Close), s.slow.Update(bar.Close)
+	if !s.slow.Ready() || !s.fast.Ready() {
+		return
+	}
+	above := fast > slow
+	crossed := s.above != nil && *s.above != above
+	s.above = &above
+	if !crossed {
+		return
+	}
+
+	held := ctx.Position().Quantity
+	if above && held <= 0 {
+		ctx.Submit(orders.Order{Side: orders.Buy, Type: orders.Market, Quantity: s.Quantity - held})
+	}
+	if !above && held > 0 {
+		ctx.Submit(orders.Order{Side: orders.Sell, Type: orders.Market, Quantity: held})
+	}
+}
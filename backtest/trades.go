@@ -0,0 +1,62 @@
+package backtest
+
+import (
+	"github.com/jaredtokuz/market-trader/orders"
+)
+
+// Trade is one round trip from flat back to flat
+type Trade struct {
+	Symbol      string  `json:"symbol"`
+	Side        string  `json:"side"` /* long or short */
+	Quantity    int     `json:"quantity"`
+	EntryTime   uint64  `json:"entryTime"`
+	ExitTime    uint64  `json:"exitTime"`
+	EntryPrice  float64 `json:"entryPrice"` /* average */
+	ExitPrice   float64 `json:"exitPrice"`  /* average */
+	Commissions float64 `json:"commissions"`
+	PnL         float64 `json:"pnl"`    /* net of commissions */
+	Return      float64 `json:"return"` /* pnl over entry value */
+}
+
+type tradeBook struct {
+	current *Trade
+	exitQty int
+	closed  []Trade
+}
+
+func (b *tradeBook) record(symbol string, before orders.Position, after orders.Position, f Fill, realized float64, closed int) {
+	opened := f.Quantity - closed
+	if closed > 0 && b.current != nil {
+		t := b.current
+		t.ExitPrice = (t.ExitPrice*float64(b.exitQty) + f.Price*float64(closed)) / float64(b.exitQty+closed)
+		b.exitQty += closed
+		t.PnL += realized
+		t.Commissions += f.Commission * float64(closed) / float64(f.Quantity)
+		if after.Quantity == 0 || opened > 0 {
+			t.ExitTime = f.Datetime
+			t.PnL -= t.Commissions
+			if entry := t.EntryPrice * float64(t.Quantity); entry != 0 {
+				t.Return = t.PnL / entry
+			}
+			b.closed = append(b.closed, *t)
+			b.current = nil
+			b.exitQty = 0
+		}
+	}
+	if opened == 0 {
+		return
+	}
+
+	commission := f.Commission * float64(opened) / float64(f.Quantity)
+	if b.current == nil {
+		side := "long"
+		if f.Side == orders.Sell {
+			side = "short"
+		}
+		b.current = &Trade{Symbol: symbol, Side: side, EntryTime: f.Datetime}
+	}
+	t := b.current
+	t.EntryPrice = (t.EntryPrice*float64(t.Quantity) + f.Price*float64(opened)) / float64(t.Quantity+opened)
+	t.Quantity += opened
+	t.Commissions += commission
+}
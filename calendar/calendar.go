@@ -0,0 +1,120 @@
+// Package calendar knows NYSE/NASDAQ trading days, holidays, early closes and
+// the pre, regular and post market sessions. Everything is computed in
+// America/New_York regardless of the machine's local time zone.
+package calendar
+
+import (
+	"time"
+	_ "time/tzdata" // the Pi images don't ship a zoneinfo database
+)
+
+var NewYork = mustLoad("America/New_York")
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+type Phase string
+
+const (
+	Closed  Phase = "closed"
+	Pre     Phase = "pre"
+	Regular Phase = "regular"
+	Post    Phase = "post"
+)
+
+// Session is one trading day. PreOpen to Open is the pre market, Close to
+// PostClose the post market.
+type Session struct {
+	Date       time.Time /* midnight in New York */
+	PreOpen    time.Time
+	Open       time.Time
+	Close      time.Time
+	PostClose  time.Time
+	EarlyClose bool
+}
+
+func (s Session) Phase(t time.Time) Phase {
+	switch {
+	case t.Before(s.PreOpen) || !t.Before(s.PostClose):
+		return Closed
+	case t.Before(s.Open):
+		return Pre
+	case t.Before(s.Close):
+		return Regular
+	default:
+		return Post
+	}
+}
+
+// Date is midnight in New York of the day t falls on there
+func Date(t time.Time) time.Time {
+	t = t.In(NewYork)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, NewYork)
+}
+
+func IsTradingDay(t time.Time) bool {
+	d := Date(t)
+	if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := Holiday(d)
+	return !holiday
+}
+
+// SessionOn is the session for the New York day t falls on
+func SessionOn(t time.Time) (Session, bool) {
+	d := Date(t)
+	if !IsTradingDay(d) {
+		return Session{}, false
+	}
+	at := func(hour int, min int) time.Time {
+		return time.Date(d.Year(), d.Month(), d.Day(), hour, min, 0, 0, NewYork)
+	}
+	s := Session{Date: d, PreOpen: at(4, 0), Open: at(9, 30), Close: at(16, 0), PostClose: at(20, 0)}
+	if IsEarlyClose(d) {
+		s.EarlyClose = true
+		s.Close = at(13, 0)
+		s.PostClose = at(17, 0)
+	}
+	return s, true
+}
+
+// PhaseAt is where the market is at t
+func PhaseAt(t time.Time) Phase {
+	s, ok := SessionOn(t)
+	if !ok {
+		return Closed
+	}
+	return s.Phase(t)
+}
+
+// Next is the first session whose pre market opens after t
+func Next(t time.Time) Session {
+	d := Date(t)
+	for {
+		if s, ok := SessionOn(d); ok && s.PreOpen.After(t) {
+			return s
+		}
+		d = d.AddDate(0, 0, 1)
+	}
+}
+
+// LastSessions returns the n most recent sessions that had begun by t,
+// oldest first. A session in progress counts as the most recent.
+func LastSessions(t time.Time, n int) []Session {
+	sessions := make([]Session, n)
+	d := Date(t)
+	for i := n - 1; i >= 0; {
+		if s, ok := SessionOn(d); ok && !s.PreOpen.After(t) {
+			sessions[i] = s
+			i--
+		}
+		d = d.AddDate(0, 0, -1)
+	}
+	return sessions
+}
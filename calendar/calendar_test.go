@@ -0,0 +1,111 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func ny(year int, month time.Month, dom int, hour int, min int) time.Time {
+	return time.Date(year, month, dom, hour, min, 0, 0, NewYork)
+}
+
+func TestHolidays(t *testing.T) {
+	// published NYSE holiday schedules
+	expected := map[int][]string{
+		2024: {"01-01", "01-15", "02-19", "03-29", "05-27", "06-19", "07-04", "09-02", "11-28", "12-25"},
+		2022: {"01-17", "02-21", "04-15", "05-30", "06-20", "07-04", "09-05", "11-24", "12-26"},
+		2026: {"01-01", "01-19", "02-16", "04-03", "05-25", "06-19", "07-03", "09-07", "11-26", "12-25"},
+		2021: {"01-01", "01-18", "02-15", "04-02", "05-31", "07-05", "09-06", "11-25", "12-24"},
+	}
+	for year, dates := range expected {
+		var found []string
+		for d := ny(year, 1, 1, 12, 0); d.Year() == year; d = d.AddDate(0, 0, 1) {
+			if _, ok := Holiday(d); ok && d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+				found = append(found, d.Format("01-02"))
+			}
+		}
+		if len(found) != len(dates) {
+			t.Errorf("%v: expected %v got %v", year, dates, found)
+			continue
+		}
+		for i := range dates {
+			if found[i] != dates[i] {
+				t.Errorf("%v: expected %v got %v", year, dates, found)
+				break
+			}
+		}
+	}
+
+	if _, ok := Holiday(ny(2021, 12, 31, 12, 0)); ok {
+		t.Error("Saturday New Year's Day is not observed on Dec 31")
+	}
+	if name, ok := Holiday(ny(2025, 1, 9, 12, 0)); !ok || name == "" {
+		t.Error("Expected the Carter day of mourning")
+	}
+}
+
+func TestEarlyClose(t *testing.T) {
+	early := []time.Time{ny(2024, 7, 3, 0, 0), ny(2024, 11, 29, 0, 0), ny(2024, 12, 24, 0, 0), ny(2025, 7, 3, 0, 0), ny(2023, 7, 3, 0, 0)}
+	for _, d := range early {
+		if !IsEarlyClose(d) {
+			t.Error("Expected early close ", d)
+		}
+	}
+	normal := []time.Time{ny(2026, 7, 2, 0, 0), ny(2021, 12, 23, 0, 0), ny(2024, 11, 27, 0, 0), ny(2021, 12, 24, 0, 0)}
+	for _, d := range normal {
+		if IsEarlyClose(d) {
+			t.Error("Unexpected early close ", d)
+		}
+	}
+
+	s, ok := SessionOn(ny(2024, 11, 29, 10, 0))
+	if !ok || !s.EarlyClose || s.Close != ny(2024, 11, 29, 13, 0) || s.PostClose != ny(2024, 11, 29, 17, 0) {
+		t.Error("Unexpected black friday session ", s)
+	}
+}
+
+func TestPhase(t *testing.T) {
+	cases := map[time.Time]Phase{
+		ny(2024, 3, 28, 3, 59):  Closed,
+		ny(2024, 3, 28, 4, 0):   Pre,
+		ny(2024, 3, 28, 9, 30):  Regular,
+		ny(2024, 3, 28, 16, 0):  Post,
+		ny(2024, 3, 28, 20, 0):  Closed,
+		ny(2024, 3, 29, 11, 0):  Closed, /* good friday */
+		ny(2024, 3, 30, 11, 0):  Closed,
+		ny(2024, 12, 24, 13, 5): Post,
+	}
+	for at, phase := range cases {
+		if p := PhaseAt(at); p != phase {
+			t.Error(at, " expected ", phase, " got ", p)
+		}
+	}
+}
+
+func TestLastSessions(t *testing.T) {
+	// sunday after good friday
+	sessions := LastSessions(ny(2024, 3, 31, 12, 0), 2)
+	if sessions[0].Date != ny(2024, 3, 27, 0, 0) || sessions[1].Date != ny(2024, 3, 28, 0, 0) {
+		t.Error("Expected Mar 27 and 28 got ", sessions[0].Date, sessions[1].Date)
+	}
+
+	// 2am UTC on July 5th is still the July 4th holiday in New York
+	sessions = LastSessions(time.Date(2024, 7, 5, 2, 0, 0, 0, time.UTC), 1)
+	if sessions[0].Date != ny(2024, 7, 3, 0, 0) || !sessions[0].EarlyClose {
+		t.Error("Expected the July 3rd early close got ", sessions[0])
+	}
+
+	// a session counts once its pre market opens
+	sessions = LastSessions(ny(2024, 4, 1, 3, 0), 1)
+	if sessions[0].Date != ny(2024, 3, 28, 0, 0) {
+		t.Error("Expected Mar 28 before the pre market got ", sessions[0].Date)
+	}
+	sessions = LastSessions(ny(2024, 4, 1, 4, 0), 1)
+	if sessions[0].Date != ny(2024, 4, 1, 0, 0) {
+		t.Error("Expected Apr 1 once the pre market opens got ", sessions[0].Date)
+	}
+
+	if next := Next(ny(2024, 3, 28, 12, 0)); next.Date != ny(2024, 4, 1, 0, 0) {
+		t.Error("Expected next session Apr 1 got ", next.Date)
+	}
+}
@@ -0,0 +1,142 @@
+package calendar
+
+import (
+	"sync"
+	"time"
+)
+
+type day struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+func dayOf(t time.Time) day {
+	t = t.In(NewYork)
+	return day{t.Year(), t.Month(), t.Day()}
+}
+
+func (d day) time() time.Time {
+	return time.Date(d.year, d.month, d.day, 0, 0, 0, 0, NewYork)
+}
+
+/* unscheduled closures, ex national days of mourning */
+var special = map[day]string{
+	{2012, time.October, 29}: "Hurricane Sandy",
+	{2012, time.October, 30}: "Hurricane Sandy",
+	{2018, time.December, 5}: "National Day of Mourning for George H.W. Bush",
+	{2025, time.January, 9}:  "National Day of Mourning for Jimmy Carter",
+}
+
+var (
+	mu    sync.Mutex
+	years = map[int]map[day]string{}
+)
+
+// Holiday returns the name of the market holiday on t's New York date
+func Holiday(t time.Time) (string, bool) {
+	d := dayOf(t)
+	if name, ok := special[d]; ok {
+		return name, true
+	}
+	mu.Lock()
+	holidays, ok := years[d.year]
+	if !ok {
+		holidays = holidaysIn(d.year)
+		years[d.year] = holidays
+	}
+	mu.Unlock()
+	name, ok := holidays[d]
+	return name, ok
+}
+
+// IsEarlyClose is true on trading days the regular session ends at 1pm:
+// July 3rd before a weekday Independence Day, the day after Thanksgiving and
+// Christmas Eve
+func IsEarlyClose(t time.Time) bool {
+	d := dayOf(t)
+	weekday := d.time().Weekday()
+	if weekday == time.Saturday || weekday == time.Sunday {
+		return false
+	}
+	if _, holiday := Holiday(d.time()); holiday {
+		return false
+	}
+	switch {
+	case d.month == time.July && d.day == 3:
+		return weekday != time.Friday
+	case d.month == time.November:
+		return d == nthWeekday(d.year, time.November, time.Thursday, 4).add(1)
+	case d.month == time.December && d.day == 24:
+		return true
+	}
+	return false
+}
+
+// holidaysIn follows NYSE rule 7.2: Saturday holidays are observed the Friday
+// before, except New Year's Day, and Sunday holidays the Monday after
+func holidaysIn(year int) map[day]string {
+	h := map[day]string{}
+	fixed := func(month time.Month, dom int, name string) {
+		d := day{year, month, dom}
+		switch d.time().Weekday() {
+		case time.Saturday:
+			if month != time.January {
+				h[d.add(-1)] = name
+			}
+		case time.Sunday:
+			h[d.add(1)] = name
+		default:
+			h[d] = name
+		}
+	}
+
+	fixed(time.January, 1, "New Year's Day")
+	h[nthWeekday(year, time.January, time.Monday, 3)] = "Martin Luther King Jr. Day"
+	h[nthWeekday(year, time.February, time.Monday, 3)] = "Washington's Birthday"
+	h[easter(year).add(-2)] = "Good Friday"
+	h[lastWeekday(year, time.May, time.Monday)] = "Memorial Day"
+	if year >= 2022 {
+		fixed(time.June, 19, "Juneteenth")
+	}
+	fixed(time.July, 4, "Independence Day")
+	h[nthWeekday(year, time.September, time.Monday, 1)] = "Labor Day"
+	h[nthWeekday(year, time.November, time.Thursday, 4)] = "Thanksgiving Day"
+	fixed(time.December, 25, "Christmas Day")
+	return h
+}
+
+func (d day) add(days int) day {
+	return dayOf(d.time().AddDate(0, 0, days))
+}
+
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) day {
+	first := day{year, month, 1}
+	offset := (int(weekday) - int(first.time().Weekday()) + 7) % 7
+	return first.add(offset + 7*(n-1))
+}
+
+func lastWeekday(year int, month time.Month, weekday time.Weekday) day {
+	last := day{year, month + 1, 1}.add(-1)
+	offset := (int(last.time().Weekday()) - int(weekday) + 7) % 7
+	return last.add(-offset)
+}
+
+// easter is Easter Sunday by the anonymous Gregorian algorithm
+func easter(year int) day {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	dom := (h+l-7*m+114)%31 + 1
+	return day{year, time.Month(month), dom}
+}
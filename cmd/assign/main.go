@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/screener"
+)
+
+// Usage: assign [-config screens.yaml] [-list] [screen names...]
+// Queues every screen when no names are given.
+func main() {
+	path := flag.String("config", screener.PathFromEnv(), "screens yaml or json file")
+	list := flag.Bool("list", false, "print the screens and exit")
+	flag.Parse()
+
+	config, err := screener.Load(*path)
+	if err != nil {
+		log.Fatal("Screens config failed to load ", err)
+	}
+
+	if *list {
+		for _, s := range config.Screens {
+			fmt.Printf("%-12v %-8v %-20v %v\n", s.Name, s.Job, s.Schedule, s.Query())
+		}
+		return
+	}
+
+	screens := config.Screens
+	if flag.NArg() > 0 {
+		screens = nil
+		for _, name := range flag.Args() {
+			s, ok := config.Screen(name)
+			if !ok {
+				log.Fatal("Unknown screen ", name)
+			}
+			screens = append(screens, s)
+		}
+	}
+
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+
+	for _, s := range screens {
+		// http response task
+		if err := screener.Run(store, s); err != nil {
+			log.Fatal("Work Queue up failed. ", s.Name, err)
+		}
+		log.Println("Queued screen ", s.Name)
+	}
+}
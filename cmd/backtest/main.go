@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/backtest"
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/resample"
+)
+
+/* regular session bars in a year, used to annualize sharpe and sortino */
+var periodsPerYear = map[etl.Timeframe]float64{
+	etl.Minute15: 252 * 26,
+	etl.Minute30: 252 * 13,
+	etl.Hour1:    252 * 7,
+	etl.Hour4:    252 * 2,
+	etl.Daily:    252,
+	etl.Weekly:   52,
+}
+
+func main() {
+	symbol := flag.String("symbol", "", "symbol to backtest")
+	timeframe := flag.String("timeframe", string(etl.Minute15), "candle timeframe 15m, 30m, 1h, 4h, 1d or 1w")
+	from := flag.String("from", time.Now().AddDate(0, -1, 0).Format("2006-01-02"), "first day YYYY-MM-DD")
+	to := flag.String("to", time.Now().Format("2006-01-02"), "last day YYYY-MM-DD")
+	cash := flag.Float64("cash", 10000, "starting cash")
+	commission := flag.Float64("commission", 0, "commission per share")
+	minCommission := flag.Float64("min-commission", 0, "minimum commission per order")
+	slippage := flag.Float64("slippage-bps", 5, "slippage in basis points per fill")
+	fast := flag.Int("fast", 20, "fast sma period")
+	slow := flag.Int("slow", 50, "slow sma period")
+	quantity := flag.Int("qty", 100, "shares per trade")
+	extended := flag.Bool("extended", false, "include pre and post market bars")
+	asJSON := flag.Bool("json", false, "print the full report as json")
+	flag.Parse()
+
+	if *symbol == "" {
+		log.Fatal("-symbol is required")
+	}
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		log.Fatal("Invalid -from ", err)
+	}
+	end, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		log.Fatal("Invalid -to ", err)
+	}
+
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+
+	tf := etl.Timeframe(*timeframe)
+	candles, err := resample.Query(store.Candles, *symbol, tf, start, end.AddDate(0, 0, 1), resample.Options{Extended: *extended})
+	if err != nil {
+		log.Fatal("Loading candles failed ", err)
+	}
+	if len(candles) == 0 {
+		log.Fatal("No ", tf, " candles for ", *symbol)
+	}
+
+	config := backtest.Config{
+		Symbol:         *symbol,
+		Cash:           *cash,
+		Commission:     *commission,
+		MinCommission:  *minCommission,
+		SlippageBps:    *slippage,
+		PeriodsPerYear: periodsPerYear[tf],
+	}
+	report := backtest.Run(config, candles, backtest.NewSMACross(*fast, *slow, *quantity))
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	for _, t := range report.Trades {
+		fmt.Printf("%-5v %4v  %v @ %.2f -> %v @ %.2f  pnl=%.2f (%.2f%%)\n", t.Side, t.Quantity,
+			formatMillis(t.EntryTime), t.EntryPrice, formatMillis(t.ExitTime), t.ExitPrice, t.PnL, t.Return*100)
+	}
+	fmt.Printf("bars=%v trades=%v winRate=%.1f%%\n", len(candles), len(report.Trades), report.WinRate*100)
+	fmt.Printf("equity %.2f -> %.2f (%.2f%%) commissions=%.2f\n",
+		report.StartEquity, report.EndEquity, report.TotalReturn*100, report.Commissions)
+	fmt.Printf("sharpe=%.2f sortino=%.2f maxDrawdown=%.2f%%\n", report.Sharpe, report.Sortino, report.MaxDrawdown*100)
+}
+
+func formatMillis(ms uint64) string {
+	return time.UnixMilli(int64(ms)).Format("2006-01-02 15:04")
+}
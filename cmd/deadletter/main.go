@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/etl"
+)
+
+const usage = `Usage: deadletter <list|requeue|purge> [flags]
+
+  list      print dead lettered jobs, newest first
+  requeue   move matching jobs back onto the api queue
+  purge     delete matching jobs, requires a filter or -all
+
+  -quarantine runs the same commands on payloads the transforms rejected
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	symbol := flags.String("symbol", "", "only jobs for this symbol")
+	work := flags.String("work", "", "only jobs of this type ex Macros, Medium")
+	limit := flags.Int64("limit", 50, "max jobs to list")
+	all := flags.Bool("all", false, "allow purge without a filter")
+	quarantined := flags.Bool("quarantine", false, "act on quarantined payloads instead of dead letters")
+	flags.Parse(os.Args[2:])
+
+	filter := etl.JobFilter{Symbol: *symbol, Work: etl.EtlJob(*work)}
+
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+
+	if *quarantined {
+		runQuarantine(store.Quarantined, os.Args[1], filter, *limit, *all)
+		return
+	}
+
+	switch os.Args[1] {
+	case "list":
+		docs, err := store.DeadLetters.List(filter, *limit)
+		if err != nil {
+			log.Fatal("Dead letter list failed ", err)
+		}
+		for _, doc := range docs {
+			fmt.Printf("%-8v %-8v attempts=%v dead=%v error=%v\n",
+				doc.Symbol, doc.Work, doc.EtlConfig.Attempts, doc.DeadAt.Format(time.RFC3339), doc.EtlConfig.LastError)
+		}
+		fmt.Println(len(docs), "dead letters")
+	case "requeue":
+		n, err := store.DeadLetters.Requeue(filter)
+		if err != nil {
+			log.Fatal("Dead letter requeue failed ", err)
+		}
+		fmt.Println(n, "jobs requeued")
+	case "purge":
+		if filter == (etl.JobFilter{}) && !*all {
+			log.Fatal("Refusing to purge every dead letter without -all")
+		}
+		n, err := store.DeadLetters.Purge(filter)
+		if err != nil {
+			log.Fatal("Dead letter purge failed ", err)
+		}
+		fmt.Println(n, "jobs purged")
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+func runQuarantine(quarantine etl.QuarantineService, command string, filter etl.JobFilter, limit int64, all bool) {
+	switch command {
+	case "list":
+		docs, err := quarantine.List(filter, limit)
+		if err != nil {
+			log.Fatal("Quarantine list failed ", err)
+		}
+		for _, doc := range docs {
+			fmt.Printf("%-8v %-8v quarantined=%v reason=%v\n",
+				doc.Symbol, doc.Work, doc.QuarantinedAt.Format(time.RFC3339), doc.Reason)
+		}
+		fmt.Println(len(docs), "quarantined payloads")
+	case "requeue":
+		n, err := quarantine.Requeue(filter)
+		if err != nil {
+			log.Fatal("Quarantine requeue failed ", err)
+		}
+		fmt.Println(n, "jobs requeued")
+	case "purge":
+		if filter == (etl.JobFilter{}) && !all {
+			log.Fatal("Refusing to purge every quarantined payload without -all")
+		}
+		n, err := quarantine.Purge(filter)
+		if err != nil {
+			log.Fatal("Quarantine purge failed ", err)
+		}
+		fmt.Println(n, "payloads purged")
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jaredtokuz/market-trader/fakeapi"
+)
+
+// Point the pipeline at it with
+//
+//	MARKET_DATA_PROVIDER=td MARKET_DATA_BASE_URL=http://localhost:8089/v1
+//	TOKEN_URL=http://localhost:8089/v1/oauth2/token
+//
+// and a TOKEN_PATH file holding any refresh token. GET /stats counts responses.
+func main() {
+	addr := flag.String("addr", ":8089", "listen address")
+	seed := flag.Int64("seed", 1, "seed for injected faults and jitter")
+	latency := flag.Duration("latency", 0, "added to every response ex 200ms")
+	jitter := flag.Duration("jitter", 0, "up to this much more latency")
+	unauthorized := flag.Float64("unauthorized", 0, "fraction of requests answered 401")
+	rateLimited := flag.Float64("rate-limited", 0, "fraction of requests answered 429")
+	serverErrors := flag.Float64("server-errors", 0, "fraction of requests answered 500, 502 or 503")
+	rpm := flag.Int("rpm", 120, "429 past this many requests a minute, 0 for no limit")
+	tokenTTL := flag.Duration("token-ttl", 0, "lifetime of issued access tokens, 0 accepts any bearer token")
+	notFound := flag.String("not-found", "", "comma separated symbols answered 404")
+	verbose := flag.Bool("v", false, "log every request")
+	flag.Parse()
+
+	config := fakeapi.Config{
+		Seed:              *seed,
+		Latency:           *latency,
+		Jitter:            *jitter,
+		Unauthorized:      *unauthorized,
+		RateLimited:       *rateLimited,
+		ServerErrors:      *serverErrors,
+		RequestsPerMinute: *rpm,
+		TokenTTL:          *tokenTTL,
+		Verbose:           *verbose,
+	}
+	if *notFound != "" {
+		config.NotFound = strings.Split(strings.ToUpper(*notFound), ",")
+	}
+
+	log.Println("Fake TD api listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, fakeapi.New(config)))
+}
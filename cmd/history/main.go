@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/history"
+)
+
+const usage = `Usage: history <import|files> [flags] [paths...]
+
+  import    load daily candles from EODData csv files or directories of them
+            ex history import -exchange NASDAQ,NYSE -from 2018-01-01 ./data/eod
+  files     print the files already imported
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	exchanges := flags.String("exchange", "", "comma separated exchanges to import, by file name")
+	from := flags.String("from", "", "first date to import, YYYY-MM-DD")
+	to := flags.String("to", "", "import dates before this, YYYY-MM-DD")
+	force := flags.Bool("force", false, "reimport files already recorded")
+	dryRun := flags.Bool("dry-run", false, "count rows without writing them")
+	verbose := flags.Bool("v", false, "print every file")
+	flags.Parse(os.Args[2:])
+
+	options := history.Options{Force: *force, DryRun: *dryRun}
+	if *exchanges != "" {
+		options.Exchanges = strings.Split(strings.ToUpper(*exchanges), ",")
+	}
+	options.From = parseDate("from", *from)
+	options.To = parseDate("to", *to)
+
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+
+	switch os.Args[1] {
+	case "import":
+		if flags.NArg() == 0 {
+			log.Fatal("import needs at least one file or directory")
+		}
+		start := time.Now()
+		result, err := history.NewImporter(store, options).Import(flags.Args()...)
+		if *verbose || err != nil {
+			for _, f := range result.Files {
+				status := "imported"
+				if f.Skipped {
+					status = "skipped"
+				}
+				fmt.Printf("%-8v %v rows=%v symbols=%v filtered=%v\n", status, f.Path, f.Rows, f.Symbols, f.Filtered)
+			}
+		}
+		if err != nil {
+			log.Fatal("Import failed ", err)
+		}
+		fmt.Printf("%v files imported, %v skipped, %v daily candles in %v\n",
+			result.Imported, result.Skipped, result.Rows, time.Since(start).Round(time.Second))
+	case "files":
+		docs, err := history.NewLedger(store).List()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, d := range docs {
+			fmt.Printf("%-24v %-8v rows=%v symbols=%v imported=%v\n", d.Name, d.Exchange, d.Rows, d.Symbols, d.ImportedAt.Format(time.RFC3339))
+		}
+		fmt.Println(len(docs), "files")
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+func parseDate(name string, v string) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, calendar.NewYork)
+	if err != nil {
+		log.Fatal("-", name, " ", err)
+	}
+	return t
+}
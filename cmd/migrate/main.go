@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/migrate"
+)
+
+const usage = `Usage: migrate <up|down|status> [flags]
+
+  up       apply pending migrations, every command also does this on start
+           unless AUTO_MIGRATE=false
+  down     revert the newest applied migrations
+  status   print every migration and when it was applied
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	to := flags.Int("to", 0, "up: stop after this version, 0 applies all")
+	steps := flags.Int("steps", 1, "down: how many migrations to revert")
+	flags.Parse(os.Args[2:])
+
+	db, err := etl.Connect(os.Getenv("MONGO_URI"), os.Getenv("DB_NAME"))
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+	migrator, err := migrate.NewMigrator(db, etl.Migrations)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch os.Args[1] {
+	case "up":
+		ran, err := migrator.Up(*to)
+		printRan("applied", ran)
+		if err != nil {
+			log.Fatal("Migrate up failed ", err)
+		}
+	case "down":
+		ran, err := migrator.Down(*steps)
+		printRan("reverted", ran)
+		if err != nil {
+			log.Fatal("Migrate down failed ", err)
+		}
+	case "status":
+		status, err := migrator.Status()
+		if err != nil {
+			log.Fatal("Migrate status failed ", err)
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d %-25v %v\n", s.Version, applied, s.Description)
+		}
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+func printRan(verb string, ran []migrate.Migration) {
+	for _, m := range ran {
+		fmt.Printf("%v %d %v\n", verb, m.Version, m.Description)
+	}
+	fmt.Println(len(ran), "migrations", verb)
+}
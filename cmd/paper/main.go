@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/orders"
+	"github.com/jaredtokuz/market-trader/paper"
+)
+
+const usage = `Usage: paper <command> [flags]
+
+  open      create an account with -cash, no-op if it exists
+  buy       submit a buy order, ex paper buy -symbol AAPL -qty 10 -type limit -limit 150
+  sell      submit a sell order
+  cancel    cancel an open order by -id
+  show      print cash, positions, P&L and open orders
+  sync      fill open orders against stored Signals candles since -since
+  quotes    fill open orders against live quotes
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	account := flags.String("account", "default", "paper account name")
+	cash := flags.Float64("cash", 100000, "starting cash for open")
+	symbol := flags.String("symbol", "", "order symbol")
+	quantity := flags.Int("qty", 0, "order quantity")
+	orderType := flags.String("type", string(orders.Market), "market, limit, stop or stop_limit")
+	limit := flags.Float64("limit", 0, "limit price")
+	stop := flags.Float64("stop", 0, "stop price")
+	id := flags.String("id", "", "order id for cancel")
+	since := flags.Duration("since", time.Hour, "how far back sync reads candles")
+	commission := flags.Float64("commission", 0, "commission per share")
+	minCommission := flags.Float64("min-commission", 0, "minimum commission per order")
+	slippage := flags.Float64("slippage-bps", 5, "slippage in basis points per fill")
+	flags.Parse(os.Args[2:])
+
+	mongo, err := etl.NewMongoController(os.Getenv("MONGO_URI"), os.Getenv("DB_NAME"))
+	if err != nil {
+		log.Fatal("Database connection failed")
+	}
+	portfolio := paper.NewPortfolio(mongo.Database(), paper.Costs{
+		Commission:    *commission,
+		MinCommission: *minCommission,
+		SlippageBps:   *slippage,
+	})
+
+	switch os.Args[1] {
+	case "open":
+		acct, err := portfolio.OpenAccount(*account, *cash)
+		if err != nil {
+			log.Fatal("Opening account failed ", err)
+		}
+		fmt.Printf("%v cash=%.2f\n", acct.Name, acct.Cash)
+	case "buy", "sell":
+		order := orders.Order{
+			Symbol:     strings.ToUpper(*symbol),
+			Side:       orders.Side(os.Args[1]),
+			Type:       orders.Type(*orderType),
+			Quantity:   *quantity,
+			LimitPrice: *limit,
+			StopPrice:  *stop,
+		}
+		doc, err := portfolio.Submit(*account, order)
+		if err != nil {
+			log.Fatal("Order rejected ", err)
+		}
+		fmt.Println("submitted", doc.ID.Hex())
+	case "cancel":
+		oid, err := primitive.ObjectIDFromHex(*id)
+		if err != nil {
+			log.Fatal("Invalid -id ", err)
+		}
+		if err := portfolio.Cancel(*account, oid); err != nil {
+			log.Fatal("Cancel failed ", err)
+		}
+		fmt.Println("cancelled", *id)
+	case "show":
+		show(portfolio, *account)
+	case "sync":
+		symbols, err := portfolio.Symbols()
+		if err != nil {
+			log.Fatal(err)
+		}
+		to := time.Now()
+		from := to.Add(-*since)
+		for _, s := range symbols {
+			candles, err := mongo.Candles.Range(s, etl.JobTimeframe(etl.Signals), from, to)
+			if err != nil {
+				log.Fatal("Loading candles failed ", err)
+			}
+			for _, c := range candles {
+				filled, err := portfolio.OnCandle(s, c)
+				if err != nil {
+					log.Fatal("Filling orders failed ", err)
+				}
+				printFills(filled)
+			}
+		}
+	case "quotes":
+		symbols, err := portfolio.Symbols()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(symbols) == 0 {
+			return
+		}
+		api, err := etl.NewTDApiServiceFromEnv(mongo.Store())
+		if err != nil {
+			log.Fatal(err)
+		}
+		quotes, err := api.Quotes(symbols)
+		if err != nil {
+			log.Fatal("Quotes failed ", err)
+		}
+		for s, q := range quotes {
+			quote, ok := q.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			price, ok := quote["lastPrice"].(float64)
+			if !ok {
+				log.Println("No last price for ", s)
+				continue
+			}
+			filled, err := portfolio.OnQuote(s, price, time.Now())
+			if err != nil {
+				log.Fatal("Filling orders failed ", err)
+			}
+			printFills(filled)
+		}
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+func show(portfolio paper.Portfolio, name string) {
+	account, err := portfolio.Account(name)
+	if err != nil {
+		log.Fatal("Account lookup failed ", err)
+	}
+	positions, err := portfolio.Positions(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	open, err := portfolio.Orders(name, paper.Open)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, p := range positions {
+		fmt.Printf("%-8v %6v @ %-10.2f last=%-10.2f unrealized=%-10.2f realized=%.2f\n",
+			p.Symbol, p.Quantity, p.AvgPrice, p.LastPrice, p.Unrealized, p.Realized-p.Commissions)
+	}
+	for _, o := range open {
+		fmt.Printf("open %v %-4v %-8v %v x%v limit=%v stop=%v\n", o.ID.Hex(), o.Side, o.Symbol, o.Type, o.Quantity, o.LimitPrice, o.StopPrice)
+	}
+	s := paper.Summarize(account, positions)
+	fmt.Printf("cash=%.2f marketValue=%.2f equity=%.2f realized=%.2f unrealized=%.2f\n",
+		s.Cash, s.MarketValue, s.Equity, s.Realized, s.Unrealized)
+}
+
+func printFills(filled []paper.OrderDocument) {
+	for _, f := range filled {
+		fmt.Printf("filled %v %v %v x%v @ %.2f\n", f.Account, f.Side, f.Symbol, f.Quantity, f.FillPrice)
+	}
+}
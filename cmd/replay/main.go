@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jaredtokuz/market-trader/etl"
+)
+
+const usage = `Usage: replay <run|export> [flags]
+
+  run       transform and load recorded responses again, from APICalls or -dir
+  export    write the responses cached in APICalls to -dir as fixtures
+
+  The whole pipeline replays when REPLAY=apicalls or REPLAY=<dir> is set for
+  worker or scheduler instead.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	dir := flags.String("dir", "", "fixtures directory laid out as <work>/<symbol>.json")
+	work := flags.String("work", "", "only this job type ex Macros, Medium")
+	symbol := flags.String("symbol", "", "only this symbol")
+	flags.Parse(os.Args[2:])
+
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+
+	switch os.Args[1] {
+	case "run":
+		source := etl.ReplayFromAPICalls
+		if *dir != "" {
+			source = *dir
+		}
+		service, err := etl.NewReplayServiceFromEnv(store, source)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var sourceJobs etl.ReplaySource = etl.NewApiCallsSource(store.ApiCalls)
+		if *dir != "" {
+			sourceJobs = etl.NewFixtureSource(*dir)
+		}
+		jobs, err := sourceJobs.Jobs(etl.EtlJob(*work))
+		if err != nil {
+			log.Fatal("Listing recorded jobs failed ", err)
+		}
+		var loaded, failed int
+		for _, job := range jobs {
+			if *symbol != "" && job.Symbol != *symbol {
+				continue
+			}
+			success, err := service.Call(job)
+			if err == nil {
+				err = etl.Load(store, success)
+			}
+			if err != nil {
+				log.Println("Replay failed ", job.Symbol, job.Work, err)
+				failed++
+				continue
+			}
+			loaded++
+		}
+		fmt.Println(loaded, "responses loaded,", failed, "failed")
+	case "export":
+		if *dir == "" {
+			log.Fatal("export needs -dir")
+		}
+		docs, err := store.ApiCalls.List(etl.EtlJob(*work))
+		if err != nil {
+			log.Fatal("Listing APICalls failed ", err)
+		}
+		var written int
+		for _, doc := range docs {
+			if *symbol != "" && doc.EtlConfig.Symbol != *symbol {
+				continue
+			}
+			if err := etl.WriteFixture(*dir, doc); err != nil {
+				log.Fatal(err)
+			}
+			written++
+		}
+		fmt.Println(written, "fixtures written to", *dir)
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
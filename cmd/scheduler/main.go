@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/scheduler"
+	"github.com/jaredtokuz/market-trader/screener"
+	"github.com/jaredtokuz/market-trader/signals"
+)
+
+// Runs every screen on its schedule, a worker pool draining the api queue
+// and the signal engine in one process. GET /status on -addr lists the last
+// and next run of each job.
+func main() {
+	path := flag.String("config", screener.PathFromEnv(), "screens yaml or json file")
+	addr := flag.String("addr", ":3001", "status http address, empty disables")
+	workerSchedule := flag.String("worker", "*/5 * * * *", "cron schedule to drain the api queue")
+	signalSchedule := flag.String("signals", "*/15 9-16 * * 1-5", "cron schedule for the signal engine, empty disables")
+	flag.Parse()
+
+	config, err := screener.Load(*path)
+	if err != nil {
+		log.Fatal("Screens config failed to load ", err)
+	}
+
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+	tdApiService, err := etl.NewTDApiServiceFromEnv(store)
+	if err != nil {
+		log.Fatal("Api service failed ", err)
+	}
+	store.ApiQueue.Init() // sets all docs without a live lease to stage api
+
+	sched := scheduler.New()
+	err = sched.Add(scheduler.Job{
+		Name:     "worker",
+		Schedule: *workerSchedule,
+		Market:   scheduler.Always,
+		Run: func(ctx context.Context) error {
+			if _, err := store.ApiQueue.Reclaim(); err != nil {
+				return err
+			}
+			return etl.RunWorkerPoolContext(ctx, store, tdApiService, etl.WorkerConfigFromEnv())
+		},
+	})
+	if err != nil {
+		log.Fatal("Invalid worker schedule ", err)
+	}
+
+	for _, s := range config.Screens {
+		if s.Schedule == "" {
+			continue
+		}
+		screen := s
+		err := sched.Add(scheduler.Job{
+			Name:     screen.Name,
+			Schedule: screen.Schedule,
+			Market:   scheduler.Market(screen.Market),
+			Run: func(ctx context.Context) error {
+				if err := screener.Run(store, screen); err != nil {
+					return err
+				}
+				// start draining now instead of on the next worker tick
+				return sched.Trigger("worker")
+			},
+		})
+		if err != nil {
+			log.Fatal("Invalid schedule for screen ", screen.Name, err)
+		}
+	}
+
+	if *signalSchedule != "" {
+		engine := signals.NewEngine(store, signals.DefaultRules())
+		err := sched.Add(scheduler.Job{
+			Name:     "signalengine",
+			Schedule: *signalSchedule,
+			Market:   scheduler.ExtendedHours,
+			Run: func(ctx context.Context) error {
+				_, err := engine.Run()
+				return err
+			},
+		})
+		if err != nil {
+			log.Fatal("Invalid signal engine schedule ", err)
+		}
+	}
+
+	sched.Start()
+	log.Println("Scheduler started")
+
+	if *addr != "" {
+		http.Handle("/status", sched)
+		go func() {
+			log.Println("Status listening on ", *addr)
+			if err := http.ListenAndServe(*addr, nil); err != nil {
+				log.Println("Status server stopped ", err)
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("Scheduler stopping, waiting for running jobs")
+	sched.Stop()
+}
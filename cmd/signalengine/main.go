@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/signals"
+)
+
+func main() {
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+
+	result, err := signals.NewEngine(store, signals.DefaultRules()).Run()
+	if err != nil {
+		log.Fatal("Signal engine failed ", err)
+	}
+	log.Printf("Signals evaluated %v, entered %v, exited %v", result.Evaluated, result.Entered, result.Exited)
+}
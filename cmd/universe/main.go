@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/eoddata"
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/universe"
+)
+
+const usage = `Usage: universe <import|list|audit> [flags] [files...]
+
+  import    diff EODData csv files against the exchange universe, oldest first
+            ex universe import ./data/NASDAQ_20230208.csv ./data/NYSE_20230208.csv
+  list      print members, filtered by -exchange and -status
+  audit     print listing changes, newest first, filtered by -symbol
+`
+
+type importFile struct {
+	path     string
+	exchange string
+	date     time.Time
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	exchange := flags.String("exchange", "", "exchange, import defaults to the file name prefix")
+	status := flags.String("status", "", "list only active or delisted")
+	symbol := flags.String("symbol", "", "audit only this symbol")
+	limit := flags.Int64("limit", 100, "max audit entries")
+	minVolume := flags.Int("min-volume", 200000, "volume a symbol new to Macros needs to be tracked")
+	maxDelist := flags.Float64("max-delist", 0.1, "refuse imports delisting more than this fraction of an exchange")
+	force := flags.Bool("force", false, "import out of order or past -max-delist")
+	dryRun := flags.Bool("dry-run", false, "print the changes without writing them")
+	flags.Parse(os.Args[2:])
+
+	store, err := etl.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("Database connection failed ", err)
+	}
+	service := universe.NewService(store)
+
+	switch os.Args[1] {
+	case "import":
+		if flags.NArg() == 0 {
+			log.Fatal("import needs at least one csv file")
+		}
+		var files []importFile
+		for _, path := range flags.Args() {
+			name, date, err := eoddata.ParseFilename(path)
+			if err != nil && *exchange == "" {
+				log.Fatal(err, ", or pass -exchange")
+			}
+			if *exchange != "" {
+				name = strings.ToUpper(*exchange)
+			}
+			files = append(files, importFile{path: path, exchange: name, date: date})
+		}
+		sort.SliceStable(files, func(i, j int) bool { return files[i].date.Before(files[j].date) })
+
+		for _, f := range files {
+			rows, err := eoddata.ReadFile(f.path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			date := f.date
+			if len(rows) > 0 {
+				date = rows[0].Date
+			}
+			plan, err := service.Import(f.exchange, date, rows, universe.ImportOptions{
+				Source:            f.path,
+				MinVolume:         *minVolume,
+				MaxDelistFraction: *maxDelist,
+				Force:             *force,
+				DryRun:            *dryRun,
+			})
+			if err != nil {
+				log.Fatal("Import failed ", f.path, " ", err)
+			}
+			fmt.Printf("%v %v: %v tracked, %v listed, %v relisted, %v delisted, %v under min volume\n",
+				plan.Exchange, plan.Date.Format("2006-01-02"), len(plan.Seen),
+				len(plan.Listed), len(plan.Relisted), len(plan.Delisted), plan.Skipped)
+			if *dryRun {
+				printSymbols("listed", plan.Listed)
+				printSymbols("relisted", plan.Relisted)
+				printSymbols("delisted", plan.Delisted)
+			}
+		}
+	case "list":
+		members, err := service.Members(strings.ToUpper(*exchange), *status)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range members {
+			delisted := ""
+			if m.Universe.DelistedAt != nil {
+				delisted = m.Universe.DelistedAt.Format("2006-01-02")
+			}
+			fmt.Printf("%-8v %-8v %-9v listed=%v lastSeen=%v delisted=%v\n", m.Symbol, m.Universe.Exchange, m.Universe.Status,
+				m.Universe.ListedAt.Format("2006-01-02"), m.Universe.LastSeen.Format("2006-01-02"), delisted)
+		}
+		fmt.Println(len(members), "symbols")
+	case "audit":
+		docs, err := service.Audit(strings.ToUpper(*symbol), *limit)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, d := range docs {
+			fmt.Printf("%v %-8v %-8v %-9v %v\n", d.Date.Format("2006-01-02"), d.Symbol, d.Exchange, d.Event, d.Source)
+		}
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+func printSymbols(label string, symbols []string) {
+	if len(symbols) > 0 {
+		fmt.Printf("  %v: %v\n", label, strings.Join(symbols, " "))
+	}
+}
@@ -1,16 +1,47 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/jaredtokuz/market-trader/etl"
 )
 
 func main() {
+	symbols := flag.String("symbols", "", "comma separated symbols to queue before working, e.g. TSLA,MSFT")
+	work := flag.String("work", string(etl.Macros), "job the -symbols are queued for: Macros, Medium, Short or Signals")
+	flag.Parse()
 
-	err := etl.InitWorker()
+	if *symbols == "" {
+		err := etl.InitWorker()
+		if err != nil {
+			log.Fatal("Issue in check daily avg volume", err)
+		}
+		return
+	}
 
+	store, err := etl.NewStoreFromEnv()
 	if err != nil {
+		log.Fatal(err)
+	}
+	if err := store.ApiQueue.Enqueue(strings.Split(*symbols, ","), etl.EtlJob(*work)); err != nil {
+		log.Fatal("Failed to queue symbols ", err)
+	}
+	if err := etl.RunWorker(store); err != nil {
 		log.Fatal("Issue in check daily avg volume", err)
 	}
+
+	if os.Getenv("STORAGE") == etl.MemoryStorage {
+		// nothing outlives the process, so show what the run did
+		dead, _ := store.DeadLetters.List(etl.JobFilter{}, 0)
+		quarantined, _ := store.Quarantined.List(etl.JobFilter{}, 0)
+		logs, _ := store.Logs.List(0)
+		for i := len(logs) - 1; i >= 0; i-- {
+			fmt.Printf("%s %s: %s\n", logs[i].At.Format("15:04:05"), logs[i].Category, logs[i].Msg)
+		}
+		fmt.Printf("dead letters: %d, quarantined: %d\n", len(dead), len(quarantined))
+	}
 }
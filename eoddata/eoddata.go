@@ -0,0 +1,141 @@
+// Package eoddata reads EODData standard CSV end of day files, named like
+// NASDAQ_20230208.csv with a Symbol,Date,Open,High,Low,Close,Volume header.
+package eoddata
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+type Row struct {
+	Symbol string
+	Date   time.Time /* midnight in New York */
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int
+}
+
+// Candle is the row as a daily bar stamped at midnight New York time
+func (r Row) Candle() shared.Candle {
+	return shared.Candle{
+		Datetime: uint64(r.Date.UnixMilli()),
+		Open:     r.Open,
+		High:     r.High,
+		Low:      r.Low,
+		Close:    r.Close,
+		Volume:   r.Volume,
+	}
+}
+
+var columns = []string{"symbol", "date", "open", "high", "low", "close", "volume"}
+
+// Read parses every row, columns are matched by header name in any order
+func Read(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	indices := make(map[string]int)
+	for i, column := range header {
+		indices[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range columns {
+		if _, ok := indices[column]; !ok {
+			return nil, fmt.Errorf("column not found: %v", column)
+		}
+	}
+
+	var rows []Row
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row, err := parseRow(record, indices)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func ReadFile(path string) ([]Row, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	rows, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return rows, nil
+}
+
+func parseRow(record []string, indices map[string]int) (Row, error) {
+	value := func(column string) string {
+		return strings.TrimSpace(record[indices[column]])
+	}
+	row := Row{Symbol: strings.ToUpper(value("symbol"))}
+	if row.Symbol == "" {
+		return row, fmt.Errorf("empty symbol")
+	}
+	date, err := ParseDate(value("date"))
+	if err != nil {
+		return row, err
+	}
+	row.Date = date
+	prices := []*float64{&row.Open, &row.High, &row.Low, &row.Close}
+	for i, column := range []string{"open", "high", "low", "close"} {
+		if *prices[i], err = strconv.ParseFloat(value(column), 64); err != nil {
+			return row, fmt.Errorf("%v: %w", column, err)
+		}
+	}
+	volume, err := strconv.ParseFloat(value("volume"), 64)
+	if err != nil {
+		return row, fmt.Errorf("volume: %w", err)
+	}
+	row.Volume = int(volume)
+	return row, nil
+}
+
+var dateLayouts = []string{"02-Jan-2006", "20060102", "2006-01-02", "01/02/2006"}
+
+// ParseDate accepts the date formats EODData offers for downloads
+func ParseDate(v string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, v, calendar.NewYork); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", v)
+}
+
+// ParseFilename splits EXCHANGE_YYYYMMDD.csv
+func ParseFilename(path string) (exchange string, date time.Time, err error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	i := strings.LastIndex(name, "_")
+	if i < 1 {
+		return "", time.Time{}, fmt.Errorf("expected EXCHANGE_YYYYMMDD file name: %v", path)
+	}
+	date, err = time.ParseInLocation("20060102", name[i+1:], calendar.NewYork)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("expected EXCHANGE_YYYYMMDD file name: %v", path)
+	}
+	return strings.ToUpper(name[:i]), date, nil
+}
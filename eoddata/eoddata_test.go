@@ -0,0 +1,60 @@
+package eoddata
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+)
+
+func TestRead(t *testing.T) {
+	csv := `Symbol,Date,Open,High,Low,Close,Volume
+AACG,08-Feb-2023,1.64,1.69,1.6,1.65,6900
+aadi,08-Feb-2023,12.47,12.5,12.01,12.03,103500
+`
+	rows, err := Read(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatal("Expected 2 rows got ", len(rows))
+	}
+	row := rows[1]
+	if row.Symbol != "AADI" || row.Close != 12.03 || row.Volume != 103500 {
+		t.Error("Unexpected row ", row)
+	}
+	if !row.Date.Equal(time.Date(2023, 2, 8, 0, 0, 0, 0, calendar.NewYork)) {
+		t.Error("Unexpected date ", row.Date)
+	}
+	if c := row.Candle(); c.Datetime != uint64(row.Date.UnixMilli()) || c.High != 12.5 {
+		t.Error("Unexpected candle ", c)
+	}
+
+	if _, err := Read(strings.NewReader("Symbol,Date,Close\nA,08-Feb-2023,1\n")); err == nil {
+		t.Error("Expected missing column error")
+	}
+	if _, err := Read(strings.NewReader("Symbol,Date,Open,High,Low,Close,Volume\nA,yesterday,1,1,1,1,1\n")); err == nil {
+		t.Error("Expected bad date error")
+	}
+}
+
+func TestReadRepoData(t *testing.T) {
+	rows, err := ReadFile("../data/NASDAQ_20230208.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 4000 {
+		t.Error("Expected the full NASDAQ file got ", len(rows))
+	}
+}
+
+func TestParseFilename(t *testing.T) {
+	exchange, date, err := ParseFilename("data/nasdaq_20230208.csv")
+	if err != nil || exchange != "NASDAQ" || date.Format("2006-01-02") != "2023-02-08" {
+		t.Error("Unexpected ", exchange, date, err)
+	}
+	if _, _, err := ParseFilename("NASDAQ.csv"); err == nil {
+		t.Error("Expected bad name error")
+	}
+}
@@ -2,14 +2,22 @@ package etl
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNotRecorded is returned when no response was cached for a job
+var ErrNotRecorded = errors.New("no recorded response")
+
 type ApiCallService interface {
 	Cache(etlconfig EtlConfig, doc HttpResponsesDocument) error
+	Get(symbol string, work EtlJob) (*HttpResponsesDocument, error) /* ErrNotRecorded when nothing is cached */
+	List(work EtlJob) ([]HttpResponsesDocument, error)              /* every cached response, all work when empty */
 }
 
 type apiCalls struct {
@@ -28,7 +36,7 @@ type HttpResponsesDocument struct {
 type APIResponse struct {
 	Body   interface{} `json:"body"  bson:"body"`
 	Status int         `json:"status"  bson:"status"`
-	Path string      `json:"path"  bson:"path"`
+	Path   string      `json:"path"  bson:"path"`
 }
 
 func (q *apiCalls) Cache(etlConfig EtlConfig, document HttpResponsesDocument) error {
@@ -41,3 +49,71 @@ func (q *apiCalls) Cache(etlConfig EtlConfig, document HttpResponsesDocument) er
 	}
 	return nil
 }
+
+func (q *apiCalls) Get(symbol string, work EtlJob) (*HttpResponsesDocument, error) {
+	var doc storedResponse
+	err := q.apicalls.FindOne(context.TODO(), bson.M{"symbol": symbol, "work": work}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotRecorded
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.document()
+}
+
+func (q *apiCalls) List(work EtlJob) ([]HttpResponsesDocument, error) {
+	filter := bson.M{}
+	if work != "" {
+		filter["work"] = work
+	}
+	cursor, err := q.apicalls.Find(context.TODO(), filter, options.Find().SetSort(bson.D{{Key: "work", Value: 1}, {Key: "symbol", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+	var docs []HttpResponsesDocument
+	for cursor.Next(context.TODO()) {
+		var stored storedResponse
+		if err := cursor.Decode(&stored); err != nil {
+			return nil, err
+		}
+		doc, err := stored.document()
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *doc)
+	}
+	return docs, cursor.Err()
+}
+
+// storedResponse reads the body raw, the driver would otherwise decode nested
+// documents as bson.D which doesn't marshal back to the json the api sent
+type storedResponse struct {
+	Response struct {
+		Body   bson.RawValue `bson:"body"`
+		Status int           `bson:"status"`
+		Path   string        `bson:"path"`
+	} `bson:"response"`
+	EtlConfig EtlConfig `bson:"etlConfig"`
+}
+
+func (s storedResponse) document() (*HttpResponsesDocument, error) {
+	doc := &HttpResponsesDocument{
+		EtlConfig: s.EtlConfig,
+		Response:  APIResponse{Status: s.Response.Status, Path: s.Response.Path},
+	}
+	if s.Response.Body.Type != bsontype.EmbeddedDocument {
+		return doc, nil
+	}
+	b, err := bson.MarshalExtJSON(s.Response.Body.Document(), false, false)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return nil, err
+	}
+	doc.Response.Body = body
+	return doc, nil
+}
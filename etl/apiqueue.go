@@ -2,6 +2,7 @@ package etl
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
@@ -11,50 +12,61 @@ import (
 )
 
 type ApiQueueService interface {
-	Queue(cursor *mongo.Cursor, workName EtlJob) error
+	Enqueue(symbols []string, workName EtlJob) error /* a job per symbol unless one is queued */
 	Init() error
-	Get() *EtlConfig
-	UpdateStage(etlConfig EtlConfig) error
+	Claim(workerID string, lease time.Duration) (*EtlConfig, error) /* atomically lease the next job, nil when none is available */
+	Heartbeat(etlConfig EtlConfig, lease time.Duration) error       /* extend a held lease */
+	Reclaim() (int64, error)                                        /* release jobs whose lease expired */
+	UpdateStage(etlConfig EtlConfig, lease time.Duration) error
+	Fail(etlConfig EtlConfig, cause error, maxAttempts int) (bool, error) /* release for retry or dead letter */
 	Remove(etlConfig EtlConfig) error
+	Cancel(symbols []string) (int64, error) /* removes the symbols' jobs no worker has claimed */
+	Depth() ([]QueueDepth, error)           /* job counts by work and stage */
 }
 
+type QueueDepth struct {
+	Work  EtlJob   `json:"work" bson:"work"`
+	Stage EtlStage `json:"stage" bson:"stage"`
+	Count int64    `json:"count" bson:"count"`
+}
+
+// ErrLeaseLost is returned when the job is no longer leased by the caller
+var ErrLeaseLost = errors.New("queue lease lost")
+
 type apiQueue struct {
-	apiqueue *mongo.Collection
-	logs     *mongo.Collection
+	apiqueue   *mongo.Collection
+	deadletter *mongo.Collection
+	logs       *mongo.Collection
 }
 
 func NewApiQueue(mg *mongo.Database) ApiQueueService {
-	return &apiQueue{apiqueue: mg.Collection(ApiQueue), logs: mg.Collection(Logs)}
+	return &apiQueue{
+		apiqueue:   mg.Collection(ApiQueue),
+		deadletter: mg.Collection(DeadLetter),
+		logs:       mg.Collection(Logs),
+	}
 }
 
-func (q *apiQueue) Queue(cursor *mongo.Cursor, workName EtlJob) error {
-	var operations []mongo.WriteModel
-	bulkOption := options.BulkWriteOptions{}
-	bulkOption.SetOrdered(false)
-
-	for cursor.Next(context.TODO()) {
-		if len(operations) == 100 {
-			log.Println("BulkWrite: ", len(operations), operations[0], time.Now().Format(time.RFC3339Nano))
-			_, err := q.apiqueue.BulkWrite(context.TODO(), operations, &bulkOption)
-			if err != nil {
-				return err
-			}
-			operations = nil
+func (q *apiQueue) Enqueue(symbols []string, workName EtlJob) error {
+	bulkOption := options.BulkWrite().SetOrdered(false)
+	for len(symbols) > 0 {
+		batch := symbols
+		if len(batch) > 100 {
+			batch = batch[:100]
 		}
-		var result SymbolDoc
-		if err := cursor.Decode(&result); err != nil {
-			return err
+		symbols = symbols[len(batch):]
+
+		// only insert, a job already in the queue may be leased by a running worker
+		operations := make([]mongo.WriteModel, len(batch))
+		for i, symbol := range batch {
+			field := NewEtlConfig(symbol, workName)
+			operations[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"symbol": field.Symbol, "work": field.Work}).
+				SetUpdate(bson.M{"$setOnInsert": field}).
+				SetUpsert(true)
 		}
-		field := NewEtlConfig(result.Symbol, workName)
-
-		operations = append(
-			operations,
-			mongo.NewUpdateOneModel().SetFilter(field).SetUpdate(bson.M{"$set": field}).SetUpsert(true))
-	}
-
-	if len(operations) != 0 {
-		_, err := q.apiqueue.BulkWrite(context.TODO(), operations, &bulkOption)
-		if err != nil {
+		log.Println("BulkWrite: ", len(operations), operations[0], time.Now().Format(time.RFC3339Nano))
+		if _, err := q.apiqueue.BulkWrite(context.TODO(), operations, bulkOption); err != nil {
 			return err
 		}
 	}
@@ -68,34 +80,119 @@ func (q *apiQueue) Queue(cursor *mongo.Cursor, workName EtlJob) error {
 	return nil
 }
 
+// Init sets every doc not held by a live lease back to stage api
 func (q *apiQueue) Init() error {
-	_, err := q.apiqueue.UpdateMany(context.TODO(), bson.D{}, bson.M{"$set": bson.M{"stage": Api}})
+	_, err := q.apiqueue.UpdateMany(context.TODO(),
+		bson.M{"$or": bson.A{
+			bson.M{"leaseExpires": bson.M{"$exists": false}},
+			bson.M{"leaseExpires": bson.M{"$lt": time.Now()}},
+		}},
+		releaseLease())
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (q *apiQueue) Get() *EtlConfig {
+// Claim flips the next available doc to inflight in a single operation so two
+// workers can never receive the same job. Expired leases are available again.
+func (q *apiQueue) Claim(workerID string, lease time.Duration) (*EtlConfig, error) {
+	now := time.Now()
+	expires := now.Add(lease)
 	var etlConfig EtlConfig
-	err := q.apiqueue.FindOne(context.TODO(), bson.M{"stage": Api}).Decode(&etlConfig)
+	err := q.apiqueue.FindOneAndUpdate(context.TODO(),
+		bson.M{"$or": bson.A{
+			bson.M{"stage": Api},
+			bson.M{"stage": bson.M{"$ne": Api}, "leaseExpires": bson.M{"$lt": now}},
+		}},
+		bson.M{
+			"$set": bson.M{"stage": InFlight, "workerId": workerID, "leaseExpires": expires, "lastAttemptAt": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&etlConfig)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	return &etlConfig
+	return &etlConfig, nil
 }
 
-func (q *apiQueue) UpdateStage(etlConfig EtlConfig) error {
-	_, err := q.apiqueue.UpdateOne(context.TODO(),
-		bson.M{"symbol": etlConfig.Symbol, "work": etlConfig.Work},
-		bson.M{"$set": bson.M{"stage": Transform}})
+func (q *apiQueue) Heartbeat(etlConfig EtlConfig, lease time.Duration) error {
+	result, err := q.apiqueue.UpdateOne(context.TODO(),
+		bson.M{"symbol": etlConfig.Symbol, "work": etlConfig.Work, "workerId": etlConfig.WorkerID},
+		bson.M{"$set": bson.M{"leaseExpires": time.Now().Add(lease)}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (q *apiQueue) Reclaim() (int64, error) {
+	result, err := q.apiqueue.UpdateMany(context.TODO(),
+		bson.M{"stage": bson.M{"$ne": Api}, "leaseExpires": bson.M{"$lt": time.Now()}},
+		releaseLease())
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// UpdateStage moves a leased job to transform and renews the lease for the load
+func (q *apiQueue) UpdateStage(etlConfig EtlConfig, lease time.Duration) error {
+	result, err := q.apiqueue.UpdateOne(context.TODO(),
+		bson.M{"symbol": etlConfig.Symbol, "work": etlConfig.Work, "workerId": etlConfig.WorkerID},
+		bson.M{"$set": bson.M{"stage": Transform, "leaseExpires": time.Now().Add(lease)}})
 
 	if err != nil {
 		return err
 	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
 	return nil
 }
 
+// Fail records the error on the job. Permanent errors and jobs out of attempts
+// are moved to the DeadLetter collection, anything else goes back to stage api.
+// Returns true when the job was dead lettered, ErrLeaseLost when another
+// worker has claimed it since.
+func (q *apiQueue) Fail(etlConfig EtlConfig, cause error, maxAttempts int) (bool, error) {
+	etlConfig.LastError = cause.Error()
+	held := bson.M{"symbol": etlConfig.Symbol, "work": etlConfig.Work, "workerId": etlConfig.WorkerID}
+	if !IsPermanent(cause) && etlConfig.Attempts < maxAttempts {
+		update := releaseLease()
+		update["$set"].(bson.M)["lastError"] = etlConfig.LastError
+		result, err := q.apiqueue.UpdateOne(context.TODO(), held, update)
+		if err != nil {
+			return false, err
+		}
+		if result.MatchedCount == 0 {
+			return false, ErrLeaseLost
+		}
+		return false, nil
+	}
+
+	// delete while the lease is held so a reclaimed job is never dead lettered
+	result, err := q.apiqueue.DeleteOne(context.TODO(), held)
+	if err != nil {
+		return false, err
+	}
+	if result.DeletedCount == 0 {
+		return false, ErrLeaseLost
+	}
+	_, err = q.deadletter.InsertOne(context.TODO(), NewDeadLetterDocument(etlConfig))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (q *apiQueue) Remove(etlConfig EtlConfig) error {
 	_, err := q.apiqueue.DeleteOne(
 		context.TODO(),
@@ -105,3 +202,32 @@ func (q *apiQueue) Remove(etlConfig EtlConfig) error {
 	}
 	return nil
 }
+
+func (q *apiQueue) Cancel(symbols []string) (int64, error) {
+	result, err := q.apiqueue.DeleteMany(context.TODO(), bson.M{"symbol": bson.M{"$in": symbols}, "stage": Api})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (q *apiQueue) Depth() ([]QueueDepth, error) {
+	cursor, err := q.apiqueue.Aggregate(context.TODO(), bson.A{
+		bson.M{"$group": bson.M{"_id": bson.M{"work": "$work", "stage": "$stage"}, "count": bson.M{"$sum": 1}}},
+		bson.M{"$project": bson.M{"_id": 0, "work": "$_id.work", "stage": "$_id.stage", "count": 1}},
+		bson.M{"$sort": bson.M{"work": 1, "stage": 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var depth []QueueDepth
+	err = cursor.All(context.TODO(), &depth)
+	return depth, err
+}
+
+func releaseLease() bson.M {
+	return bson.M{
+		"$set":   bson.M{"stage": Api},
+		"$unset": bson.M{"workerId": "", "leaseExpires": ""},
+	}
+}
@@ -0,0 +1,784 @@
+package etl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrStoreLocked is returned when another process has the bolt file open
+var ErrStoreLocked = errors.New("bolt file is locked by another process")
+
+// NewBoltStore keeps the pipeline in a single bbolt file at path, for boards
+// that can't run a database server. Documents are stored as bson so they keep
+// the shape they have in Mongo. bbolt locks the file, so only one process can
+// open it and rate limits don't need to be shared.
+func NewBoltStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %s, stop the process using it or run the pipeline in cmd/scheduler", ErrStoreLocked, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{ApiQueue, DeadLetter, Quarantine, APICalls, Macros, Medium, Short, Signals, Candles, Logs} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{
+		ApiQueue:     &boltQueue{db: db},
+		DeadLetters:  &boltDeadLetters{db: db},
+		Quarantined:  &boltQuarantine{db: db},
+		ApiCalls:     &boltApiCalls{db: db},
+		Fundamentals: &boltFundamentals{boltDocuments{db: db, bucket: Macros}},
+		Snapshots:    &boltSnapshots{db: db},
+		Candles:      &boltCandles{db: db},
+		Logs:         &boltLogs{db: db},
+		RateLimiter: func(key string, perMinute int) RateLimiter {
+			return NewTokenBucket(perMinute)
+		},
+		Documents: func(collection string) DocumentStore {
+			return &boltDocuments{db: db, bucket: collection}
+		},
+	}, nil
+}
+
+func put(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// putNext stores v under the bucket's next sequence, so keys sort by insertion
+func putNext(b *bolt.Bucket, v interface{}) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	return put(b, itob(seq), v)
+}
+
+func itob(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key
+}
+
+type boltQueue struct {
+	db *bolt.DB
+}
+
+func (q *boltQueue) Enqueue(symbols []string, workName EtlJob) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		for _, symbol := range symbols {
+			if err := enqueue(tx, symbol, workName); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// enqueue adds a job unless one is queued for the symbol and work already
+func enqueue(tx *bolt.Tx, symbol string, work EtlJob) error {
+	b := tx.Bucket([]byte(ApiQueue))
+	key := []byte(jobKey(symbol, work))
+	if b.Get(key) != nil {
+		return nil
+	}
+	return put(b, key, NewEtlConfig(symbol, work))
+}
+
+// update rewrites every job for which fn returns true
+func (q *boltQueue) update(fn func(job *EtlConfig) bool) (int64, error) {
+	var n int64
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ApiQueue))
+		changed := map[string]EtlConfig{}
+		err := b.ForEach(func(k, v []byte) error {
+			var job EtlConfig
+			if err := bson.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if fn(&job) {
+				changed[string(k)] = job
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, job := range changed {
+			if err := put(b, []byte(k), job); err != nil {
+				return err
+			}
+		}
+		n = int64(len(changed))
+		return nil
+	})
+	return n, err
+}
+
+func (q *boltQueue) Init() error {
+	now := time.Now()
+	_, err := q.update(func(job *EtlConfig) bool {
+		if job.LeaseExpires != nil && !job.LeaseExpires.Before(now) {
+			return false
+		}
+		release(job)
+		return true
+	})
+	return err
+}
+
+func (q *boltQueue) Claim(workerID string, lease time.Duration) (*EtlConfig, error) {
+	var claimed *EtlConfig
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ApiQueue))
+		now := time.Now()
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var job EtlConfig
+			if err := bson.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if job.Stage != Api && (job.LeaseExpires == nil || !job.LeaseExpires.Before(now)) {
+				continue
+			}
+			expires := now.Add(lease)
+			attempt := now
+			job.Stage = InFlight
+			job.WorkerID = workerID
+			job.LeaseExpires = &expires
+			job.LastAttemptAt = &attempt
+			job.Attempts++
+			claimed = &job
+			return put(b, k, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// heldJob reads the job if etlConfig's worker still holds it
+func heldJob(b *bolt.Bucket, etlConfig EtlConfig) ([]byte, *EtlConfig, error) {
+	key := []byte(jobKey(etlConfig.Symbol, etlConfig.Work))
+	v := b.Get(key)
+	if v == nil {
+		return nil, nil, ErrLeaseLost
+	}
+	var job EtlConfig
+	if err := bson.Unmarshal(v, &job); err != nil {
+		return nil, nil, err
+	}
+	if job.WorkerID != etlConfig.WorkerID {
+		return nil, nil, ErrLeaseLost
+	}
+	return key, &job, nil
+}
+
+// held updates the job if etlConfig's worker still holds it
+func (q *boltQueue) held(etlConfig EtlConfig, fn func(job *EtlConfig)) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ApiQueue))
+		key, job, err := heldJob(b, etlConfig)
+		if err != nil {
+			return err
+		}
+		fn(job)
+		return put(b, key, *job)
+	})
+}
+
+func (q *boltQueue) Heartbeat(etlConfig EtlConfig, lease time.Duration) error {
+	return q.held(etlConfig, func(job *EtlConfig) {
+		expires := time.Now().Add(lease)
+		job.LeaseExpires = &expires
+	})
+}
+
+func (q *boltQueue) Reclaim() (int64, error) {
+	now := time.Now()
+	return q.update(func(job *EtlConfig) bool {
+		if job.Stage == Api || job.LeaseExpires == nil || !job.LeaseExpires.Before(now) {
+			return false
+		}
+		release(job)
+		return true
+	})
+}
+
+func (q *boltQueue) UpdateStage(etlConfig EtlConfig, lease time.Duration) error {
+	return q.held(etlConfig, func(job *EtlConfig) {
+		expires := time.Now().Add(lease)
+		job.Stage = Transform
+		job.LeaseExpires = &expires
+	})
+}
+
+func (q *boltQueue) Fail(etlConfig EtlConfig, cause error, maxAttempts int) (bool, error) {
+	etlConfig.LastError = cause.Error()
+	if !IsPermanent(cause) && etlConfig.Attempts < maxAttempts {
+		err := q.held(etlConfig, func(job *EtlConfig) {
+			job.LastError = etlConfig.LastError
+			release(job)
+		})
+		return false, err
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ApiQueue))
+		key, _, err := heldJob(b, etlConfig)
+		if err != nil {
+			return err
+		}
+		if err := putNext(tx.Bucket([]byte(DeadLetter)), NewDeadLetterDocument(etlConfig)); err != nil {
+			return err
+		}
+		return b.Delete(key)
+	})
+	return err == nil, err
+}
+
+func (q *boltQueue) Remove(etlConfig EtlConfig) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ApiQueue)).Delete([]byte(jobKey(etlConfig.Symbol, etlConfig.Work)))
+	})
+}
+
+func (q *boltQueue) Cancel(symbols []string) (int64, error) {
+	var n int64
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ApiQueue))
+		for _, symbol := range symbols {
+			for _, work := range []EtlJob{Macros, Medium, Short, Signals} {
+				key := []byte(jobKey(symbol, work))
+				v := b.Get(key)
+				if v == nil {
+					continue
+				}
+				var job EtlConfig
+				if err := bson.Unmarshal(v, &job); err != nil {
+					return err
+				}
+				if job.Stage != Api {
+					continue
+				}
+				if err := b.Delete(key); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (q *boltQueue) Depth() ([]QueueDepth, error) {
+	counts := make(map[QueueDepth]int64)
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ApiQueue)).ForEach(func(k, v []byte) error {
+			var job EtlConfig
+			if err := bson.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			counts[QueueDepth{Work: job.Work, Stage: job.Stage}]++
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return depthOf(counts), nil
+}
+
+// newest walks bucket from the last key, stopping after limit docs matched
+// when limit is positive
+func newest(db *bolt.DB, bucket string, limit int64, decode func(v []byte) (bool, error)) error {
+	return db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		var n int64
+		for k, v := c.Last(); k != nil && (limit <= 0 || n < limit); k, v = c.Prev() {
+			matched, err := decode(v)
+			if err != nil {
+				return err
+			}
+			if matched {
+				n++
+			}
+		}
+		return nil
+	})
+}
+
+// take deletes the docs in bucket matching filter, requeueing their jobs when asked
+func take(db *bolt.DB, bucket string, filter JobFilter, requeue bool) (int64, error) {
+	var n int64
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var doc struct {
+				Symbol string `bson:"symbol"`
+				Work   EtlJob `bson:"work"`
+			}
+			if err := bson.Unmarshal(v, &doc); err != nil {
+				return err
+			}
+			if !filter.match(doc.Symbol, doc.Work) {
+				return nil
+			}
+			keys = append(keys, bytes.Clone(k))
+			if requeue {
+				return enqueue(tx, doc.Symbol, doc.Work)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = int64(len(keys))
+		return nil
+	})
+	return n, err
+}
+
+type boltDeadLetters struct {
+	db *bolt.DB
+}
+
+func (d *boltDeadLetters) List(filter JobFilter, limit int64) ([]DeadLetterDocument, error) {
+	docs := []DeadLetterDocument{}
+	err := newest(d.db, DeadLetter, limit, func(v []byte) (bool, error) {
+		var doc DeadLetterDocument
+		if err := bson.Unmarshal(v, &doc); err != nil {
+			return false, err
+		}
+		if !filter.match(doc.Symbol, doc.Work) {
+			return false, nil
+		}
+		docs = append(docs, doc)
+		return true, nil
+	})
+	return docs, err
+}
+
+func (d *boltDeadLetters) Requeue(filter JobFilter) (int64, error) {
+	return take(d.db, DeadLetter, filter, true)
+}
+
+func (d *boltDeadLetters) Purge(filter JobFilter) (int64, error) {
+	return take(d.db, DeadLetter, filter, false)
+}
+
+type boltQuarantine struct {
+	db *bolt.DB
+}
+
+func (q *boltQuarantine) Add(etlConfig EtlConfig, body interface{}, cause error) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return putNext(tx.Bucket([]byte(Quarantine)), QuarantineDocument{
+			Symbol:        etlConfig.Symbol,
+			Work:          etlConfig.Work,
+			Reason:        cause.Error(),
+			Body:          body,
+			QuarantinedAt: time.Now(),
+		})
+	})
+}
+
+func (q *boltQuarantine) List(filter JobFilter, limit int64) ([]QuarantineDocument, error) {
+	docs := []QuarantineDocument{}
+	err := newest(q.db, Quarantine, limit, func(v []byte) (bool, error) {
+		var doc QuarantineDocument
+		if err := bson.Unmarshal(v, &doc); err != nil {
+			return false, err
+		}
+		if !filter.match(doc.Symbol, doc.Work) {
+			return false, nil
+		}
+		docs = append(docs, doc)
+		return true, nil
+	})
+	return docs, err
+}
+
+func (q *boltQuarantine) Requeue(filter JobFilter) (int64, error) {
+	return take(q.db, Quarantine, filter, true)
+}
+
+func (q *boltQuarantine) Purge(filter JobFilter) (int64, error) {
+	return take(q.db, Quarantine, filter, false)
+}
+
+type boltApiCalls struct {
+	db *bolt.DB
+}
+
+func (a *boltApiCalls) Cache(etlConfig EtlConfig, doc HttpResponsesDocument) error {
+	return a.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket([]byte(APICalls)), []byte(jobKey(etlConfig.Symbol, etlConfig.Work)), doc)
+	})
+}
+
+func (a *boltApiCalls) Get(symbol string, work EtlJob) (*HttpResponsesDocument, error) {
+	var stored *storedResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(APICalls)).Get([]byte(jobKey(symbol, work)))
+		if v == nil {
+			return ErrNotRecorded
+		}
+		stored = &storedResponse{}
+		return bson.Unmarshal(v, stored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored.document()
+}
+
+func (a *boltApiCalls) List(work EtlJob) ([]HttpResponsesDocument, error) {
+	var docs []HttpResponsesDocument
+	err := a.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(APICalls)).Cursor()
+		var prefix []byte
+		if work != "" {
+			prefix = []byte(jobKey("", work))
+		}
+		// keys are work/symbol, so the cursor is already sorted like the Mongo List
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var stored storedResponse
+			if err := bson.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+			doc, err := stored.document()
+			if err != nil {
+				return err
+			}
+			docs = append(docs, *doc)
+		}
+		return nil
+	})
+	return docs, err
+}
+
+// boltDocuments is a bucket of documents, created on the first write
+type boltDocuments struct {
+	db     *bolt.DB
+	bucket string
+}
+
+// all decodes every document in key order
+func (d *boltDocuments) all() ([]bson.M, error) {
+	var docs []bson.M
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(d.bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var doc bson.M
+			if err := bson.Unmarshal(v, &doc); err != nil {
+				return err
+			}
+			docs = append(docs, doc)
+			return nil
+		})
+	})
+	return docs, err
+}
+
+func (d *boltDocuments) Find(query Query, docs interface{}) error {
+	all, err := d.all()
+	if err != nil {
+		return err
+	}
+	return find(all, query, docs)
+}
+
+func (d *boltDocuments) Count(filters ...Filter) (int64, error) {
+	all, err := d.all()
+	if err != nil {
+		return 0, err
+	}
+	return count(all, filters), nil
+}
+
+func (d *boltDocuments) Insert(docs ...interface{}) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(d.bucket))
+		if err != nil {
+			return err
+		}
+		for _, v := range docs {
+			doc, err := toDocument(v)
+			if err != nil {
+				return err
+			}
+			if _, ok := doc["_id"]; !ok {
+				doc["_id"] = primitive.NewObjectID()
+			}
+			if err := putNext(b, doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *boltDocuments) Replace(id string, v interface{}) error {
+	doc, err := toDocument(v)
+	if err != nil {
+		return err
+	}
+	doc["_id"] = id
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(d.bucket))
+		if err != nil {
+			return err
+		}
+		return put(b, []byte(id), doc)
+	})
+}
+
+// boltFundamentals keys the Macros documents by symbol
+type boltFundamentals struct {
+	boltDocuments
+}
+
+func (f *boltFundamentals) Upsert(symbol string, instrument *Instrument) error {
+	fields, err := toDocument(instrument)
+	if err != nil {
+		return err
+	}
+	return f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(Macros))
+		doc := bson.M{"symbol": symbol}
+		if v := b.Get([]byte(symbol)); v != nil {
+			if err := bson.Unmarshal(v, &doc); err != nil {
+				return err
+			}
+		}
+		for key, v := range fields {
+			doc[key] = v
+		}
+		return put(b, []byte(symbol), doc)
+	})
+}
+
+func (f *boltFundamentals) SetMarketCap(symbol string, marketCap float64) error {
+	return f.Update(map[string]FieldUpdate{symbol: {Set: bson.M{"marketCap": marketCap}, Upsert: true}})
+}
+
+func (f *boltFundamentals) Get(symbol string) (*Instrument, error) {
+	var instrument *Instrument
+	err := f.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(Macros)).Get([]byte(symbol))
+		if v == nil {
+			return nil
+		}
+		instrument = &Instrument{}
+		return bson.Unmarshal(v, instrument)
+	})
+	return instrument, err
+}
+
+func (f *boltFundamentals) Update(updates map[string]FieldUpdate) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(Macros))
+		for symbol, u := range updates {
+			v := b.Get([]byte(symbol))
+			if v == nil && !u.Upsert {
+				continue
+			}
+			doc := bson.M{"symbol": symbol}
+			if v != nil {
+				if err := bson.Unmarshal(v, &doc); err != nil {
+					return err
+				}
+				if !(Query{Filters: u.Where}).matches(doc) {
+					continue
+				}
+			}
+			u.apply(doc, v == nil)
+			if err := put(b, []byte(symbol), doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type boltSnapshots struct {
+	db *bolt.DB
+}
+
+func snapshotBucket(tx *bolt.Tx, work EtlJob) (*bolt.Bucket, error) {
+	switch work {
+	case Medium, Short, Signals:
+		return tx.Bucket([]byte(work)), nil
+	}
+	return nil, errors.New("no snapshots for work: " + string(work))
+}
+
+func (s *boltSnapshots) Save(work EtlJob, ph *PriceHistory) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := snapshotBucket(tx, work)
+		if err != nil {
+			return err
+		}
+		return put(b, []byte(ph.Symbol), ph)
+	})
+}
+
+func (s *boltSnapshots) Get(work EtlJob, symbol string) (*PriceHistory, error) {
+	var ph *PriceHistory
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := snapshotBucket(tx, work)
+		if err != nil {
+			return err
+		}
+		v := b.Get([]byte(symbol))
+		if v == nil {
+			return nil
+		}
+		ph = &PriceHistory{}
+		return bson.Unmarshal(v, ph)
+	})
+	return ph, err
+}
+
+func (s *boltSnapshots) List(work EtlJob) ([]PriceHistory, error) {
+	var docs []PriceHistory
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := snapshotBucket(tx, work)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var ph PriceHistory
+			if err := bson.Unmarshal(v, &ph); err != nil {
+				return err
+			}
+			docs = append(docs, ph)
+			return nil
+		})
+	})
+	return docs, err
+}
+
+// boltCandles nests a bucket per symbol and timeframe under Candles, keyed by
+// the big endian datetime so cursors walk the series in time order
+type boltCandles struct {
+	db *bolt.DB
+}
+
+func seriesKey(symbol string, timeframe Timeframe) []byte {
+	return []byte(symbol + "/" + string(timeframe))
+}
+
+func (c *boltCandles) Upsert(symbol string, timeframe Timeframe, candles []Candle) error {
+	return c.UpsertMany(timeframe, map[string][]Candle{symbol: candles})
+}
+
+func (c *boltCandles) UpsertMany(timeframe Timeframe, series map[string][]Candle) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		for symbol, candles := range series {
+			b, err := tx.Bucket([]byte(Candles)).CreateBucketIfNotExists(seriesKey(symbol, timeframe))
+			if err != nil {
+				return err
+			}
+			for _, candle := range candles {
+				if err := put(b, itob(candle.Datetime), candle); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (c *boltCandles) Range(symbol string, timeframe Timeframe, from time.Time, to time.Time) ([]Candle, error) {
+	candles := []Candle{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(Candles)).Bucket(seriesKey(symbol, timeframe))
+		if b == nil {
+			return nil
+		}
+		cursor := b.Cursor()
+		end := itob(uint64(to.UnixMilli()))
+		for k, v := cursor.Seek(itob(uint64(from.UnixMilli()))); k != nil && bytes.Compare(k, end) < 0; k, v = cursor.Next() {
+			var candle Candle
+			if err := bson.Unmarshal(v, &candle); err != nil {
+				return err
+			}
+			candles = append(candles, candle)
+		}
+		return nil
+	})
+	return candles, err
+}
+
+func (c *boltCandles) Last(symbol string, timeframe Timeframe) (*Candle, error) {
+	var last *Candle
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(Candles)).Bucket(seriesKey(symbol, timeframe))
+		if b == nil {
+			return nil
+		}
+		k, v := b.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		last = &Candle{}
+		return bson.Unmarshal(v, last)
+	})
+	return last, err
+}
+
+type boltLogs struct {
+	db *bolt.DB
+}
+
+func (l *boltLogs) Insert(category string, msg string) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		return putNext(tx.Bucket([]byte(Logs)), LogDocument{Category: category, Msg: msg, At: time.Now()})
+	})
+}
+
+func (l *boltLogs) List(limit int64) ([]LogDocument, error) {
+	docs := []LogDocument{}
+	err := newest(l.db, Logs, limit, func(v []byte) (bool, error) {
+		var doc LogDocument
+		if err := bson.Unmarshal(v, &doc); err != nil {
+			return false, err
+		}
+		docs = append(docs, doc)
+		return true, nil
+	})
+	return docs, err
+}
@@ -0,0 +1,125 @@
+package etl
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Timeframe is the bar size of a candle series
+type Timeframe string
+
+const (
+	Minute15 Timeframe = "15m"
+	Minute30 Timeframe = "30m"
+	Daily    Timeframe = "1d"
+)
+
+/* never fetched, built from stored bars by the resample package */
+const (
+	Hour1  Timeframe = "1h"
+	Hour4  Timeframe = "4h"
+	Weekly Timeframe = "1w"
+)
+
+// JobTimeframe is the bar size each price history job fetches
+func JobTimeframe(work EtlJob) Timeframe {
+	switch work {
+	case Medium:
+		return Minute30
+	case Short, Signals:
+		return Minute15
+	}
+	return ""
+}
+
+// CandleStore keeps every bar ever fetched, one document per
+// (symbol, timeframe, datetime), unlike the Medium/Short/Signals snapshots
+type CandleStore interface {
+	Upsert(symbol string, timeframe Timeframe, candles []Candle) error
+	UpsertMany(timeframe Timeframe, series map[string][]Candle) error                         /* candles by symbol in one bulk write, for imports */
+	Range(symbol string, timeframe Timeframe, from time.Time, to time.Time) ([]Candle, error) /* from inclusive, to exclusive */
+	Last(symbol string, timeframe Timeframe) (*Candle, error)                                 /* nil when nothing is stored */
+}
+
+type candleStore struct {
+	candles *mongo.Collection
+}
+
+func NewCandleStore(mg *mongo.Database) CandleStore {
+	return &candleStore{candles: mg.Collection(Candles)}
+}
+
+type CandleDocument struct {
+	Symbol    string    `json:"symbol" bson:"symbol"`
+	Timeframe Timeframe `json:"timeframe" bson:"timeframe"`
+	Candle    `bson:",inline"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Upsert merges candles into the series. Bars already stored are overwritten so
+// an overlapping fetch replaces a partial bar with its final values.
+func (s *candleStore) Upsert(symbol string, timeframe Timeframe, candles []Candle) error {
+	return s.UpsertMany(timeframe, map[string][]Candle{symbol: candles})
+}
+
+func (s *candleStore) UpsertMany(timeframe Timeframe, series map[string][]Candle) error {
+	now := time.Now()
+	var operations []mongo.WriteModel
+	for symbol, candles := range series {
+		for _, candle := range candles {
+			doc := CandleDocument{Symbol: symbol, Timeframe: timeframe, Candle: candle, UpdatedAt: now}
+			operations = append(operations, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"symbol": symbol, "timeframe": timeframe, "datetime": candle.Datetime}).
+				SetUpdate(bson.M{"$set": doc}).
+				SetUpsert(true))
+		}
+	}
+	if len(operations) == 0 {
+		return nil
+	}
+	_, err := s.candles.BulkWrite(context.TODO(), operations, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *candleStore) Range(symbol string, timeframe Timeframe, from time.Time, to time.Time) ([]Candle, error) {
+	cursor, err := s.candles.Find(context.TODO(),
+		bson.M{
+			"symbol":    symbol,
+			"timeframe": timeframe,
+			"datetime":  bson.M{"$gte": from.UnixMilli(), "$lt": to.UnixMilli()},
+		},
+		options.Find().SetSort(bson.M{"datetime": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []CandleDocument
+	if err := cursor.All(context.TODO(), &docs); err != nil {
+		return nil, err
+	}
+	candles := make([]Candle, len(docs))
+	for i, doc := range docs {
+		candles[i] = doc.Candle
+	}
+	return candles, nil
+}
+
+func (s *candleStore) Last(symbol string, timeframe Timeframe) (*Candle, error) {
+	var doc CandleDocument
+	err := s.candles.FindOne(context.TODO(),
+		bson.M{"symbol": symbol, "timeframe": timeframe},
+		options.FindOne().SetSort(bson.M{"datetime": -1})).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc.Candle, nil
+}
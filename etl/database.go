@@ -3,24 +3,91 @@ package etl
 import (
 	"context"
 	"log"
+	"os"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/jaredtokuz/market-trader/events"
+	"github.com/jaredtokuz/market-trader/migrate"
 )
 
 type MongoController struct {
-	database *mongo.Database
-	Macros   *mongo.Collection /* high level metrics data */
-	Medium   *mongo.Collection /* 15 days 30 minutes longer trends */
-	Short    *mongo.Collection /* 2 days 15 minutes 56 bars algo... analysis backtesting */
-	Signals  *mongo.Collection /* realtime dataset for a trader minimal, calc trade conditions, based on medium and short research */
-	ApiQueue ApiQueueService   /* Entry for the database queue for background */
-	ApiCalls ApiCallService    /* Logs of TD Ameritrade Responses */
-	Logs     *mongo.Collection /* Generic logs */
+	database    *mongo.Database
+	Macros      *mongo.Collection /* high level metrics data */
+	Medium      *mongo.Collection /* 10 sessions 30 minutes longer trends */
+	Short       *mongo.Collection /* 2 sessions 15 minutes algo... analysis backtesting */
+	Signals     *mongo.Collection /* realtime dataset for a trader minimal, calc trade conditions, based on medium and short research */
+	Candles     CandleStore       /* every bar fetched by Medium/Short/Signals, append only */
+	ApiQueue    ApiQueueService   /* Entry for the database queue for background */
+	DeadLetters DeadLetterService /* Jobs that failed too many times */
+	Quarantined QuarantineService /* Payloads the transforms rejected */
+	ApiCalls    ApiCallService    /* Logs of TD Ameritrade Responses */
+	Logs        *mongo.Collection /* Generic logs */
+	Events      events.Publisher  /* signal changes and loaded candles for api subscribers */
+	store       *Store
 }
 
 func NewMongoController(mongoURI string, database_name string) (*MongoController, error) {
+	db, err := Connect(mongoURI, database_name)
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		migrator, err := migrate.NewMigrator(db, Migrations)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := migrator.Up(0); err != nil {
+			return nil, err
+		}
+	}
+	log.Println("MongoController ready")
+	mg := &MongoController{
+		database:    db,
+		Macros:      db.Collection(Macros),
+		Medium:      db.Collection(Medium),
+		Short:       db.Collection(Short),
+		Signals:     db.Collection(Signals),
+		Candles:     NewCandleStore(db),
+		ApiQueue:    NewApiQueue(db),
+		DeadLetters: NewDeadLetterService(db),
+		Quarantined: NewQuarantineService(db),
+		ApiCalls:    NewApiCallService(db),
+		Logs:        db.Collection(Logs),
+		Events:      events.NewMongoPublisher(db),
+	}
+	mg.store = &Store{
+		ApiQueue:     mg.ApiQueue,
+		DeadLetters:  mg.DeadLetters,
+		Quarantined:  mg.Quarantined,
+		ApiCalls:     mg.ApiCalls,
+		Fundamentals: NewFundamentalStore(db),
+		Snapshots:    NewSnapshotStore(db),
+		Candles:      mg.Candles,
+		Logs:         NewLogStore(db),
+		Events:       mg.Events,
+		RateLimiter: func(key string, perMinute int) RateLimiter {
+			return NewRateLimiter(db, key, perMinute)
+		},
+		Documents: func(collection string) DocumentStore {
+			return NewDocumentStore(db, collection)
+		},
+		TailEvents: func(ctx context.Context, bus events.Publisher) {
+			events.Tail(ctx, db, bus)
+		},
+	}
+	return mg, nil
+}
+
+// Store is the etl pipeline's view of the database
+func (m *MongoController) Store() *Store {
+	return m.store
+}
+
+// Connect pings the database without applying migrations, for cmd/migrate
+func Connect(mongoURI string, database_name string) (*mongo.Database, error) {
 	log.Println("Database connecting to ", mongoURI)
 	client, err := mongo.NewClient(options.Client().ApplyURI(mongoURI))
 	if err != nil {
@@ -40,15 +107,10 @@ func NewMongoController(mongoURI string, database_name string) (*MongoController
 		log.Fatal("Database failed to ping ", err)
 		return nil, err
 	}
-	log.Println("MongoController ready")
-	return &MongoController{
-		database: db,
-		Macros:   db.Collection(Macros),
-		Medium:   db.Collection(Medium),
-		Short:    db.Collection(Short),
-		Signals:  db.Collection(Signals),
-		ApiQueue: NewApiQueue(db),
-		ApiCalls: NewApiCallService(db),
-		Logs:     db.Collection(Logs),
-	}, nil
+	return db, nil
+}
+
+// Database is the underlying database for collections owned outside the etl package
+func (m *MongoController) Database() *mongo.Database {
+	return m.database
 }
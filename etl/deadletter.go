@@ -0,0 +1,130 @@
+package etl
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DeadLetterService interface {
+	List(filter JobFilter, limit int64) ([]DeadLetterDocument, error)
+	Requeue(filter JobFilter) (int64, error) /* back to the api queue with attempts reset */
+	Purge(filter JobFilter) (int64, error)
+}
+
+type deadLetters struct {
+	parkedJobs
+}
+
+func NewDeadLetterService(mg *mongo.Database) DeadLetterService {
+	return &deadLetters{newParkedJobs(mg, DeadLetter, "deadAt")}
+}
+
+type DeadLetterDocument struct {
+	ID        *primitive.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
+	Symbol    string              `json:"symbol"  bson:"symbol"`
+	Work      EtlJob              `json:"work"  bson:"work"`
+	EtlConfig EtlConfig           `json:"etlConfig"  bson:"etlConfig"`
+	DeadAt    time.Time           `json:"deadAt"  bson:"deadAt"`
+}
+
+func NewDeadLetterDocument(etlConfig EtlConfig) DeadLetterDocument {
+	etlConfig.ID = nil
+	etlConfig.WorkerID = ""
+	etlConfig.LeaseExpires = nil
+	return DeadLetterDocument{
+		Symbol:    etlConfig.Symbol,
+		Work:      etlConfig.Work,
+		EtlConfig: etlConfig,
+		DeadAt:    time.Now(),
+	}
+}
+
+// JobFilter narrows an operation on dead letters or quarantined payloads,
+// empty fields match everything
+type JobFilter struct {
+	Symbol string
+	Work   EtlJob
+}
+
+func (f JobFilter) bson() bson.M {
+	filter := bson.M{}
+	if f.Symbol != "" {
+		filter["symbol"] = f.Symbol
+	}
+	if f.Work != "" {
+		filter["work"] = f.Work
+	}
+	return filter
+}
+
+func (d *deadLetters) List(filter JobFilter, limit int64) ([]DeadLetterDocument, error) {
+	var docs []DeadLetterDocument
+	err := d.list(filter, limit, &docs)
+	return docs, err
+}
+
+// parkedJobs is a collection of jobs taken off the api queue, DeadLetter or
+// Quarantine, with symbol and work fields to filter and requeue by
+type parkedJobs struct {
+	parked   *mongo.Collection
+	apiqueue *mongo.Collection
+	sortKey  string /* date field listed newest first */
+}
+
+func newParkedJobs(mg *mongo.Database, collection string, sortKey string) parkedJobs {
+	return parkedJobs{parked: mg.Collection(collection), apiqueue: mg.Collection(ApiQueue), sortKey: sortKey}
+}
+
+func (p parkedJobs) list(filter JobFilter, limit int64, docs interface{}) error {
+	cursor, err := p.parked.Find(context.TODO(), filter.bson(),
+		options.Find().SetSort(bson.M{p.sortKey: -1}).SetLimit(limit))
+	if err != nil {
+		return err
+	}
+	return cursor.All(context.TODO(), docs)
+}
+
+// Requeue queues a fresh job for every matching doc and deletes it
+func (p parkedJobs) Requeue(filter JobFilter) (int64, error) {
+	cursor, err := p.parked.Find(context.TODO(), filter.bson())
+	if err != nil {
+		return 0, err
+	}
+	var requeued int64
+	for cursor.Next(context.TODO()) {
+		var doc struct {
+			ID     primitive.ObjectID `bson:"_id"`
+			Symbol string             `bson:"symbol"`
+			Work   EtlJob             `bson:"work"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return requeued, err
+		}
+		field := NewEtlConfig(doc.Symbol, doc.Work)
+		_, err := p.apiqueue.UpdateOne(context.TODO(),
+			bson.M{"symbol": field.Symbol, "work": field.Work},
+			bson.M{"$setOnInsert": field},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return requeued, err
+		}
+		if _, err := p.parked.DeleteOne(context.TODO(), bson.M{"_id": doc.ID}); err != nil {
+			return requeued, err
+		}
+		requeued++
+	}
+	return requeued, cursor.Err()
+}
+
+func (p parkedJobs) Purge(filter JobFilter) (int64, error) {
+	result, err := p.parked.DeleteMany(context.TODO(), filter.bson())
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,266 @@
+package etl
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The memory and bolt backends keep documents as bson.M and answer queries
+// here, matching what Mongo does for the operators a Filter allows.
+
+// toDocument round trips v through bson so it has the types a stored document has
+func toDocument(v interface{}) (bson.M, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	return doc, bson.Unmarshal(data, &doc)
+}
+
+// normalize converts a Go value the way toDocument converts a field
+func normalize(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	doc, err := toDocument(bson.M{"v": v})
+	if err != nil {
+		return v
+	}
+	return doc["v"]
+}
+
+func lookup(doc bson.M, path string) (interface{}, bool) {
+	var v interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(bson.M)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func setPath(doc bson.M, path string, v interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key].(bson.M)
+		if !ok {
+			next = bson.M{}
+			doc[key] = next
+		}
+		doc = next
+	}
+	doc[keys[len(keys)-1]] = normalize(v)
+}
+
+func unsetPath(doc bson.M, path string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key].(bson.M)
+		if !ok {
+			return
+		}
+		doc = next
+	}
+	delete(doc, keys[len(keys)-1])
+}
+
+// apply changes doc like a Mongo update, inserted is true for a new document
+func (u FieldUpdate) apply(doc bson.M, inserted bool) {
+	for path, v := range u.Set {
+		setPath(doc, path, v)
+	}
+	for _, path := range u.Unset {
+		unsetPath(doc, path)
+	}
+	if inserted {
+		for path, v := range u.SetOnInsert {
+			setPath(doc, path, v)
+		}
+	}
+}
+
+/* bson type order, what Mongo sorts mixed fields by */
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case float64, int32, int64:
+		return 1
+	case string:
+		return 2
+	case bson.M:
+		return 3
+	case primitive.A:
+		return 4
+	case primitive.ObjectID:
+		return 5
+	case bool:
+		return 6
+	case primitive.DateTime:
+		return 7
+	}
+	return 8
+}
+
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// compare orders normalized values, ok is false when their types don't compare
+func compare(a, b interface{}) (c int, ok bool) {
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return ra - rb, false
+	}
+	switch a := a.(type) {
+	case nil:
+		return 0, true
+	case float64, int32, int64:
+		x, y := number(a), number(b)
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		return strings.Compare(a, b.(string)), true
+	case primitive.ObjectID:
+		id := b.(primitive.ObjectID)
+		return bytes.Compare(a[:], id[:]), true
+	case bool:
+		if a == b.(bool) {
+			return 0, true
+		}
+		if a {
+			return 1, true
+		}
+		return -1, true
+	case primitive.DateTime:
+		return compare(int64(a), int64(b.(primitive.DateTime)))
+	}
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	c, ok := compare(a, b)
+	return ok && c == 0
+}
+
+func contains(list interface{}, v interface{}) bool {
+	values, _ := list.(primitive.A)
+	for _, value := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Filter) matches(doc bson.M) bool {
+	v, found := lookup(doc, f.Field)
+	value := normalize(f.Value)
+	switch f.Op {
+	case "exists":
+		want, _ := value.(bool)
+		return found == want
+	case "eq":
+		return equal(v, value)
+	case "ne":
+		return !equal(v, value)
+	case "in":
+		return contains(value, v)
+	case "nin":
+		return !contains(value, v)
+	}
+	if !found {
+		return false
+	}
+	c, ok := compare(v, value)
+	if !ok {
+		return false
+	}
+	switch f.Op {
+	case "gt":
+		return c > 0
+	case "gte":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "lte":
+		return c <= 0
+	}
+	return false
+}
+
+// find answers query over docs in their stored order, decoding into out
+func find(docs []bson.M, query Query, out interface{}) error {
+	matched := bson.A{}
+	for _, doc := range docs {
+		if query.matches(doc) {
+			matched = append(matched, doc)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		for _, field := range query.Sort {
+			desc := strings.HasPrefix(field, "-")
+			a, _ := lookup(matched[i].(bson.M), strings.TrimPrefix(field, "-"))
+			b, _ := lookup(matched[j].(bson.M), strings.TrimPrefix(field, "-"))
+			c, _ := compare(a, b)
+			if c != 0 {
+				return (c < 0) != desc
+			}
+		}
+		return false
+	})
+	if query.Skip >= int64(len(matched)) {
+		matched = bson.A{}
+	} else {
+		matched = matched[query.Skip:]
+	}
+	if query.Limit > 0 && query.Limit < int64(len(matched)) {
+		matched = matched[:query.Limit]
+	}
+	data, err := bson.Marshal(bson.M{"docs": matched})
+	if err != nil {
+		return err
+	}
+	return bson.Raw(data).Lookup("docs").Unmarshal(out)
+}
+
+func count(docs []bson.M, filters []Filter) int64 {
+	query := Query{Filters: filters}
+	var n int64
+	for _, doc := range docs {
+		if query.matches(doc) {
+			n++
+		}
+	}
+	return n
+}
+
+func (q Query) matches(doc bson.M) bool {
+	for _, f := range q.Filters {
+		if !f.matches(doc) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,11 @@
 package etl
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/go-playground/validator"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,23 +21,70 @@ func (s SymbolDoc) ForInsert() bson.M {
 }
 
 type EtlConfig struct {
-	ID     *primitive.ObjectID `bson:"_id,omitempty"`
-	Symbol string              `bson:"symbol"`
-	Work   EtlJob              `bson:"work"`
-	Stage  EtlStage            `bson:"stage"`
+	ID           *primitive.ObjectID `bson:"_id,omitempty"`
+	Symbol       string              `bson:"symbol"`
+	Work         EtlJob              `bson:"work"`
+	Stage        EtlStage            `bson:"stage"`
+	WorkerID     string              `bson:"workerId,omitempty"`     /* worker holding the lease */
+	LeaseExpires *time.Time          `bson:"leaseExpires,omitempty"` /* lease is free to reclaim after this */
+
+	Attempts      int        `bson:"attempts"`                /* incremented on every claim */
+	LastError     string     `bson:"lastError,omitempty"`     /* most recent api or transform failure */
+	QueuedAt      *time.Time `bson:"queuedAt,omitempty"`      /* first time the job was queued */
+	LastAttemptAt *time.Time `bson:"lastAttemptAt,omitempty"` /* last time the job was claimed */
 }
 
 func NewEtlConfig(symbol string, work EtlJob) EtlConfig {
-	return EtlConfig{Symbol: symbol, Work: work, Stage: Api}
+	now := time.Now()
+	return EtlConfig{Symbol: symbol, Work: work, Stage: Api, QueuedAt: &now}
 }
 
 type EtlStage string
 
 const (
 	Api       EtlStage = "api"
+	InFlight  EtlStage = "inflight"
 	Transform EtlStage = "transform"
 )
 
+// DefaultMaxAttempts is how many times a job is claimed before it is dead lettered
+const DefaultMaxAttempts = 5
+
+// MaxAttempts reads QUEUE_MAX_ATTEMPTS falling back to DefaultMaxAttempts
+func MaxAttempts() int {
+	return envInt("QUEUE_MAX_ATTEMPTS", DefaultMaxAttempts)
+}
+
+// DefaultLease is how long a claimed job is held before another worker may reclaim it
+const DefaultLease = 2 * time.Minute
+
+// LeaseDuration reads QUEUE_LEASE (ex 90s, 5m) falling back to DefaultLease
+func LeaseDuration() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("QUEUE_LEASE"))
+	if err != nil || d <= 0 {
+		return DefaultLease
+	}
+	return d
+}
+
+// envInt reads a positive int env var falling back to def
+func envInt(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
+
+// NewWorkerID identifies this process when claiming jobs
+func NewWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%v-%v-%v", host, os.Getpid(), time.Now().UnixNano())
+}
+
 type EtlJob string
 
 // Mongo Collection names OR Task Names
@@ -46,9 +98,13 @@ const (
 
 // Other Mongo Collections
 const (
-	ApiQueue = "ApiQueue"
-	APICalls = "APICalls"
-	Logs     = "Logs"
+	ApiQueue   = "ApiQueue"
+	APICalls   = "APICalls"
+	Logs       = "Logs"
+	RateLimits = "RateLimits"
+	DeadLetter = "DeadLetter"
+	Candles    = "Candles"
+	Quarantine = "Quarantine"
 )
 
 type Config struct {
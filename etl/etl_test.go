@@ -2,7 +2,10 @@ package etl
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
+	"net/http/httptest"
 	"os"
 	"path"
 	"strings"
@@ -10,9 +13,16 @@ import (
 	"time"
 
 	// "github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/events"
+	"github.com/jaredtokuz/market-trader/fakeapi"
+	"github.com/jaredtokuz/market-trader/marketdata"
+	"github.com/jaredtokuz/market-trader/migrate"
+	"github.com/jaredtokuz/market-trader/shared"
 	"github.com/jaredtokuz/market-trader/token"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -37,13 +47,20 @@ func setup() error {
 		err = godotenv.Load(envPath)
 	}
 	if err != nil {
-		log.Fatal("Error loading .env file ", err)
+		log.Println("No .env file, tests needing MongoDB are skipped ", err)
 		return err
 	}
 
 	return nil
 }
 
+// needsMongo skips tests that need the MONGO_URI from .env
+func needsMongo(t *testing.T) {
+	if os.Getenv("MONGO_URI") == "" {
+		t.Skip("needs MONGO_URI")
+	}
+}
+
 func setDatabase() *mongo.Database {
 	client, err := mongo.NewClient(options.Client().ApplyURI(os.Getenv("MONGO_URI")))
 	if err != nil {
@@ -70,6 +87,10 @@ func setDatabase() *mongo.Database {
 }
 
 func shutdown() {
+	if os.Getenv("MONGO_URI") == "" {
+		/* only the memory backed tests could run */
+		return
+	}
 	mc := setDatabase()
 	mc.Collection(Macros).DeleteMany(context.TODO(), bson.M{})
 	mc.Collection(Medium).DeleteMany(context.TODO(), bson.M{})
@@ -78,6 +99,11 @@ func shutdown() {
 	mc.Collection(ApiQueue).DeleteMany(context.TODO(), bson.M{})
 	mc.Collection(APICalls).DeleteMany(context.TODO(), bson.M{})
 	mc.Collection(Logs).DeleteMany(context.TODO(), bson.M{})
+	mc.Collection(DeadLetter).DeleteMany(context.TODO(), bson.M{})
+	mc.Collection(Candles).DeleteMany(context.TODO(), bson.M{})
+	mc.Collection(Quarantine).DeleteMany(context.TODO(), bson.M{})
+	mc.Collection(events.Events).Drop(context.TODO())
+	mc.Collection(migrate.Migrations).Drop(context.TODO())
 	mc.Client().Disconnect(context.Background())
 }
 
@@ -91,12 +117,71 @@ func setController() *MongoController {
 }
 
 func TestMongoController(t *testing.T) {
+	needsMongo(t)
 	_, err := NewMongoController(os.Getenv("MONGO_URI"), os.Getenv("DB_NAME"))
 	if err != nil {
 		t.Error("Failed to connect to Mongo Controller", err)
 	}
 }
 
+func TestMigrationDedupesApiQueue(t *testing.T) {
+	needsMongo(t)
+	mg := setDatabase()
+	queue := mg.Collection(ApiQueue)
+	migrator, err := migrate.NewMigrator(mg, Migrations)
+	if err != nil {
+		t.Fatal("NewMigrator failed ", err)
+	}
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatal("Up failed ", err)
+	}
+	/* back to version 3, before the unique symbol and work index */
+	if _, err := migrator.Down(len(Migrations) - 3); err != nil {
+		t.Fatal("Down failed ", err)
+	}
+	defer queue.DeleteMany(context.TODO(), bson.M{})
+
+	/* ObjectIDs order by their timestamp, a minute apart per document */
+	now := time.Now()
+	at := func(minutes int) primitive.ObjectID {
+		return primitive.NewObjectIDFromTimestamp(now.Add(time.Duration(minutes) * time.Minute))
+	}
+	lease := now.Add(time.Minute)
+	newest := at(-1)
+	_, err = queue.InsertMany(context.TODO(), []interface{}{
+		bson.M{"_id": at(-6), "symbol": "TSLA", "work": Short, "stage": Api},
+		bson.M{"_id": at(-5), "symbol": "TSLA", "work": Short, "stage": InFlight, "workerId": "w1", "leaseExpires": lease},
+		bson.M{"_id": at(-4), "symbol": "TSLA", "work": Short, "stage": Api},
+		bson.M{"_id": at(-3), "symbol": "MSFT", "work": Short, "stage": Api},
+		bson.M{"_id": newest, "symbol": "MSFT", "work": Short, "stage": Api},
+		bson.M{"_id": at(-2), "symbol": "MSFT", "work": Macros, "stage": Api},
+	})
+	if err != nil {
+		t.Fatal("InsertMany failed ", err)
+	}
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatal("Migrations failed on duplicate jobs ", err)
+	}
+
+	var jobs []EtlConfig
+	cursor, err := queue.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.D{{Key: "symbol", Value: 1}, {Key: "work", Value: 1}}))
+	if err != nil {
+		t.Fatal("Find failed ", err)
+	}
+	if err := cursor.All(context.TODO(), &jobs); err != nil {
+		t.Fatal("Decode failed ", err)
+	}
+	if len(jobs) != 3 {
+		t.Fatal("Expected one job per symbol and work ", jobs)
+	}
+	if jobs[0].Symbol != "MSFT" || jobs[0].Work != Macros || jobs[1].Work != Short || *jobs[1].ID != newest {
+		t.Error("Expected the newest MSFT Short job kept ", jobs[:2])
+	}
+	if jobs[2].Symbol != "TSLA" || jobs[2].WorkerID != "w1" {
+		t.Error("Expected the leased TSLA job kept ", jobs[2])
+	}
+}
+
 func queueMacros(job EtlJob) {
 	mc := setController()
 	cursor, err := mc.Macros.Find(context.TODO(), bson.M{})
@@ -104,7 +189,15 @@ func queueMacros(job EtlJob) {
 		log.Fatal("Issue in Database Find", err)
 	}
 
-	err = mc.ApiQueue.Queue(cursor, job)
+	var docs []SymbolDoc
+	if err := cursor.All(context.TODO(), &docs); err != nil {
+		log.Fatal("Issue reading Macros ", err)
+	}
+	symbols := make([]string, len(docs))
+	for i, doc := range docs {
+		symbols[i] = doc.Symbol
+	}
+	err = mc.ApiQueue.Enqueue(symbols, job)
 	if err != nil {
 		log.Fatal("Work Queue up failed.")
 	}
@@ -133,6 +226,7 @@ func initializeQueueData(docs []SymbolDoc, job EtlJob) {
 }
 
 func TestApiQueue(t *testing.T) {
+	needsMongo(t)
 	mc := setController()
 	data := []SymbolDoc{
 		{
@@ -145,33 +239,265 @@ func TestApiQueue(t *testing.T) {
 	initializeQueueData(data, Macros)
 
 	var found *EtlConfig
-	found = mc.ApiQueue.Get()
+	found, _ = mc.ApiQueue.Claim("test-worker", time.Minute)
 	if found == nil {
 		t.Error("Docs not added to queue")
 	}
+	depth, err := mc.ApiQueue.Depth()
+	if err != nil {
+		t.Error(err)
+	}
+	counts := map[EtlStage]int64{}
+	for _, d := range depth {
+		counts[d.Stage] += d.Count
+	}
+	if counts[Api] != 1 || counts[InFlight] != 1 {
+		t.Error("Expected one queued and one inflight job got ", depth)
+	}
 	for _, s := range data {
 		err := mc.ApiQueue.Remove(EtlConfig{Symbol: s.Symbol, Work: Macros})
 		if err != nil {
 			t.Error("Failed to remove doc from queue")
 		}
 	}
-	found = mc.ApiQueue.Get()
+	found, _ = mc.ApiQueue.Claim("test-worker", time.Minute)
 	log.Println("Found ", found)
 	if found != nil {
 		t.Error("Docs not removed from queue")
 	}
 }
 
+func TestApiQueueClaim(t *testing.T) {
+	needsMongo(t)
+	mc := setController()
+	data := []SymbolDoc{
+		{
+			Symbol: "TSLA",
+		},
+		{
+			Symbol: "MSFT",
+		},
+	}
+	initializeQueueData(data, Macros)
+	defer func() {
+		for _, s := range data {
+			mc.ApiQueue.Remove(EtlConfig{Symbol: s.Symbol, Work: Macros})
+		}
+	}()
+
+	first, _ := mc.ApiQueue.Claim("worker-a", time.Minute)
+	second, _ := mc.ApiQueue.Claim("worker-b", time.Minute)
+	if first == nil || second == nil {
+		t.Fatal("Expected both workers to claim a job")
+	}
+	if first.Symbol == second.Symbol {
+		t.Error("Same job claimed twice ", first.Symbol)
+	}
+	if first.Stage != InFlight || first.WorkerID != "worker-a" {
+		t.Error("Claim did not lease the job ", first)
+	}
+	if job, _ := mc.ApiQueue.Claim("worker-c", time.Minute); job != nil {
+		t.Error("Leased jobs should not be claimable")
+	}
+
+	if err := mc.ApiQueue.Heartbeat(EtlConfig{Symbol: first.Symbol, Work: Macros, WorkerID: "worker-c"}, time.Minute); err != ErrLeaseLost {
+		t.Error("Heartbeat from a non owner should fail ", err)
+	}
+
+	// expire the lease, another worker may take it over
+	if err := mc.ApiQueue.Heartbeat(*first, -time.Second); err != nil {
+		t.Error("Heartbeat failed ", err)
+	}
+	reclaimed, _ := mc.ApiQueue.Claim("worker-c", time.Minute)
+	if reclaimed == nil || reclaimed.Symbol != first.Symbol {
+		t.Error("Expired lease was not reclaimed ", reclaimed)
+	}
+}
+
+func TestApiQueueDeadLetter(t *testing.T) {
+	needsMongo(t)
+	mc := setController()
+	data := []SymbolDoc{
+		{
+			Symbol: "TSLA",
+		},
+	}
+	initializeQueueData(data, Macros)
+	filter := JobFilter{Symbol: "TSLA", Work: Macros}
+	defer mc.DeadLetters.Purge(filter)
+	defer mc.ApiQueue.Remove(EtlConfig{Symbol: "TSLA", Work: Macros})
+
+	// retryable errors go back to the queue until attempts run out
+	job, _ := mc.ApiQueue.Claim("test-worker", time.Minute)
+	if job == nil || job.Attempts != 1 {
+		t.Fatal("Claim did not count the attempt ", job)
+	}
+	dead, err := mc.ApiQueue.Fail(*job, errors.New(SERVER_ERROR), 2)
+	if err != nil || dead {
+		t.Error("First failure should be retried ", err)
+	}
+	job, _ = mc.ApiQueue.Claim("test-worker", time.Minute)
+	if job == nil || job.Attempts != 2 || job.LastError != SERVER_ERROR {
+		t.Fatal("Failed job was not released ", job)
+	}
+	dead, err = mc.ApiQueue.Fail(*job, errors.New(SERVER_ERROR), 2)
+	if err != nil || !dead {
+		t.Error("Job out of attempts should be dead lettered ", err)
+	}
+
+	docs, err := mc.DeadLetters.List(filter, 10)
+	if err != nil || len(docs) != 1 {
+		t.Fatal("Dead letter not found ", err)
+	}
+	if job, _ := mc.ApiQueue.Claim("test-worker", time.Minute); job != nil {
+		t.Error("Dead lettered job still in queue")
+	}
+
+	n, err := mc.DeadLetters.Requeue(filter)
+	if err != nil || n != 1 {
+		t.Error("Requeue failed ", err)
+	}
+	job, _ = mc.ApiQueue.Claim("test-worker", time.Minute)
+	if job == nil || job.Attempts != 1 {
+		t.Fatal("Requeued job should start over ", job)
+	}
+
+	// permanent errors skip the remaining attempts
+	dead, err = mc.ApiQueue.Fail(*job, StatusError{StatusCode: 404}, 5)
+	if err != nil || !dead {
+		t.Error("404 should be dead lettered immediately ", err)
+	}
+}
+
+func TestCandleStore(t *testing.T) {
+	needsMongo(t)
+	mc := setController()
+	start := time.Date(2023, 2, 8, 14, 30, 0, 0, time.UTC)
+	bar := func(n int, close float64) Candle {
+		return Candle{
+			Datetime: uint64(start.Add(time.Duration(n) * 15 * time.Minute).UnixMilli()),
+			Open:     100, High: 101, Low: 99, Close: close, Volume: 1000,
+		}
+	}
+
+	// two fetches overlapping on bars 2 and 3, bar 3 was partial in the first
+	first := []Candle{bar(0, 100), bar(1, 100.5), bar(2, 100.25), bar(3, 99.5)}
+	second := []Candle{bar(2, 100.25), bar(3, 100.75), bar(4, 101)}
+	if err := mc.Candles.Upsert("TSLA", Minute15, first); err != nil {
+		t.Fatal("Upsert failed ", err)
+	}
+	if err := mc.Candles.Upsert("TSLA", Minute15, second); err != nil {
+		t.Fatal("Upsert failed ", err)
+	}
+
+	candles, err := mc.Candles.Range("TSLA", Minute15, start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal("Range failed ", err)
+	}
+	if len(candles) != 5 {
+		t.Fatal("Expected 5 merged bars, got ", len(candles))
+	}
+	if candles[3].Close != 100.75 {
+		t.Error("Overlapping bar not replaced by the later fetch ", candles[3])
+	}
+	for i := 1; i < len(candles); i++ {
+		if candles[i].Datetime <= candles[i-1].Datetime {
+			t.Error("Range not sorted by datetime")
+		}
+	}
+
+	candles, err = mc.Candles.Range("TSLA", Minute15, start.Add(15*time.Minute), start.Add(45*time.Minute))
+	if err != nil || len(candles) != 2 {
+		t.Error("Expected bars 1 and 2 in range ", candles, err)
+	}
+	candles, err = mc.Candles.Range("TSLA", Minute30, start, start.Add(24*time.Hour))
+	if err != nil || len(candles) != 0 {
+		t.Error("Timeframes should not mix ", candles, err)
+	}
+
+	last, err := mc.Candles.Last("TSLA", Minute15)
+	if err != nil || last == nil || last.Datetime != bar(4, 101).Datetime {
+		t.Error("Expected bar 4 as the last bar ", last, err)
+	}
+	last, err = mc.Candles.Last("TSLA", Daily)
+	if err != nil || last != nil {
+		t.Error("Expected no daily bar ", last, err)
+	}
+
+	// importing the same days twice keeps one bar per symbol and date
+	day := func(n int) Candle {
+		return Candle{Datetime: uint64(start.AddDate(0, 0, n).UnixMilli()), Open: 100, High: 101, Low: 99, Close: 100, Volume: 1000}
+	}
+	series := map[string][]Candle{"TSLA": {day(0), day(1)}, "AAPL": {day(0)}}
+	for i := 0; i < 2; i++ {
+		if err := mc.Candles.UpsertMany(Daily, series); err != nil {
+			t.Fatal("UpsertMany failed ", err)
+		}
+	}
+	candles, err = mc.Candles.Range("TSLA", Daily, start, start.AddDate(0, 0, 7))
+	if err != nil || len(candles) != 2 {
+		t.Error("Expected 2 daily bars ", candles, err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	needsMongo(t)
+	perMinute := 600 // 10 per second
+	limiters := map[string]RateLimiter{
+		"local": NewTokenBucket(perMinute),
+		"mongo": NewRateLimiter(setDatabase(), "test-"+time.Now().Format(time.RFC3339Nano), perMinute),
+	}
+	for name, limiter := range limiters {
+		start := time.Now()
+		for n := 0; n < 6; n++ {
+			if err := limiter.Wait(context.Background()); err != nil {
+				t.Error(name, " wait failed ", err)
+			}
+		}
+		// first token is available immediately, the other 5 take 100ms each
+		if elapsed := time.Since(start); elapsed < 450*time.Millisecond {
+			t.Error(name, " limiter did not throttle ", elapsed)
+		}
+	}
+}
+
+type staticToken string
+
+func (s staticToken) Fetch() (string, error) {
+	return string(s), nil
+}
+
+func (s staticToken) Invalidate(accessToken string) {}
+
+// setTDApiService calls TD with the .env credentials, or an in process fake
+// api when FAKE_API is set
 func setTDApiService() (TDApiService, error) {
 	mc := setController()
 
+	if os.Getenv("FAKE_API") != "" {
+		server := httptest.NewServer(fakeapi.New(fakeapi.Config{}))
+		return NewTDApiService(mc.Store(), marketdata.NewTDAmeritrade(server.URL+"/v1", "fake", staticToken("fake"))), nil
+	}
+
 	config := &Config{ApiKey: os.Getenv("API_KEY"), TokenPath: os.Getenv("TOKEN_PATH")}
 	err := config.Validate()
 	if err != nil {
 		return nil, err
 	}
 
-	td := NewTDApiService(mc, config.ApiKey, token.NewAccessTokenService(config.TokenPath))
+	tokenConfig := token.ConfigFromEnv()
+	tokenConfig.Path = config.TokenPath
+	tokenHandler, err := token.NewAccessTokenService(tokenConfig)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := marketdata.New(
+		marketdata.Config{Provider: os.Getenv("MARKET_DATA_PROVIDER"), ApiKey: config.ApiKey},
+		tokenHandler)
+	if err != nil {
+		return nil, err
+	}
+	td := NewTDApiService(mc.Store(), provider)
 	return td, nil
 }
 
@@ -185,7 +511,7 @@ func getEtlJobs() []EtlJob {
 }
 
 func TestCall(t *testing.T) {
-
+	needsMongo(t)
 	td, err := setTDApiService()
 	db := setDatabase()
 	if err != nil {
@@ -218,6 +544,7 @@ func TestCall(t *testing.T) {
 }
 
 func TestTransformLoad(t *testing.T) {
+	needsMongo(t)
 	td, err := setTDApiService()
 	mc := setController()
 	if err != nil {
@@ -234,7 +561,7 @@ func TestTransformLoad(t *testing.T) {
 		if err != nil {
 			t.Error("Call failed")
 		}
-		err = TransformLoad(*mc, success)
+		err = TransformLoad(mc.Store(), success)
 		if err != nil {
 
 		}
@@ -242,7 +569,178 @@ func TestTransformLoad(t *testing.T) {
 
 }
 
+func TestTransformFundamental(t *testing.T) {
+	body := func(fundamental map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"SPY": map[string]interface{}{
+			"symbol": "SPY", "exchange": "PACIFIC", "assetType": "ETF", "fundamental": fundamental,
+		}}
+	}
+
+	// ETFs come back without margins, ratios or a market cap
+	instrument, err := TransformFundamental("SPY", body(map[string]interface{}{
+		"symbol": "SPY", "high52": 427.123, "low52": 348.11, "vol10DayAvg": 81000000.0,
+	}))
+	if err != nil {
+		t.Fatal("Expected a partial fundamental to load ", err)
+	}
+	if *instrument.Fundamental.High52 != 427.12 || instrument.Fundamental.MarketCap != nil {
+		t.Error("Expected present fields rounded and missing ones nil ", instrument.Fundamental)
+	}
+	if !shared.StringInSlice("marketCap", instrument.MissingFields) || !shared.StringInSlice("peRatio", instrument.MissingFields) ||
+		shared.StringInSlice("high52", instrument.MissingFields) {
+		t.Error("Unexpected missing fields ", instrument.MissingFields)
+	}
+
+	// an instruments response as TD sends it, with fractional change and short interest fields
+	var aapl map[string]interface{}
+	json.Unmarshal([]byte(`{"AAPL": {"fundamental": {"symbol": "AAPL", "high52": 179.61, "low52": 124.17,
+		"dividendAmount": 0.92, "dividendYield": 0.61, "dividendDate": "2023-02-10 00:00:00.000", "peRatio": 25.64,
+		"pegRatio": -3.84, "pbRatio": 43.22, "prRatio": 6.37, "pcfRatio": 20.49, "grossMarginTTM": 42.96,
+		"grossMarginMRQ": 43.0, "netProfitMarginTTM": 24.56, "netProfitMarginMRQ": 25.61, "operatingMarginTTM": 29.41,
+		"operatingMarginMRQ": 30.74, "returnOnEquity": 147.94, "returnOnAssets": 28.29, "returnOnInvestment": 56.3,
+		"quickRatio": 0.77, "currentRatio": 0.94, "interestCoverage": 0.0, "totalDebtToCapital": 66.08,
+		"ltDebtToEquity": 175.09, "totalDebtToEquity": 195.87, "epsTTM": 5.88, "epsChangePercentTTM": -3.92,
+		"epsChangeYear": -10.5, "epsChange": -0.25, "revChangeYear": -5.48, "revChangeTTM": -0.91, "revChangeIn": 0.0,
+		"sharesOutstanding": 15821946000, "marketCapFloat": 15805.02, "marketCap": 2386015.37, "bookValuePerShare": 3.58,
+		"shortIntToFloat": 0.75, "shortIntDayToCover": 1.2, "divGrowthRate3Year": 5.47, "dividendPayAmount": 0.23,
+		"dividendPayDate": "2023-02-16 00:00:00.000", "beta": 1.2781, "vol1DayAvg": 77287980, "vol10DayAvg": 81103510,
+		"vol3MonthAvg": 1588316160},
+		"cusip": "037833100", "symbol": "AAPL", "description": "Apple Inc. - Common Stock", "exchange": "NASDAQ", "assetType": "EQUITY"}}`), &aapl)
+	instrument, err = TransformFundamental("AAPL", aapl)
+	if err != nil {
+		t.Fatal("Expected a full TD payload to load ", err)
+	}
+	if len(instrument.MissingFields) != 0 || *instrument.Fundamental.ShortIntToFloat != 0.75 || *instrument.Fundamental.Beta != 1.28 {
+		t.Error("Unexpected fundamental ", instrument.MissingFields, instrument.Fundamental)
+	}
+
+	malformed := map[string]map[string]interface{}{
+		"no instrument":  {},
+		"wrong symbol":   {"SPY": map[string]interface{}{"symbol": "QQQ", "fundamental": map[string]interface{}{"high52": 1.0}}},
+		"no symbol":      {"SPY": map[string]interface{}{"fundamental": map[string]interface{}{"high52": 1.0}}},
+		"no fundamental": body(nil),
+		"wrong type":     body(map[string]interface{}{"marketCap": "large"}),
+		"negative":       body(map[string]interface{}{"marketCap": -5.0}),
+	}
+	for name, b := range malformed {
+		if _, err := TransformFundamental("SPY", b); !errors.Is(err, ErrMalformed) {
+			t.Error("Expected ", name, " to be malformed, got ", err)
+		}
+	}
+}
+
+func TestTransformPriceHistory(t *testing.T) {
+	ph, err := TransformPriceHistory(map[string]interface{}{
+		"symbol": "TSLA",
+		"candles": []interface{}{
+			map[string]interface{}{"datetime": 1675866600000.0, "open": 196.1, "high": 197.555, "low": 195.2, "close": 196.8, "volume": 1000.0},
+			map[string]interface{}{"datetime": 1675867500000.0, "open": 196.8, "high": 198.0, "low": 196.5, "close": 197.9, "volume": 3000.0},
+		},
+	})
+	if err != nil {
+		t.Fatal("TransformPriceHistory failed ", err)
+	}
+	if len(ph.Candles) != 2 || ph.Candles[0].High != 197.56 || ph.MeanVolume != 2000 {
+		t.Error("Unexpected price history ", ph)
+	}
+
+	for name, body := range map[string]map[string]interface{}{
+		"empty":      {"symbol": "TSLA", "candles": []interface{}{}, "empty": true},
+		"no symbol":  {"candles": []interface{}{map[string]interface{}{"close": 1.0}}},
+		"wrong type": {"symbol": "TSLA", "candles": "none"},
+	} {
+		if _, err := TransformPriceHistory(body); !errors.Is(err, ErrMalformed) {
+			t.Error("Expected ", name, " to be malformed, got ", err)
+		}
+	}
+}
+
+func TestTransformLoadQuarantine(t *testing.T) {
+	needsMongo(t)
+	mc := setController()
+	config := NewEtlConfig("SPY", Macros)
+	if err := TransformLoad(mc.Store(), CreateApiSuccess(map[string]interface{}{}, config)); err != nil {
+		t.Fatal("Expected a malformed payload to be quarantined not failed ", err)
+	}
+	docs, err := mc.Quarantined.List(JobFilter{Symbol: "SPY"}, 10)
+	if err != nil || len(docs) != 1 || docs[0].Work != Macros {
+		t.Fatal("Expected the payload in quarantine ", docs, err)
+	}
+	n, err := mc.Quarantined.Requeue(JobFilter{Symbol: "SPY"})
+	if err != nil || n != 1 {
+		t.Error("Expected one job requeued ", n, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	body := map[string]interface{}{"symbol": "TSLA", "candles": []interface{}{
+		map[string]interface{}{"datetime": 1675866600000.0, "open": 196.1, "high": 197.5, "low": 195.2, "close": 196.8, "volume": 1000.0},
+	}}
+	recorded := []HttpResponsesDocument{
+		{EtlConfig: NewEtlConfig("TSLA", Short), Response: APIResponse{Body: body, Status: 200, Path: "/v1/marketdata/TSLA/pricehistory"}},
+		{EtlConfig: NewEtlConfig("GONE", Macros), Response: APIResponse{Body: map[string]interface{}{}, Status: 404}},
+	}
+	for _, doc := range recorded {
+		if err := WriteFixture(dir, doc); err != nil {
+			t.Fatal("WriteFixture failed ", err)
+		}
+	}
+	/* a fixture saved by hand is just the body */
+	os.WriteFile(FixturePath(dir, "MSFT", Short), []byte(`{"symbol": "MSFT", "candles": []}`), 0644)
+
+	td := NewReplayService(NewFixtureSource(dir), marketdata.NewTDAmeritrade("", "", nil))
+	success, err := td.Call(NewEtlConfig("TSLA", Short))
+	if err != nil || success.Body["symbol"] != "TSLA" {
+		t.Error("Expected the recorded TSLA body ", success.Body, err)
+	}
+	success, err = td.Call(NewEtlConfig("MSFT", Short))
+	if err != nil || success.Body["symbol"] != "MSFT" {
+		t.Error("Expected the plain MSFT body ", success.Body, err)
+	}
+	if _, err := td.Call(NewEtlConfig("GONE", Macros)); !IsPermanent(err) {
+		t.Error("Expected the recorded 404 as a permanent error ", err)
+	}
+	if _, err := td.Call(NewEtlConfig("AAPL", Short)); !errors.Is(err, ErrNotRecorded) || !IsPermanent(err) {
+		t.Error("Expected ErrNotRecorded ", err)
+	}
+	jobs, err := NewFixtureSource(dir).Jobs(Short)
+	if err != nil || len(jobs) != 2 {
+		t.Error("Expected 2 recorded Short jobs ", jobs, err)
+	}
+
+	// replaying leaves a live job for the same symbol queued
+	memory := NewMemoryStore()
+	memory.ApiQueue.Enqueue([]string{"TSLA"}, Short)
+	success, _ = td.Call(NewEtlConfig("TSLA", Short))
+	if err := Load(memory, success); err != nil {
+		t.Fatal("Load failed ", err)
+	}
+	if ph, _ := memory.Snapshots.Get(Short, "TSLA"); ph == nil {
+		t.Error("Expected the replayed TSLA snapshot")
+	}
+	if depth, _ := memory.ApiQueue.Depth(); len(depth) != 1 || depth[0].Count != 1 {
+		t.Error("Load should not remove the queued job ", depth)
+	}
+
+	// bodies cached in APICalls come back as plain json maps
+	needsMongo(t)
+	mc := setController()
+	if err := mc.ApiCalls.Cache(recorded[0].EtlConfig, recorded[0]); err != nil {
+		t.Fatal("Cache failed ", err)
+	}
+	td = NewReplayService(NewApiCallsSource(mc.ApiCalls), marketdata.NewTDAmeritrade("", "", nil))
+	success, err = td.Call(NewEtlConfig("TSLA", Short))
+	if err != nil {
+		t.Fatal("Replay from APICalls failed ", err)
+	}
+	if _, err := TransformPriceHistory(success.Body); err != nil {
+		t.Error("Replayed body should transform like the live one ", err)
+	}
+}
+
 func TestWorkerGeneral(t *testing.T) {
+	needsMongo(t)
 	data := []SymbolDoc{
 		{
 			Symbol: "TSLA",
@@ -258,3 +756,17 @@ func TestWorkerGeneral(t *testing.T) {
 
 	InitWorker()
 }
+
+func TestSessionWindow(t *testing.T) {
+	// saturday morning on a UTC machine, the last session was friday 2023-02-10
+	now := time.Date(2023, 2, 11, 14, 0, 0, 0, time.UTC)
+	start, end := SessionWindow(Short, now)
+	if start != time.Date(2023, 2, 9, 4, 0, 0, 0, calendar.NewYork) || end != time.Date(2023, 2, 10, 20, 0, 0, 0, calendar.NewYork) {
+		t.Error("Unexpected Short window ", start, end)
+	}
+	start, _ = SessionWindow(Medium, now)
+	// 10 sessions back skips the weekends and presidents day is later
+	if start != time.Date(2023, 1, 30, 4, 0, 0, 0, calendar.NewYork) {
+		t.Error("Unexpected Medium window start ", start)
+	}
+}
@@ -0,0 +1,632 @@
+package etl
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemoryStore keeps everything in process, it is lost on exit. Rate limits
+// are only shared between goroutines.
+func NewMemoryStore() *Store {
+	queue := &memoryQueue{}
+	var mu sync.Mutex
+	collections := map[string]*memoryDocuments{}
+	return &Store{
+		ApiQueue:     queue,
+		DeadLetters:  &memoryDeadLetters{queue: queue},
+		Quarantined:  &memoryQuarantine{queue: queue},
+		ApiCalls:     &memoryApiCalls{calls: make(map[string]HttpResponsesDocument)},
+		Fundamentals: &memoryFundamentals{newMemoryDocuments()},
+		Snapshots:    &memorySnapshots{snapshots: make(map[string]PriceHistory)},
+		Candles:      &memoryCandles{series: make(map[string]map[uint64]Candle)},
+		Logs:         &memoryLogs{},
+		RateLimiter: func(key string, perMinute int) RateLimiter {
+			return NewTokenBucket(perMinute)
+		},
+		Documents: func(collection string) DocumentStore {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := collections[collection]; !ok {
+				collections[collection] = newMemoryDocuments()
+			}
+			return collections[collection]
+		},
+	}
+}
+
+func jobKey(symbol string, work EtlJob) string {
+	return string(work) + "/" + symbol
+}
+
+type memoryQueue struct {
+	mu   sync.Mutex
+	jobs []EtlConfig /* in the order queued, like Mongo's natural order */
+	dead []DeadLetterDocument
+}
+
+func (q *memoryQueue) find(symbol string, work EtlJob) int {
+	for i, job := range q.jobs {
+		if job.Symbol == symbol && job.Work == work {
+			return i
+		}
+	}
+	return -1
+}
+
+// add queues a job unless one is queued for the symbol and work already, q.mu is held
+func (q *memoryQueue) add(symbol string, work EtlJob) {
+	if q.find(symbol, work) < 0 {
+		q.jobs = append(q.jobs, NewEtlConfig(symbol, work))
+	}
+}
+
+func (q *memoryQueue) Enqueue(symbols []string, workName EtlJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, symbol := range symbols {
+		q.add(symbol, workName)
+	}
+	return nil
+}
+
+func release(job *EtlConfig) {
+	job.Stage = Api
+	job.WorkerID = ""
+	job.LeaseExpires = nil
+}
+
+func (q *memoryQueue) Init() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	for i := range q.jobs {
+		if q.jobs[i].LeaseExpires == nil || q.jobs[i].LeaseExpires.Before(now) {
+			release(&q.jobs[i])
+		}
+	}
+	return nil
+}
+
+func (q *memoryQueue) Claim(workerID string, lease time.Duration) (*EtlConfig, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	for i := range q.jobs {
+		job := &q.jobs[i]
+		if job.Stage == Api || (job.LeaseExpires != nil && job.LeaseExpires.Before(now)) {
+			expires := now.Add(lease)
+			attempt := now
+			job.Stage = InFlight
+			job.WorkerID = workerID
+			job.LeaseExpires = &expires
+			job.LastAttemptAt = &attempt
+			job.Attempts++
+			claimed := *job
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+// held finds the job if etlConfig's worker still holds it, q.mu is held
+func (q *memoryQueue) held(etlConfig EtlConfig) (*EtlConfig, error) {
+	i := q.find(etlConfig.Symbol, etlConfig.Work)
+	if i < 0 || q.jobs[i].WorkerID != etlConfig.WorkerID {
+		return nil, ErrLeaseLost
+	}
+	return &q.jobs[i], nil
+}
+
+func (q *memoryQueue) Heartbeat(etlConfig EtlConfig, lease time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, err := q.held(etlConfig)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(lease)
+	job.LeaseExpires = &expires
+	return nil
+}
+
+func (q *memoryQueue) Reclaim() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var n int64
+	for i := range q.jobs {
+		if q.jobs[i].Stage != Api && q.jobs[i].LeaseExpires != nil && q.jobs[i].LeaseExpires.Before(now) {
+			release(&q.jobs[i])
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *memoryQueue) UpdateStage(etlConfig EtlConfig, lease time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, err := q.held(etlConfig)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(lease)
+	job.Stage = Transform
+	job.LeaseExpires = &expires
+	return nil
+}
+
+func (q *memoryQueue) Fail(etlConfig EtlConfig, cause error, maxAttempts int) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	etlConfig.LastError = cause.Error()
+	job, err := q.held(etlConfig)
+	if err != nil {
+		return false, err
+	}
+	if !IsPermanent(cause) && etlConfig.Attempts < maxAttempts {
+		job.LastError = etlConfig.LastError
+		release(job)
+		return false, nil
+	}
+	q.dead = append(q.dead, NewDeadLetterDocument(etlConfig))
+	q.remove(etlConfig)
+	return true, nil
+}
+
+// remove drops the job, q.mu is held
+func (q *memoryQueue) remove(etlConfig EtlConfig) {
+	if i := q.find(etlConfig.Symbol, etlConfig.Work); i >= 0 {
+		q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+	}
+}
+
+func (q *memoryQueue) Remove(etlConfig EtlConfig) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(etlConfig)
+	return nil
+}
+
+func (q *memoryQueue) Cancel(symbols []string) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cancel := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		cancel[symbol] = true
+	}
+	jobs := q.jobs[:0]
+	for _, job := range q.jobs {
+		if job.Stage != Api || !cancel[job.Symbol] {
+			jobs = append(jobs, job)
+		}
+	}
+	n := int64(len(q.jobs) - len(jobs))
+	q.jobs = jobs
+	return n, nil
+}
+
+func (q *memoryQueue) Depth() ([]QueueDepth, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	counts := make(map[QueueDepth]int64)
+	for _, job := range q.jobs {
+		counts[QueueDepth{Work: job.Work, Stage: job.Stage}]++
+	}
+	return depthOf(counts), nil
+}
+
+// depthOf sorts counts the way the Mongo aggregation does, by work then stage
+func depthOf(counts map[QueueDepth]int64) []QueueDepth {
+	depth := []QueueDepth{}
+	for d, n := range counts {
+		d.Count = n
+		depth = append(depth, d)
+	}
+	sort.Slice(depth, func(i, j int) bool {
+		if depth[i].Work != depth[j].Work {
+			return depth[i].Work < depth[j].Work
+		}
+		return depth[i].Stage < depth[j].Stage
+	})
+	return depth
+}
+
+func (f JobFilter) match(symbol string, work EtlJob) bool {
+	return (f.Symbol == "" || f.Symbol == symbol) && (f.Work == "" || f.Work == work)
+}
+
+type memoryDeadLetters struct {
+	queue *memoryQueue /* dead letters are moved there by Fail */
+}
+
+func (d *memoryDeadLetters) List(filter JobFilter, limit int64) ([]DeadLetterDocument, error) {
+	d.queue.mu.Lock()
+	defer d.queue.mu.Unlock()
+	docs := []DeadLetterDocument{}
+	for i := len(d.queue.dead) - 1; i >= 0 && (limit <= 0 || int64(len(docs)) < limit); i-- {
+		if doc := d.queue.dead[i]; filter.match(doc.Symbol, doc.Work) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func (d *memoryDeadLetters) Requeue(filter JobFilter) (int64, error) {
+	return d.take(filter, true), nil
+}
+
+func (d *memoryDeadLetters) Purge(filter JobFilter) (int64, error) {
+	return d.take(filter, false), nil
+}
+
+// take removes matching dead letters, requeueing them when asked
+func (d *memoryDeadLetters) take(filter JobFilter, requeue bool) int64 {
+	d.queue.mu.Lock()
+	defer d.queue.mu.Unlock()
+	var kept []DeadLetterDocument
+	var n int64
+	for _, doc := range d.queue.dead {
+		if !filter.match(doc.Symbol, doc.Work) {
+			kept = append(kept, doc)
+			continue
+		}
+		if requeue {
+			d.queue.add(doc.Symbol, doc.Work)
+		}
+		n++
+	}
+	d.queue.dead = kept
+	return n
+}
+
+type memoryQuarantine struct {
+	mu    sync.Mutex
+	queue *memoryQueue
+	docs  []QuarantineDocument
+}
+
+func (q *memoryQuarantine) Add(etlConfig EtlConfig, body interface{}, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.docs = append(q.docs, QuarantineDocument{
+		Symbol:        etlConfig.Symbol,
+		Work:          etlConfig.Work,
+		Reason:        cause.Error(),
+		Body:          body,
+		QuarantinedAt: time.Now(),
+	})
+	return nil
+}
+
+func (q *memoryQuarantine) List(filter JobFilter, limit int64) ([]QuarantineDocument, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	docs := []QuarantineDocument{}
+	for i := len(q.docs) - 1; i >= 0 && (limit <= 0 || int64(len(docs)) < limit); i-- {
+		if doc := q.docs[i]; filter.match(doc.Symbol, doc.Work) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func (q *memoryQuarantine) Requeue(filter JobFilter) (int64, error) {
+	return q.take(filter, true), nil
+}
+
+func (q *memoryQuarantine) Purge(filter JobFilter) (int64, error) {
+	return q.take(filter, false), nil
+}
+
+func (q *memoryQuarantine) take(filter JobFilter, requeue bool) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var kept []QuarantineDocument
+	var symbols []QuarantineDocument
+	for _, doc := range q.docs {
+		if filter.match(doc.Symbol, doc.Work) {
+			symbols = append(symbols, doc)
+		} else {
+			kept = append(kept, doc)
+		}
+	}
+	q.docs = kept
+	if requeue {
+		for _, doc := range symbols {
+			q.queue.Enqueue([]string{doc.Symbol}, doc.Work)
+		}
+	}
+	return int64(len(symbols))
+}
+
+type memoryApiCalls struct {
+	mu    sync.Mutex
+	calls map[string]HttpResponsesDocument
+}
+
+func (a *memoryApiCalls) Cache(etlConfig EtlConfig, doc HttpResponsesDocument) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls[jobKey(etlConfig.Symbol, etlConfig.Work)] = doc
+	return nil
+}
+
+func (a *memoryApiCalls) Get(symbol string, work EtlJob) (*HttpResponsesDocument, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	doc, ok := a.calls[jobKey(symbol, work)]
+	if !ok {
+		return nil, ErrNotRecorded
+	}
+	return &doc, nil
+}
+
+func (a *memoryApiCalls) List(work EtlJob) ([]HttpResponsesDocument, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var keys []string
+	for key, doc := range a.calls {
+		if work == "" || doc.EtlConfig.Work == work {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	docs := make([]HttpResponsesDocument, len(keys))
+	for i, key := range keys {
+		docs[i] = a.calls[key]
+	}
+	return docs, nil
+}
+
+// memoryDocuments keeps documents by key in the order they were first stored
+type memoryDocuments struct {
+	mu   sync.Mutex
+	keys []string
+	docs map[string]bson.M
+}
+
+func newMemoryDocuments() *memoryDocuments {
+	return &memoryDocuments{docs: make(map[string]bson.M)}
+}
+
+// put stores doc under key, m.mu is held
+func (m *memoryDocuments) put(key string, doc bson.M) {
+	if _, ok := m.docs[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.docs[key] = doc
+}
+
+// all is every document in the order stored, m.mu is held
+func (m *memoryDocuments) all() []bson.M {
+	docs := make([]bson.M, len(m.keys))
+	for i, key := range m.keys {
+		docs[i] = m.docs[key]
+	}
+	return docs
+}
+
+func (m *memoryDocuments) Find(query Query, docs interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return find(m.all(), query, docs)
+}
+
+func (m *memoryDocuments) Count(filters ...Filter) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return count(m.all(), filters), nil
+}
+
+func (m *memoryDocuments) Insert(docs ...interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range docs {
+		doc, err := toDocument(v)
+		if err != nil {
+			return err
+		}
+		id := primitive.NewObjectID()
+		if _, ok := doc["_id"]; !ok {
+			doc["_id"] = id
+		}
+		m.put(id.Hex(), doc)
+	}
+	return nil
+}
+
+func (m *memoryDocuments) Replace(id string, v interface{}) error {
+	doc, err := toDocument(v)
+	if err != nil {
+		return err
+	}
+	doc["_id"] = id
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(id, doc)
+	return nil
+}
+
+// memoryFundamentals keys the Macros documents by symbol
+type memoryFundamentals struct {
+	*memoryDocuments
+}
+
+func (f *memoryFundamentals) Upsert(symbol string, instrument *Instrument) error {
+	fields, err := toDocument(instrument)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	doc, ok := f.docs[symbol]
+	if !ok {
+		doc = bson.M{"symbol": symbol}
+	}
+	for key, v := range fields {
+		doc[key] = v
+	}
+	f.put(symbol, doc)
+	return nil
+}
+
+func (f *memoryFundamentals) SetMarketCap(symbol string, marketCap float64) error {
+	return f.Update(map[string]FieldUpdate{symbol: {Set: bson.M{"marketCap": marketCap}, Upsert: true}})
+}
+
+func (f *memoryFundamentals) Get(symbol string) (*Instrument, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	doc, ok := f.docs[symbol]
+	if !ok {
+		return nil, nil
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var instrument Instrument
+	return &instrument, bson.Unmarshal(data, &instrument)
+}
+
+func (f *memoryFundamentals) Update(updates map[string]FieldUpdate) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for symbol, u := range updates {
+		doc, ok := f.docs[symbol]
+		if !ok && !u.Upsert {
+			continue
+		}
+		if !ok {
+			doc = bson.M{"symbol": symbol}
+		} else if !(Query{Filters: u.Where}).matches(doc) {
+			continue
+		}
+		u.apply(doc, !ok)
+		f.put(symbol, doc)
+	}
+	return nil
+}
+
+type memorySnapshots struct {
+	mu        sync.Mutex
+	snapshots map[string]PriceHistory
+}
+
+func (s *memorySnapshots) Save(work EtlJob, ph *PriceHistory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[jobKey(ph.Symbol, work)] = *ph
+	return nil
+}
+
+func (s *memorySnapshots) Get(work EtlJob, symbol string) (*PriceHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ph, ok := s.snapshots[jobKey(symbol, work)]
+	if !ok {
+		return nil, nil
+	}
+	return &ph, nil
+}
+
+func (s *memorySnapshots) List(work EtlJob) ([]PriceHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.snapshots {
+		if strings.HasPrefix(key, jobKey("", work)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	docs := make([]PriceHistory, len(keys))
+	for i, key := range keys {
+		docs[i] = s.snapshots[key]
+	}
+	return docs, nil
+}
+
+type memoryCandles struct {
+	mu     sync.Mutex
+	series map[string]map[uint64]Candle /* by symbol and timeframe, then datetime */
+}
+
+func (c *memoryCandles) Upsert(symbol string, timeframe Timeframe, candles []Candle) error {
+	return c.UpsertMany(timeframe, map[string][]Candle{symbol: candles})
+}
+
+func (c *memoryCandles) UpsertMany(timeframe Timeframe, series map[string][]Candle) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for symbol, candles := range series {
+		key := symbol + "/" + string(timeframe)
+		if c.series[key] == nil {
+			c.series[key] = make(map[uint64]Candle)
+		}
+		for _, candle := range candles {
+			c.series[key][candle.Datetime] = candle
+		}
+	}
+	return nil
+}
+
+// sorted is the series oldest first, c.mu is held
+func (c *memoryCandles) sorted(symbol string, timeframe Timeframe) []Candle {
+	var candles []Candle
+	for _, candle := range c.series[symbol+"/"+string(timeframe)] {
+		candles = append(candles, candle)
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Datetime < candles[j].Datetime })
+	return candles
+}
+
+func (c *memoryCandles) Range(symbol string, timeframe Timeframe, from time.Time, to time.Time) ([]Candle, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	candles := []Candle{}
+	for _, candle := range c.sorted(symbol, timeframe) {
+		if candle.Datetime >= uint64(from.UnixMilli()) && candle.Datetime < uint64(to.UnixMilli()) {
+			candles = append(candles, candle)
+		}
+	}
+	return candles, nil
+}
+
+func (c *memoryCandles) Last(symbol string, timeframe Timeframe) (*Candle, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	candles := c.sorted(symbol, timeframe)
+	if len(candles) == 0 {
+		return nil, nil
+	}
+	return &candles[len(candles)-1], nil
+}
+
+type memoryLogs struct {
+	mu   sync.Mutex
+	logs []LogDocument
+}
+
+func (l *memoryLogs) Insert(category string, msg string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, LogDocument{Category: category, Msg: msg, At: time.Now()})
+	return nil
+}
+
+func (l *memoryLogs) List(limit int64) ([]LogDocument, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	docs := []LogDocument{}
+	for i := len(l.logs) - 1; i >= 0 && (limit <= 0 || int64(len(docs)) < limit); i-- {
+		docs = append(docs, l.logs[i])
+	}
+	return docs, nil
+}
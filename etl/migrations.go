@@ -0,0 +1,193 @@
+package etl
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/jaredtokuz/market-trader/events"
+	"github.com/jaredtokuz/market-trader/migrate"
+)
+
+// LogsTTL is how long Logs documents with an at date are kept
+const LogsTTL = 30 * 24 * time.Hour
+
+// Migrations are applied by NewMongoController unless AUTO_MIGRATE=false, and
+// by cmd/migrate. Never edit an applied migration, add a new version instead.
+var Migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "unique Macros symbol, was scripts/init_db.sh",
+		Up: func(db *mongo.Database) error {
+			return migrate.CreateIndexes(db, Macros, migrate.Index{Name: "symbol_1", Keys: bson.D{{Key: "symbol", Value: 1}}, Unique: true})
+		},
+		Down: func(db *mongo.Database) error {
+			return migrate.DropIndexes(db, Macros, "symbol_1")
+		},
+	},
+	{
+		Version:     2,
+		Description: "unique Candles symbol, timeframe and datetime",
+		Up: func(db *mongo.Database) error {
+			return migrate.CreateIndexes(db, Candles, migrate.Index{
+				Name:   "symbol_1_timeframe_1_datetime_1",
+				Keys:   bson.D{{Key: "symbol", Value: 1}, {Key: "timeframe", Value: 1}, {Key: "datetime", Value: 1}},
+				Unique: true,
+			})
+		},
+		Down: func(db *mongo.Database) error {
+			return migrate.DropIndexes(db, Candles, "symbol_1_timeframe_1_datetime_1")
+		},
+	},
+	{
+		Version:     3,
+		Description: "capped Events collection",
+		Up: func(db *mongo.Database) error {
+			return events.EnsureCollection(db, events.DefaultCapBytes)
+		},
+		Down: func(db *mongo.Database) error {
+			return db.Collection(events.Events).Drop(context.TODO())
+		},
+	},
+	{
+		Version:     4,
+		Description: "ApiQueue jobs by symbol and work, claims by stage",
+		Up: func(db *mongo.Database) error {
+			return migrate.CreateIndexes(db, ApiQueue,
+				migrate.Index{Name: "symbol_1_work_1", Keys: bson.D{{Key: "symbol", Value: 1}, {Key: "work", Value: 1}}, Unique: true},
+				migrate.Index{Name: "stage_1_leaseExpires_1", Keys: bson.D{{Key: "stage", Value: 1}, {Key: "leaseExpires", Value: 1}}})
+		},
+		Down: func(db *mongo.Database) error {
+			return migrate.DropIndexes(db, ApiQueue, "symbol_1_work_1", "stage_1_leaseExpires_1")
+		},
+	},
+	{
+		Version:     5,
+		Description: "unique APICalls work and symbol",
+		Up: func(db *mongo.Database) error {
+			return migrate.CreateIndexes(db, APICalls, migrate.Index{Name: "work_1_symbol_1", Keys: bson.D{{Key: "work", Value: 1}, {Key: "symbol", Value: 1}}, Unique: true})
+		},
+		Down: func(db *mongo.Database) error {
+			return migrate.DropIndexes(db, APICalls, "work_1_symbol_1")
+		},
+	},
+	{
+		Version:     6,
+		Description: "DeadLetter and Quarantine filters and newest first listing",
+		Up: func(db *mongo.Database) error {
+			err := migrate.CreateIndexes(db, DeadLetter,
+				migrate.Index{Name: "symbol_1_work_1", Keys: bson.D{{Key: "symbol", Value: 1}, {Key: "work", Value: 1}}},
+				migrate.Index{Name: "deadAt_-1", Keys: bson.D{{Key: "deadAt", Value: -1}}})
+			if err != nil {
+				return err
+			}
+			return migrate.CreateIndexes(db, Quarantine,
+				migrate.Index{Name: "symbol_1_work_1", Keys: bson.D{{Key: "symbol", Value: 1}, {Key: "work", Value: 1}}},
+				migrate.Index{Name: "quarantinedAt_-1", Keys: bson.D{{Key: "quarantinedAt", Value: -1}}})
+		},
+		Down: func(db *mongo.Database) error {
+			if err := migrate.DropIndexes(db, DeadLetter, "symbol_1_work_1", "deadAt_-1"); err != nil {
+				return err
+			}
+			return migrate.DropIndexes(db, Quarantine, "symbol_1_work_1", "quarantinedAt_-1")
+		},
+	},
+	{
+		Version:     7,
+		Description: "unique Medium, Short and Signals symbol",
+		Up: func(db *mongo.Database) error {
+			for _, collection := range []string{Medium, Short, Signals} {
+				err := migrate.CreateIndexes(db, collection, migrate.Index{Name: "symbol_1", Keys: bson.D{{Key: "symbol", Value: 1}}, Unique: true})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(db *mongo.Database) error {
+			for _, collection := range []string{Medium, Short, Signals} {
+				if err := migrate.DropIndexes(db, collection, "symbol_1"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     8,
+		Description: "expire Logs after 30 days",
+		Up: func(db *mongo.Database) error {
+			return migrate.CreateIndexes(db, Logs, migrate.Index{Name: "at_1", Keys: bson.D{{Key: "at", Value: 1}}, TTL: LogsTTL})
+		},
+		Down: func(db *mongo.Database) error {
+			return migrate.DropIndexes(db, Logs, "at_1")
+		},
+	},
+	{
+		Version:     9,
+		Description: "ApiQueue and Candles validators",
+		Up: func(db *mongo.Database) error {
+			err := migrate.SetValidator(db, ApiQueue, bson.M{
+				"bsonType": "object",
+				"required": bson.A{"symbol", "work", "stage"},
+				"properties": bson.M{
+					"symbol": bson.M{"bsonType": "string", "minLength": 1},
+					"work":   bson.M{"enum": bson.A{Macros, Medium, Short, Signals}},
+					"stage":  bson.M{"enum": bson.A{Api, InFlight, Transform}},
+				},
+			})
+			if err != nil {
+				return err
+			}
+			return migrate.SetValidator(db, Candles, bson.M{
+				"bsonType": "object",
+				"required": bson.A{"symbol", "timeframe", "datetime"},
+				"properties": bson.M{
+					"symbol":    bson.M{"bsonType": "string", "minLength": 1},
+					"timeframe": bson.M{"bsonType": "string"},
+					"datetime":  bson.M{"bsonType": "number"},
+				},
+			})
+		},
+		Down: func(db *mongo.Database) error {
+			if err := migrate.SetValidator(db, ApiQueue, nil); err != nil {
+				return err
+			}
+			return migrate.SetValidator(db, Candles, nil)
+		},
+	},
+}
+
+// dedupeApiQueue keeps one job per symbol and work so the unique index can be
+// built on queues filled before it. The leased job wins, then the newest.
+func dedupeApiQueue(db *mongo.Database) error {
+	queue := db.Collection(ApiQueue)
+	cursor, err := queue.Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "leaseExpires", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"symbol": "$symbol", "work": "$work"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	var groups []struct {
+		IDs []interface{} `bson:"ids"`
+	}
+	if err := cursor.All(context.TODO(), &groups); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		_, err := queue.DeleteMany(context.TODO(), bson.M{"_id": bson.M{"$in": group.IDs[1:]}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
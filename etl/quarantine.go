@@ -0,0 +1,52 @@
+package etl
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// QuarantineService keeps api payloads the transforms rejected, retrying the
+// same job would only fetch the same payload again
+type QuarantineService interface {
+	Add(etlConfig EtlConfig, body interface{}, cause error) error
+	List(filter JobFilter, limit int64) ([]QuarantineDocument, error)
+	Requeue(filter JobFilter) (int64, error) /* fresh jobs, for after a transform fix */
+	Purge(filter JobFilter) (int64, error)
+}
+
+type quarantine struct {
+	parkedJobs
+}
+
+func NewQuarantineService(mg *mongo.Database) QuarantineService {
+	return &quarantine{newParkedJobs(mg, Quarantine, "quarantinedAt")}
+}
+
+type QuarantineDocument struct {
+	ID            *primitive.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
+	Symbol        string              `json:"symbol"  bson:"symbol"`
+	Work          EtlJob              `json:"work"  bson:"work"`
+	Reason        string              `json:"reason"  bson:"reason"`
+	Body          interface{}         `json:"body"  bson:"body"`
+	QuarantinedAt time.Time           `json:"quarantinedAt"  bson:"quarantinedAt"`
+}
+
+func (q *quarantine) Add(etlConfig EtlConfig, body interface{}, cause error) error {
+	_, err := q.parked.InsertOne(context.TODO(), QuarantineDocument{
+		Symbol:        etlConfig.Symbol,
+		Work:          etlConfig.Work,
+		Reason:        cause.Error(),
+		Body:          body,
+		QuarantinedAt: time.Now(),
+	})
+	return err
+}
+
+func (q *quarantine) List(filter JobFilter, limit int64) ([]QuarantineDocument, error) {
+	var docs []QuarantineDocument
+	err := q.list(filter, limit, &docs)
+	return docs, err
+}
@@ -0,0 +1,140 @@
+package etl
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimiter blocks until the caller may make one request
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// RequestsPerMinute reads TD_REQUESTS_PER_MINUTE falling back to the TD limit
+func RequestsPerMinute() int {
+	return envInt("TD_REQUESTS_PER_MINUTE", DefaultRequestsPerMinute)
+}
+
+// tokenBucket is an in process limiter, refilled at rate tokens per second
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64
+	last     time.Time
+}
+
+func NewTokenBucket(perMinute int) RateLimiter {
+	return &tokenBucket{
+		capacity: 1,
+		tokens:   1,
+		rate:     float64(perMinute) / 60,
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// mongoRateLimiter keeps the token bucket in a RateLimits document so every
+// worker and command sharing the api key draws from the same bucket
+type mongoRateLimiter struct {
+	limits *mongo.Collection
+	key    string
+	rate   float64
+	local  RateLimiter /* used when mongo is unreachable */
+}
+
+func NewRateLimiter(mg *mongo.Database, key string, perMinute int) RateLimiter {
+	return &mongoRateLimiter{
+		limits: mg.Collection(RateLimits),
+		key:    key,
+		rate:   float64(perMinute) / 60,
+		local:  NewTokenBucket(perMinute),
+	}
+}
+
+type rateLimitDocument struct {
+	Tokens  float64 `bson:"tokens"`
+	Granted bool    `bson:"granted"`
+}
+
+func (l *mongoRateLimiter) Wait(ctx context.Context) error {
+	for {
+		doc, err := l.take(ctx)
+		if err != nil {
+			log.Println("Rate limiter falling back to local bucket: ", err.Error())
+			return l.local.Wait(ctx)
+		}
+		if doc.Granted {
+			return nil
+		}
+		if err := sleep(ctx, time.Duration((1-doc.Tokens)/l.rate*float64(time.Second))); err != nil {
+			return err
+		}
+	}
+}
+
+// take refills and decrements the bucket in a single update so concurrent
+// processes can't both spend the last token
+func (l *mongoRateLimiter) take(ctx context.Context) (*rateLimitDocument, error) {
+	now := time.Now()
+	elapsed := bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}}, 1000}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{1, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$tokens", 1}},
+				bson.M{"$multiply": bson.A{elapsed, l.rate}},
+			}}}},
+			"updatedAt": now,
+		}}},
+		{{Key: "$set", Value: bson.M{"granted": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{"tokens": bson.M{"$cond": bson.A{"$granted", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}}}}},
+	}
+
+	var doc rateLimitDocument
+	err := l.limits.FindOneAndUpdate(ctx,
+		bson.M{"_id": l.key},
+		pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,158 @@
+package etl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jaredtokuz/market-trader/marketdata"
+)
+
+// ReplaySource serves recorded api responses in place of the network
+type ReplaySource interface {
+	Response(etlConfig EtlConfig) (APIResponse, error)
+	Jobs(work EtlJob) ([]EtlConfig, error) /* every recorded job, all work when empty */
+}
+
+type replay struct {
+	source   ReplaySource
+	provider marketdata.MarketDataProvider /* normalizes bodies recorded from it */
+}
+
+// NewReplayService answers Call from source so Load can be rerun
+// offline. Recorded failures come back as the errors the live call returned.
+func NewReplayService(source ReplaySource, provider marketdata.MarketDataProvider) TDApiService {
+	return &replay{source: source, provider: provider}
+}
+
+func (r *replay) Call(etlConfig EtlConfig) (ApiCallSuccess, error) {
+	resp, err := r.source.Response(etlConfig)
+	if err != nil {
+		return ApiCallSuccess{}, err
+	}
+	if resp.Status >= 400 {
+		return ApiCallSuccess{}, statusError(resp.Status)
+	}
+	body, ok := resp.Body.(map[string]interface{})
+	if !ok {
+		body = map[string]interface{}{}
+	}
+	kind := marketdata.PriceHistoryKind
+	if etlConfig.Work == Macros {
+		kind = marketdata.FundamentalsKind
+	}
+	log.Println("Api call replayed: ", etlConfig.Symbol)
+	return CreateApiSuccess(r.provider.Normalize(kind, body), etlConfig), nil
+}
+
+func (r *replay) Quotes(symbols []string) (map[string]interface{}, error) {
+	return nil, errors.New("quotes are not recorded, replay can't serve them")
+}
+
+// InsertResponse does nothing so a replay never overwrites its own recordings
+func (r *replay) InsertResponse(etlConfig EtlConfig, resp *http.Response, decodedBody interface{}) error {
+	return nil
+}
+
+type apiCallsSource struct {
+	apiCalls ApiCallService
+}
+
+// NewApiCallsSource replays the last response cached in APICalls for each job
+func NewApiCallsSource(apiCalls ApiCallService) ReplaySource {
+	return &apiCallsSource{apiCalls: apiCalls}
+}
+
+func (s *apiCallsSource) Response(etlConfig EtlConfig) (APIResponse, error) {
+	doc, err := s.apiCalls.Get(etlConfig.Symbol, etlConfig.Work)
+	if err != nil {
+		return APIResponse{}, err
+	}
+	return doc.Response, nil
+}
+
+func (s *apiCallsSource) Jobs(work EtlJob) ([]EtlConfig, error) {
+	docs, err := s.apiCalls.List(work)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]EtlConfig, len(docs))
+	for i, doc := range docs {
+		jobs[i] = NewEtlConfig(doc.EtlConfig.Symbol, doc.EtlConfig.Work)
+	}
+	return jobs, nil
+}
+
+type fixtureSource struct {
+	dir string
+}
+
+// NewFixtureSource replays files laid out as dir/<work>/<symbol>.json. A file
+// holds either a recorded APIResponse with body and status, or just the body.
+func NewFixtureSource(dir string) ReplaySource {
+	return &fixtureSource{dir: dir}
+}
+
+func FixturePath(dir string, symbol string, work EtlJob) string {
+	return filepath.Join(dir, string(work), symbol+".json")
+}
+
+func (s *fixtureSource) Response(etlConfig EtlConfig) (APIResponse, error) {
+	path := FixturePath(s.dir, etlConfig.Symbol, etlConfig.Work)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return APIResponse{}, ErrNotRecorded
+	}
+	if err != nil {
+		return APIResponse{}, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return APIResponse{}, fmt.Errorf("%v: %w", path, err)
+	}
+	_, hasBody := fields["body"]
+	_, hasStatus := fields["status"]
+	if hasBody && hasStatus {
+		var resp APIResponse
+		err := json.Unmarshal(b, &resp)
+		return resp, err
+	}
+	var body map[string]interface{}
+	err = json.Unmarshal(b, &body)
+	return APIResponse{Body: body, Status: http.StatusOK}, err
+}
+
+func (s *fixtureSource) Jobs(work EtlJob) ([]EtlConfig, error) {
+	pattern := FixturePath(s.dir, "*", work)
+	if work == "" {
+		pattern = FixturePath(s.dir, "*", "*")
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]EtlConfig, len(paths))
+	for i, path := range paths {
+		symbol := strings.TrimSuffix(filepath.Base(path), ".json")
+		jobs[i] = NewEtlConfig(symbol, EtlJob(filepath.Base(filepath.Dir(path))))
+	}
+	return jobs, nil
+}
+
+// WriteFixture saves a recorded response where NewFixtureSource looks for it
+func WriteFixture(dir string, doc HttpResponsesDocument) error {
+	path := FixturePath(dir, doc.EtlConfig.Symbol, doc.EtlConfig.Work)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(doc.Response, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,351 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/jaredtokuz/market-trader/events"
+)
+
+// Store is everything the etl pipeline persists, from queueing a job to loading
+// its response. MongoController.Store is the production backend, NewMemoryStore
+// runs the pipeline without a database for tests and quick local runs.
+type Store struct {
+	ApiQueue     ApiQueueService
+	DeadLetters  DeadLetterService
+	Quarantined  QuarantineService
+	ApiCalls     ApiCallService
+	Fundamentals FundamentalStore
+	Snapshots    SnapshotStore
+	Candles      CandleStore
+	Logs         LogStore
+	Events       events.Publisher                            /* nil publishes nothing */
+	RateLimiter  func(key string, perMinute int) RateLimiter /* shared by processes using the same backend */
+	Documents    func(collection string) DocumentStore       /* collections owned outside etl, ex SignalHistory */
+
+	// TailEvents feeds bus with the events every process publishes until ctx
+	// is done, nil when the backend can't share them between processes
+	TailEvents func(ctx context.Context, bus events.Publisher)
+}
+
+/* STORAGE values */
+const (
+	MongoStorage  = "mongo"
+	MemoryStorage = "memory"
+	BoltStorage   = "bolt"
+)
+
+// NewStoreFromEnv opens the backend named by STORAGE, mongo by default with
+// MONGO_URI and DB_NAME, bolt with the file at BOLT_PATH
+func NewStoreFromEnv() (*Store, error) {
+	switch os.Getenv("STORAGE") {
+	case MongoStorage, "":
+		mg, err := NewMongoController(os.Getenv("MONGO_URI"), os.Getenv("DB_NAME"))
+		if err != nil {
+			return nil, err
+		}
+		return mg.Store(), nil
+	case MemoryStorage:
+		return NewMemoryStore(), nil
+	case BoltStorage:
+		path := os.Getenv("BOLT_PATH")
+		if path == "" {
+			path = "market-trader.db"
+		}
+		return NewBoltStore(path)
+	}
+	return nil, errors.New("unknown STORAGE: " + os.Getenv("STORAGE"))
+}
+
+// Filter matches a document field by its dotted path, like a Mongo query operator
+type Filter struct {
+	Field string      `json:"field" yaml:"field" validate:"required"` /* ex fundamental.vol10DayAvg */
+	Op    string      `json:"op" yaml:"op" validate:"required,oneof=gt gte lt lte eq ne in nin exists"`
+	Value interface{} `json:"value" yaml:"value"`
+}
+
+// Query selects documents, every filter must match
+type Query struct {
+	Filters []Filter
+	Sort    []string /* field paths, - prefixed for descending */
+	Skip    int64
+	Limit   int64 /* 0 for no limit */
+}
+
+// Finder reads a collection of documents
+type Finder interface {
+	Find(query Query, docs interface{}) error /* decodes the matches into docs, a pointer to a slice */
+	Count(filters ...Filter) (int64, error)
+}
+
+// DocumentStore is a collection of documents with no etl specific shape
+type DocumentStore interface {
+	Finder
+	Insert(docs ...interface{}) error
+	Replace(id string, doc interface{}) error /* inserts when no document has the _id */
+}
+
+// FieldUpdate changes fields of a Macros document by their dotted paths
+type FieldUpdate struct {
+	Set         bson.M
+	Unset       []string
+	SetOnInsert bson.M /* only when Upsert creates the document */
+	Upsert      bool
+	Where       []Filter /* skip the document unless it also matches, for updates without Upsert */
+}
+
+// FundamentalStore is the instruments response per symbol, kept in Macros
+// with the fields other packages add, like universe and signal
+type FundamentalStore interface {
+	Finder
+	Upsert(symbol string, instrument *Instrument) error
+	SetMarketCap(symbol string, marketCap float64) error /* all that's kept for small caps */
+	Get(symbol string) (*Instrument, error)              /* nil when nothing is stored */
+	Update(updates map[string]FieldUpdate) error         /* by symbol */
+}
+
+// SnapshotStore is the latest price history per symbol for Medium, Short and Signals
+type SnapshotStore interface {
+	Save(work EtlJob, ph *PriceHistory) error
+	Get(work EtlJob, symbol string) (*PriceHistory, error) /* nil when nothing is stored */
+	List(work EtlJob) ([]PriceHistory, error)
+}
+
+type LogStore interface {
+	Insert(category string, msg string) error
+	List(limit int64) ([]LogDocument, error) /* newest first */
+}
+
+type LogDocument struct {
+	Category string    `json:"category" bson:"category"`
+	Msg      string    `json:"msg" bson:"msg"`
+	At       time.Time `json:"at" bson:"at"`
+}
+
+// MongoFilter is the Mongo query matching every filter
+func MongoFilter(filters []Filter) bson.M {
+	query := bson.M{}
+	for _, f := range filters {
+		cond, ok := query[f.Field].(bson.M)
+		if !ok {
+			cond = bson.M{}
+			query[f.Field] = cond
+		}
+		cond["$"+f.Op] = f.Value
+	}
+	return query
+}
+
+type documents struct {
+	collection *mongo.Collection
+}
+
+func NewDocumentStore(mg *mongo.Database, collection string) DocumentStore {
+	return &documents{collection: mg.Collection(collection)}
+}
+
+func (d *documents) Find(query Query, docs interface{}) error {
+	opts := options.Find().SetSkip(query.Skip)
+	if query.Limit > 0 {
+		opts.SetLimit(query.Limit)
+	}
+	if len(query.Sort) > 0 {
+		sort := bson.D{}
+		for _, field := range query.Sort {
+			order := 1
+			if field[0] == '-' {
+				field, order = field[1:], -1
+			}
+			sort = append(sort, bson.E{Key: field, Value: order})
+		}
+		opts.SetSort(sort)
+	}
+	cursor, err := d.collection.Find(context.TODO(), MongoFilter(query.Filters), opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(context.TODO(), docs)
+}
+
+func (d *documents) Count(filters ...Filter) (int64, error) {
+	return d.collection.CountDocuments(context.TODO(), MongoFilter(filters))
+}
+
+func (d *documents) Insert(docs ...interface{}) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	_, err := d.collection.InsertMany(context.TODO(), docs)
+	return err
+}
+
+func (d *documents) Replace(id string, doc interface{}) error {
+	_, err := d.collection.ReplaceOne(context.TODO(), bson.M{"_id": id}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+type fundamentals struct {
+	documents /* Macros */
+}
+
+func NewFundamentalStore(mg *mongo.Database) FundamentalStore {
+	return &fundamentals{documents{collection: mg.Collection(Macros)}}
+}
+
+func (f *fundamentals) Upsert(symbol string, instrument *Instrument) error {
+	_, err := f.collection.UpdateOne(context.TODO(),
+		bson.M{"symbol": symbol},
+		bson.M{"$set": instrument},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (f *fundamentals) SetMarketCap(symbol string, marketCap float64) error {
+	_, err := f.collection.UpdateOne(context.TODO(),
+		bson.M{"symbol": symbol},
+		bson.M{"$set": bson.M{"marketCap": marketCap}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (f *fundamentals) Get(symbol string) (*Instrument, error) {
+	var instrument Instrument
+	err := f.collection.FindOne(context.TODO(), bson.M{"symbol": symbol}).Decode(&instrument)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrument, nil
+}
+
+func (f *fundamentals) Update(updates map[string]FieldUpdate) error {
+	var operations []mongo.WriteModel
+	for symbol, u := range updates {
+		update := bson.M{}
+		if len(u.Set) > 0 {
+			update["$set"] = u.Set
+		}
+		if len(u.Unset) > 0 {
+			unset := bson.M{}
+			for _, field := range u.Unset {
+				unset[field] = ""
+			}
+			update["$unset"] = unset
+		}
+		if len(u.SetOnInsert) > 0 {
+			update["$setOnInsert"] = u.SetOnInsert
+		}
+		if len(update) == 0 {
+			continue
+		}
+		filter := MongoFilter(u.Where)
+		filter["symbol"] = symbol
+		operations = append(operations, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(update).
+			SetUpsert(u.Upsert))
+	}
+	if len(operations) == 0 {
+		return nil
+	}
+	_, err := f.collection.BulkWrite(context.TODO(), operations, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+type snapshots struct {
+	collections map[EtlJob]*mongo.Collection
+}
+
+func NewSnapshotStore(mg *mongo.Database) SnapshotStore {
+	return &snapshots{collections: map[EtlJob]*mongo.Collection{
+		Medium:  mg.Collection(Medium),
+		Short:   mg.Collection(Short),
+		Signals: mg.Collection(Signals),
+	}}
+}
+
+func (s *snapshots) collection(work EtlJob) (*mongo.Collection, error) {
+	collection, ok := s.collections[work]
+	if !ok {
+		return nil, errors.New("no snapshots for work: " + string(work))
+	}
+	return collection, nil
+}
+
+func (s *snapshots) Save(work EtlJob, ph *PriceHistory) error {
+	collection, err := s.collection(work)
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateOne(context.TODO(),
+		bson.M{"symbol": ph.Symbol},
+		bson.M{"$set": ph},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *snapshots) Get(work EtlJob, symbol string) (*PriceHistory, error) {
+	collection, err := s.collection(work)
+	if err != nil {
+		return nil, err
+	}
+	var ph PriceHistory
+	err = collection.FindOne(context.TODO(), bson.M{"symbol": symbol}).Decode(&ph)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ph, nil
+}
+
+func (s *snapshots) List(work EtlJob) ([]PriceHistory, error) {
+	collection, err := s.collection(work)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var docs []PriceHistory
+	if err := cursor.All(context.TODO(), &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+type logs struct {
+	logs *mongo.Collection
+}
+
+func NewLogStore(mg *mongo.Database) LogStore {
+	return &logs{logs: mg.Collection(Logs)}
+}
+
+func (l *logs) Insert(category string, msg string) error {
+	_, err := l.logs.InsertOne(context.TODO(), LogDocument{Category: category, Msg: msg, At: time.Now()})
+	return err
+}
+
+func (l *logs) List(limit int64) ([]LogDocument, error) {
+	cursor, err := l.logs.Find(context.TODO(), bson.M{"msg": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	var docs []LogDocument
+	if err := cursor.All(context.TODO(), &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
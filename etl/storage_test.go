@@ -0,0 +1,398 @@
+package etl
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/jaredtokuz/market-trader/fakeapi"
+	"github.com/jaredtokuz/market-trader/marketdata"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	testStoreQueue(t, NewMemoryStore())
+}
+
+func TestBoltQueue(t *testing.T) {
+	testStoreQueue(t, setBoltStore(t))
+}
+
+// testStoreQueue checks a backend's queue behaves like the Mongo one
+func testStoreQueue(t *testing.T, store *Store) {
+	store.ApiQueue.Enqueue([]string{"TSLA", "MSFT", "TSLA"}, Macros)
+	depth, _ := store.ApiQueue.Depth()
+	if len(depth) != 1 || depth[0].Count != 2 {
+		t.Fatal("Enqueue should skip symbols already queued ", depth)
+	}
+
+	first, _ := store.ApiQueue.Claim("worker-a", time.Minute)
+	second, _ := store.ApiQueue.Claim("worker-b", time.Minute)
+	if first == nil || second == nil || first.Symbol == second.Symbol {
+		t.Fatal("Expected each worker to claim a different job ", first, second)
+	}
+	if job, _ := store.ApiQueue.Claim("worker-c", time.Minute); job != nil {
+		t.Error("Leased jobs should not be claimable")
+	}
+	if err := store.ApiQueue.Heartbeat(EtlConfig{Symbol: first.Symbol, Work: Macros, WorkerID: "worker-c"}, time.Minute); err != ErrLeaseLost {
+		t.Error("Heartbeat from a non owner should fail ", err)
+	}
+	store.ApiQueue.Heartbeat(*first, -time.Second)
+	reclaimed, _ := store.ApiQueue.Claim("worker-c", time.Minute)
+	if reclaimed == nil || reclaimed.Symbol != first.Symbol || reclaimed.Attempts != 2 {
+		t.Fatal("Expired lease was not reclaimed ", reclaimed)
+	}
+
+	if _, err := store.ApiQueue.Fail(*first, errors.New(SERVER_ERROR), 3); err != ErrLeaseLost {
+		t.Error("Retry from a worker that lost the lease should fail ", err)
+	}
+	if dead, err := store.ApiQueue.Fail(*first, StatusError{StatusCode: 404}, 3); err != ErrLeaseLost || dead {
+		t.Error("A worker that lost the lease should not dead letter the job ", err)
+	}
+	dead, err := store.ApiQueue.Fail(*reclaimed, errors.New(SERVER_ERROR), 3)
+	if err != nil || dead {
+		t.Error("Retryable failure should be released ", err)
+	}
+	dead, err = store.ApiQueue.Fail(*second, StatusError{StatusCode: 404}, 3)
+	if err != nil || !dead {
+		t.Error("404 should be dead lettered immediately ", err)
+	}
+	docs, _ := store.DeadLetters.List(JobFilter{Work: Macros}, 10)
+	if len(docs) != 1 || docs[0].Symbol != second.Symbol {
+		t.Fatal("Dead letter not found ", docs)
+	}
+	if n, _ := store.DeadLetters.Requeue(JobFilter{Symbol: second.Symbol}); n != 1 {
+		t.Error("Requeue failed ", n)
+	}
+	depth, _ = store.ApiQueue.Depth()
+	if len(depth) != 1 || depth[0].Stage != Api || depth[0].Count != 2 {
+		t.Error("Both jobs should be waiting again ", depth)
+	}
+
+	claimed, _ := store.ApiQueue.Claim("worker-d", time.Minute)
+	if n, _ := store.ApiQueue.Cancel([]string{"TSLA", "MSFT"}); n != 1 {
+		t.Error("Cancel should skip the claimed job ", n)
+	}
+	depth, _ = store.ApiQueue.Depth()
+	if claimed == nil || len(depth) != 1 || depth[0].Stage != InFlight {
+		t.Error("Only the claimed job should be left ", depth)
+	}
+}
+
+func TestMemoryDocuments(t *testing.T) {
+	testStoreDocuments(t, NewMemoryStore())
+}
+
+func TestBoltDocuments(t *testing.T) {
+	testStoreDocuments(t, setBoltStore(t))
+}
+
+// testStoreDocuments checks a backend answers Macros queries and updates like Mongo
+func testStoreDocuments(t *testing.T, store *Store) {
+	for symbol, volume := range map[string]float64{"TSLA": 3e6, "MSFT": 1e6, "AAPL": 5e6} {
+		symbol, volume := symbol, volume
+		store.Fundamentals.Upsert(symbol, &Instrument{Symbol: &symbol, Fundamental: Fundamental{Vol10DayAvg: &volume}})
+	}
+	listed := time.Date(2023, 2, 8, 0, 0, 0, 0, time.UTC)
+	err := store.Fundamentals.Update(map[string]FieldUpdate{
+		"AAPL": {Set: bson.M{"universe": bson.M{"status": "delisted", "listedAt": listed}}},
+		"GME":  {Set: bson.M{"universe.status": "active"}, SetOnInsert: bson.M{"onInsertDate": listed}, Upsert: true},
+		"NONE": {Set: bson.M{"signal": true}},
+	})
+	if err != nil {
+		t.Fatal("Update failed ", err)
+	}
+	volume := 6e6
+	aapl := "AAPL"
+	store.Fundamentals.Upsert("AAPL", &Instrument{Symbol: &aapl, Fundamental: Fundamental{Vol10DayAvg: &volume}})
+
+	var docs []SymbolDoc
+	err = store.Fundamentals.Find(Query{Filters: []Filter{
+		{Field: "fundamental.vol10DayAvg", Op: "gt", Value: 2000000},
+		{Field: "universe.status", Op: "ne", Value: "delisted"},
+	}}, &docs)
+	if err != nil || len(docs) != 1 || docs[0].Symbol != "TSLA" {
+		t.Error("Expected only TSLA to pass the screen ", docs, err)
+	}
+
+	var full []bson.M
+	store.Fundamentals.Find(Query{Sort: []string{"-fundamental.vol10DayAvg"}, Skip: 1, Limit: 2}, &full)
+	if len(full) != 2 || full[0]["symbol"] != "TSLA" || full[1]["symbol"] != "MSFT" {
+		t.Error("Unexpected sorted page ", full)
+	}
+	store.Fundamentals.Find(Query{Filters: []Filter{{Field: "symbol", Op: "in", Value: []string{"AAPL", "GME", "NONE"}}}, Sort: []string{"symbol"}}, &full)
+	if len(full) != 2 || full[0]["universe"].(bson.M)["status"] != "delisted" || full[1]["onInsertDate"] == nil {
+		t.Fatal("Update should keep AAPL's universe and only upsert GME ", full)
+	}
+	if fundamental := full[0]["fundamental"].(bson.M); fundamental["vol10DayAvg"] != 6e6 {
+		t.Error("Expected the latest AAPL fundamentals ", fundamental)
+	}
+	if n, _ := store.Fundamentals.Count(Filter{Field: "universe.listedAt", Op: "lt", Value: listed.Add(time.Hour)}); n != 1 {
+		t.Error("Expected dates to compare ", n)
+	}
+	store.Fundamentals.Update(map[string]FieldUpdate{
+		"AAPL": {Set: bson.M{"signal": true}, Where: []Filter{{Field: "universe.status", Op: "eq", Value: "active"}}},
+		"GME":  {Set: bson.M{"signal": true}, Where: []Filter{{Field: "universe.status", Op: "eq", Value: "active"}}},
+	})
+	if n, _ := store.Fundamentals.Count(Filter{Field: "signal", Op: "eq", Value: true}); n != 1 {
+		t.Error("Expected Where to skip AAPL and update GME ", n)
+	}
+	store.Fundamentals.Update(map[string]FieldUpdate{"AAPL": {Unset: []string{"universe.status"}}})
+	if n, _ := store.Fundamentals.Count(Filter{Field: "universe.status", Op: "exists", Value: true}); n != 1 {
+		t.Error("Expected AAPL's status unset ", n)
+	}
+
+	history := store.Documents("SignalHistory")
+	history.Insert(bson.M{"symbol": "TSLA", "at": listed}, bson.M{"symbol": "MSFT", "at": listed.Add(time.Hour)})
+	var latest []bson.M
+	if err := history.Find(Query{Sort: []string{"-at"}, Limit: 1}, &latest); err != nil || len(latest) != 1 || latest[0]["symbol"] != "MSFT" {
+		t.Error("Expected the newest history first ", latest, err)
+	}
+	ledger := store.Documents("DailyImports")
+	ledger.Replace("NASDAQ_20230208.csv", bson.M{"rows": 1})
+	ledger.Replace("NASDAQ_20230208.csv", bson.M{"rows": 2})
+	if n, _ := ledger.Count(Filter{Field: "_id", Op: "eq", Value: "NASDAQ_20230208.csv"}, Filter{Field: "rows", Op: "eq", Value: 2}); n != 1 {
+		t.Error("Replace should keep one document per id ", n)
+	}
+
+	store.Snapshots.Save(Short, &PriceHistory{Symbol: "TSLA"})
+	store.Snapshots.Save(Short, &PriceHistory{Symbol: "MSFT"})
+	store.Snapshots.Save(Medium, &PriceHistory{Symbol: "AAPL"})
+	if shorts, err := store.Snapshots.List(Short); err != nil || len(shorts) != 2 {
+		t.Error("Expected both Short snapshots ", shorts, err)
+	}
+}
+
+func TestMemoryMarketCap(t *testing.T) {
+	testStoreMarketCap(t, NewMemoryStore())
+}
+
+func TestBoltMarketCap(t *testing.T) {
+	testStoreMarketCap(t, setBoltStore(t))
+}
+
+func TestMongoMarketCap(t *testing.T) {
+	needsMongo(t)
+	testStoreMarketCap(t, setController().Store())
+}
+
+// testStoreMarketCap checks every backend keeps small caps at the same path
+func testStoreMarketCap(t *testing.T, store *Store) {
+	volume := 1e6
+	symbol := "TINY"
+	store.Fundamentals.Upsert(symbol, &Instrument{Symbol: &symbol, Fundamental: Fundamental{Vol10DayAvg: &volume}})
+	if err := store.Fundamentals.SetMarketCap(symbol, 300); err != nil {
+		t.Fatal("SetMarketCap failed ", err)
+	}
+	if err := store.Fundamentals.SetMarketCap("NEWCAP", 200); err != nil {
+		t.Fatal("SetMarketCap failed ", err)
+	}
+
+	var docs []bson.M
+	err := store.Fundamentals.Find(Query{Filters: []Filter{
+		{Field: "symbol", Op: "in", Value: []string{symbol, "NEWCAP"}},
+		{Field: "marketCap", Op: "lt", Value: 500},
+	}, Sort: []string{"symbol"}}, &docs)
+	if err != nil || len(docs) != 2 || docs[0]["symbol"] != "NEWCAP" || docs[1]["marketCap"] != 300.0 {
+		t.Fatal("Expected both small caps by their top level marketCap ", docs, err)
+	}
+	if fundamental := docs[1]["fundamental"].(bson.M); fundamental["marketCap"] != nil || fundamental["vol10DayAvg"] != 1e6 {
+		t.Error("SetMarketCap should leave the fundamentals alone ", fundamental)
+	}
+}
+
+func TestMemoryPipeline(t *testing.T) {
+	testStorePipeline(t, NewMemoryStore())
+}
+
+func TestBoltPipeline(t *testing.T) {
+	testStorePipeline(t, setBoltStore(t))
+}
+
+func setBoltStore(t *testing.T) *Store {
+	store, err := NewBoltStore(path.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal("NewBoltStore failed ", err)
+	}
+	return store
+}
+
+func TestBoltStoreLocked(t *testing.T) {
+	file := path.Join(t.TempDir(), "test.db")
+	if _, err := NewBoltStore(file); err != nil {
+		t.Fatal("NewBoltStore failed ", err)
+	}
+	if _, err := NewBoltStore(file); !errors.Is(err, ErrStoreLocked) {
+		t.Error("Expected a second open to fail with ErrStoreLocked ", err)
+	}
+}
+
+// testStorePipeline runs the worker pool against the fake api without a database server
+func testStorePipeline(t *testing.T, store *Store) {
+	server := httptest.NewServer(fakeapi.New(fakeapi.Config{}))
+	defer server.Close()
+	td := NewTDApiService(store, marketdata.NewTDAmeritrade(server.URL+"/v1", "fake", staticToken("fake")))
+
+	symbols := []string{"TSLA", "MSFT", "AAPL"}
+	store.ApiQueue.Enqueue(symbols, Macros)
+	store.ApiQueue.Enqueue(symbols, Short)
+	if err := RunWorkerPool(store, td, WorkerConfig{Fetchers: 2, Loaders: 2, MaxAttempts: 3}); err != nil {
+		t.Fatal("RunWorkerPool failed ", err)
+	}
+
+	if depth, _ := store.ApiQueue.Depth(); len(depth) != 0 {
+		t.Error("Queue should be drained ", depth)
+	}
+	for _, symbol := range symbols {
+		if instrument, err := store.Fundamentals.Get(symbol); err != nil || instrument == nil {
+			t.Error("Fundamentals not loaded for ", symbol, err)
+		}
+		if ph, err := store.Snapshots.Get(Short, symbol); err != nil || ph == nil || len(ph.Candles) == 0 {
+			t.Error("Short snapshot not loaded for ", symbol, err)
+		}
+		if last, err := store.Candles.Last(symbol, JobTimeframe(Short)); err != nil || last == nil {
+			t.Error("Candles not loaded for ", symbol, err)
+		}
+	}
+	if calls, _ := store.ApiCalls.List(Short); len(calls) != len(symbols) {
+		t.Error("Expected every Short response cached ", len(calls))
+	}
+}
+
+func TestBoltCandles(t *testing.T) {
+	store := setBoltStore(t)
+	day := time.Date(2023, 2, 8, 14, 30, 0, 0, time.UTC)
+	bar := func(minutes int, close float64) Candle {
+		return Candle{Datetime: uint64(day.Add(time.Duration(minutes) * time.Minute).UnixMilli()), Close: close}
+	}
+	store.Candles.Upsert("TSLA", Minute15, []Candle{bar(30, 3), bar(0, 1), bar(15, 2)})
+	// an overlapping fetch replaces the partial last bar
+	store.Candles.Upsert("TSLA", Minute15, []Candle{bar(30, 3.5), bar(45, 4)})
+
+	candles, err := store.Candles.Range("TSLA", Minute15, day, day.Add(45*time.Minute))
+	if err != nil || len(candles) != 3 {
+		t.Fatal("Expected 3 candles in range ", candles, err)
+	}
+	for i, close := range []float64{1, 2, 3.5} {
+		if candles[i].Close != close {
+			t.Error("Candles out of order or not merged ", candles)
+		}
+	}
+	last, err := store.Candles.Last("TSLA", Minute15)
+	if err != nil || last == nil || last.Close != 4 {
+		t.Error("Expected the 45 minute bar last ", last, err)
+	}
+	if last, _ := store.Candles.Last("MSFT", Minute15); last != nil {
+		t.Error("Expected no candles for MSFT ", last)
+	}
+}
+
+// flakySnapshots fails the first save for every symbol, after the fetchers
+// may already have found nothing left to claim
+type flakySnapshots struct {
+	SnapshotStore
+	mu     sync.Mutex
+	failed map[string]bool
+}
+
+func (f *flakySnapshots) Save(work EtlJob, ph *PriceHistory) error {
+	f.mu.Lock()
+	first := !f.failed[ph.Symbol]
+	f.failed[ph.Symbol] = true
+	f.mu.Unlock()
+	if first {
+		return errors.New("snapshot write failed")
+	}
+	return f.SnapshotStore.Save(work, ph)
+}
+
+func TestWorkerPoolRetriesInSameRun(t *testing.T) {
+	server := httptest.NewServer(fakeapi.New(fakeapi.Config{}))
+	defer server.Close()
+	store := NewMemoryStore()
+	store.Snapshots = &flakySnapshots{SnapshotStore: store.Snapshots, failed: map[string]bool{}}
+	td := NewTDApiService(store, marketdata.NewTDAmeritrade(server.URL+"/v1", "fake", staticToken("fake")))
+
+	symbols := []string{"TSLA"}
+	store.ApiQueue.Enqueue(symbols, Short)
+	if err := RunWorkerPool(store, td, WorkerConfig{Fetchers: 1, Loaders: 1, MaxAttempts: 3}); err != nil {
+		t.Fatal("RunWorkerPool failed ", err)
+	}
+	if depth, _ := store.ApiQueue.Depth(); len(depth) != 0 {
+		t.Error("Released jobs should be retried before the pool exits ", depth)
+	}
+	for _, symbol := range symbols {
+		if ph, _ := store.Snapshots.Get(Short, symbol); ph == nil {
+			t.Error("Snapshot not loaded after retry for ", symbol)
+		}
+	}
+}
+
+/* a queue whose database is unreachable */
+type brokenQueue struct {
+	ApiQueueService
+}
+
+func (q brokenQueue) Claim(workerID string, lease time.Duration) (*EtlConfig, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestWorkerPoolReturnsQueueErrors(t *testing.T) {
+	store := NewMemoryStore()
+	store.ApiQueue.Enqueue([]string{"TSLA"}, Short)
+	store.ApiQueue = brokenQueue{store.ApiQueue}
+	err := RunWorkerPool(store, nil, WorkerConfig{Fetchers: 2, Loaders: 1, MaxAttempts: 3})
+	if err == nil || err.Error() != "connection refused" {
+		t.Error("Expected the claim error instead of a drained queue ", err)
+	}
+}
+
+/* a snapshot store slower than the lease */
+type slowSnapshots struct {
+	SnapshotStore
+	delay time.Duration
+}
+
+func (s slowSnapshots) Save(work EtlJob, ph *PriceHistory) error {
+	time.Sleep(s.delay)
+	return s.SnapshotStore.Save(work, ph)
+}
+
+/* counts api calls by symbol */
+type countingApi struct {
+	TDApiService
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *countingApi) Call(etlConfig EtlConfig) (ApiCallSuccess, error) {
+	c.mu.Lock()
+	c.calls[etlConfig.Symbol]++
+	c.mu.Unlock()
+	return c.TDApiService.Call(etlConfig)
+}
+
+func TestWorkerPoolKeepsLeaseUntilLoaded(t *testing.T) {
+	t.Setenv("QUEUE_LEASE", "150ms")
+	poll := idlePoll
+	idlePoll = 10 * time.Millisecond
+	defer func() { idlePoll = poll }()
+
+	server := httptest.NewServer(fakeapi.New(fakeapi.Config{}))
+	defer server.Close()
+	store := NewMemoryStore()
+	store.Snapshots = slowSnapshots{SnapshotStore: store.Snapshots, delay: 500 * time.Millisecond}
+	td := &countingApi{TDApiService: NewTDApiService(store, marketdata.NewTDAmeritrade(server.URL+"/v1", "fake", staticToken("fake"))), calls: map[string]int{}}
+
+	store.ApiQueue.Enqueue([]string{"TSLA"}, Short)
+	if err := RunWorkerPool(store, td, WorkerConfig{Fetchers: 2, Loaders: 1, MaxAttempts: 3}); err != nil {
+		t.Fatal("RunWorkerPool failed ", err)
+	}
+	if td.calls["TSLA"] != 1 {
+		t.Error("A job waiting on a slow load should not be fetched again ", td.calls)
+	}
+}
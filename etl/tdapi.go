@@ -1,21 +1,15 @@
 package etl
 
 import (
-	"fmt"
-
 	"github.com/montanaflynn/stats"
-)
 
-const TDA_BASE_URL = "https://api.tdameritrade.com/v1"
-const InstrumentsUrl = TDA_BASE_URL + "/instruments"
+	"github.com/jaredtokuz/market-trader/indicators"
+	"github.com/jaredtokuz/market-trader/shared"
+)
 
 const UNAUTHORIZED = "unauthorized"
 const SERVER_ERROR = "server error"
 
-func PriceHistoryUrl(symbol string) string {
-	return fmt.Sprintf(TDA_BASE_URL+"/marketdata/%v/pricehistory", symbol)
-}
-
 func calculatePriceHistory(ph PriceHistory) (*PriceHistory, error) {
 	var volumeList []int
 	for _, candle := range ph.Candles {
@@ -44,11 +38,13 @@ func calculatePriceHistory(ph PriceHistory) (*PriceHistory, error) {
 		})
 	}
 
+	snapshot := indicators.Compute(adjCandles)
 	adjph := PriceHistory{
 		Symbol:     ph.Symbol,
 		Candles:    adjCandles,
 		MeanVolume: int(meanVol),
 		StdVolume:  int(stdVol),
+		Indicators: &snapshot,
 	}
 
 	return &adjph, nil
@@ -64,18 +60,12 @@ func Round(number float64) float64 {
 	return n
 }
 
-type Candle struct {
-	Datetime uint64  `json:"datetime" bson:"datetime"`
-	Close    float64 `json:"close" bson:"close"`
-	High     float64 `json:"high" bson:"high"`
-	Low      float64 `json:"low" bson:"low"`
-	Open     float64 `json:"open" bson:"open"`
-	Volume   int     `json:"volume" bson:"volume"`
-}
+type Candle = shared.Candle
 
 type PriceHistory struct {
-	Candles    []Candle `json:"candles" bson:"candles"`
-	Symbol     string   `json:"symbol" bson:"symbol"`
-	MeanVolume int      `json:"meanVolume" bson:"meanVolume"`
-	StdVolume  int      `json:"stdVolume" bson:"stdVolume"`
+	Candles    []Candle             `json:"candles" bson:"candles"`
+	Symbol     string               `json:"symbol" bson:"symbol"`
+	MeanVolume int                  `json:"meanVolume" bson:"meanVolume"`
+	StdVolume  int                  `json:"stdVolume" bson:"stdVolume"`
+	Indicators *indicators.Snapshot `json:"indicators,omitempty" bson:"indicators,omitempty"` /* latest values over Candles */
 }
@@ -1,127 +1,175 @@
 package etl
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/avast/retry-go"
-	"github.com/jaredtokuz/market-trader/shared"
-	"github.com/jaredtokuz/market-trader/token"
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/marketdata"
 )
 
+// TD Ameritrade allows 120 requests per minute per api key
+const DefaultRequestsPerMinute = 120
+
+// RequestTimeout bounds a single api request, a hung connection would
+// otherwise hold the job's lease until it expires
+const RequestTimeout = 30 * time.Second
+
 type tdapiconfig struct {
-	mongo  *MongoController
-	apikey string
-	token  token.AccessTokenService
+	store    *Store
+	provider marketdata.MarketDataProvider
+	limiter  RateLimiter /* shared by every process using the api key */
 }
 
 type TDApiService interface {
 	Call(etlConfig EtlConfig) (ApiCallSuccess, error)                                       /* Makes a request */
-	AddAuth(req *http.Request)                                                              /* helper */
-	AddApiKey(req *url.Values)                                                              /* helper */
+	Quotes(symbols []string) (map[string]interface{}, error)                                /* Latest quotes keyed by symbol */
 	InsertResponse(etlConfig EtlConfig, resp *http.Response, decodedBody interface{}) error /* log api response */
 }
 
 func NewTDApiService(
-	mongo *MongoController,
-	apikey string,
-	token token.AccessTokenService,
+	store *Store,
+	provider marketdata.MarketDataProvider,
 ) TDApiService {
-	return &tdapiconfig{mongo: mongo, apikey: apikey, token: token}
+	return &tdapiconfig{
+		store:    store,
+		provider: provider,
+		limiter:  store.RateLimiter(provider.Name()+"api", RequestsPerMinute()),
+	}
 }
 
-func (i *tdapiconfig) Call(etlConfig EtlConfig) (ApiCallSuccess, error) {
-	// retryClient := retryablehttp.NewClient() //.Backoff(time.Duration(2)*time.Second, time.Duration(5)*time.Second, 5, resp) //LinearJitterBackoff(time.Duration(1)*time.Second, time.Duration(3)*time.Second, 5, resp)
-
-	// retryClient.RetryMax = 4
-	// retryClient.RetryWaitMin = time.Duration(1) * time.Second
-	// retryClient.RetryWaitMin = time.Duration(3) * time.Second
+/* trading sessions of price history fetched per job */
+var jobSessions = map[EtlJob]int{
+	Medium:  10,
+	Short:   2,
+	Signals: 1,
+}
 
-	// client := retryClient.StandardClient() // convert to *http.Client
-	client := &http.Client{}
+// SessionWindow spans the pre market open of the job's first session to the
+// post market close of the latest one that has begun by now
+func SessionWindow(work EtlJob, now time.Time) (time.Time, time.Time) {
+	n := jobSessions[work]
+	if n == 0 {
+		n = 1
+	}
+	sessions := calendar.LastSessions(now, n)
+	return sessions[0].PreOpen, sessions[n-1].PostClose
+}
 
-	var (
-		body map[string]interface{}
-	)
-	err := retry.Do(
-		func() error {
-			var (
-				req *http.Request
-				err error
-			)
-			// Dynamically set url/method
-			switch etlConfig.Work {
-			case Macros:
-				req, err = http.NewRequest("GET", InstrumentsUrl, nil)
-			case Medium, Short, Signals:
-				req, err = http.NewRequest("GET", PriceHistoryUrl(etlConfig.Symbol), nil)
-			}
-			query := req.URL.Query()
-			i.AddAuth(req)
-			i.AddApiKey(&query)
+func (i *tdapiconfig) Call(etlConfig EtlConfig) (ApiCallSuccess, error) {
+	kind := marketdata.PriceHistoryKind
+	if etlConfig.Work == Macros {
+		kind = marketdata.FundamentalsKind
+	}
 
-			// Dynamically add query params
+	body, err := i.do(
+		func() (*http.Request, error) {
+			// Dynamically set url/method and query params
 			switch etlConfig.Work {
 			case Macros:
-				query.Add("projection", "fundamental")
-				query.Add("symbol", etlConfig.Symbol)
+				return i.provider.Fundamentals(etlConfig.Symbol)
 			case Medium:
-				endDate := shared.NextDay(shared.Bod(time.Now()))
-				startDate := endDate.AddDate(0, 0, -15)
-				i.AddFetchPriceHistoryQuery(&query, PriceHistoryQuery{
-					periodType:            "day",
-					frequencyType:         "minute",
-					frequency:             "30",
-					startDate:             stringFormatDate(startDate),
-					endDate:               stringFormatDate(endDate),
-					needExtendedHoursData: "true",
+				startDate, endDate := SessionWindow(Medium, time.Now())
+				return i.provider.PriceHistory(etlConfig.Symbol, marketdata.PriceHistoryQuery{
+					PeriodType:            "day",
+					FrequencyType:         "minute",
+					Frequency:             30,
+					StartDate:             startDate,
+					EndDate:               endDate,
+					NeedExtendedHoursData: true,
 				})
 			case Short, Signals:
-				endDate := shared.NextDay(shared.Bod(time.Now()))
-				startDate := endDate.Add(time.Hour * -14)
-				i.AddFetchPriceHistoryQuery(&query, PriceHistoryQuery{
-					periodType:            "day",
-					frequencyType:         "minute",
-					frequency:             "15",
-					startDate:             stringFormatDate(startDate),
-					endDate:               stringFormatDate(endDate),
-					needExtendedHoursData: "true",
+				startDate, endDate := SessionWindow(etlConfig.Work, time.Now())
+				return i.provider.PriceHistory(etlConfig.Symbol, marketdata.PriceHistoryQuery{
+					PeriodType:            "day",
+					FrequencyType:         "minute",
+					Frequency:             15,
+					StartDate:             startDate,
+					EndDate:               endDate,
+					NeedExtendedHoursData: true,
 				})
 			}
+			return nil, errors.New("no api call for work: " + string(etlConfig.Work))
+		},
+		func(resp *http.Response, body map[string]interface{}) {
+			i.InsertResponse(etlConfig, resp, body)
+		},
+	)
 
-			req.URL.RawQuery = query.Encode()
-			resp, err := client.Do(req)
-			if err != nil {
-				panic(err)
-			}
+	if err != nil {
+		return ApiCallSuccess{}, err
+	}
 
-			defer resp.Body.Close()
-			err = json.NewDecoder(resp.Body).Decode(&body)
-			i.InsertResponse(etlConfig, resp, body)
-			if resp.StatusCode >= 400 {
-				if resp.StatusCode == 401 {
-					return errors.New(UNAUTHORIZED)
+	log.Println("Api call success: ", etlConfig.Symbol)
+
+	return CreateApiSuccess(i.provider.Normalize(kind, body), etlConfig), nil
+}
+
+func (i *tdapiconfig) Quotes(symbols []string) (map[string]interface{}, error) {
+	body, err := i.do(
+		func() (*http.Request, error) {
+			return i.provider.Quotes(symbols)
+		},
+		func(resp *http.Response, body map[string]interface{}) {},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return i.provider.Normalize(marketdata.QuotesKind, body), nil
+}
+
+// do sends the request built by newRequest, retrying server errors and 429s
+// with backoff. A 401 refreshes the token and is retried once straight away.
+// Every attempt waits on the rate limiter and is passed to record.
+func (i *tdapiconfig) do(
+	newRequest func() (*http.Request, error),
+	record func(resp *http.Response, body map[string]interface{}),
+) (map[string]interface{}, error) {
+	client := &http.Client{Timeout: RequestTimeout}
+
+	var (
+		body         map[string]interface{}
+		reauthorized bool
+	)
+	err := retry.Do(
+		func() error {
+			for {
+				req, err := newRequest()
+				if err != nil {
+					return err
 				}
-				if resp.StatusCode == 429 {
-					return errors.New(SERVER_ERROR)
+
+				if err := i.limiter.Wait(context.TODO()); err != nil {
+					return err
 				}
-				if resp.StatusCode >= 500 {
-					return errors.New(SERVER_ERROR)
+				resp, err := client.Do(req)
+				if err != nil {
+					// not retried here, the queue retries or dead letters the job
+					return err
 				}
-				return errors.New("Api call failed with status code: " + strconv.Itoa(resp.StatusCode))
-			}
 
-			if err != nil {
+				body = nil
+				err = json.NewDecoder(resp.Body).Decode(&body)
+				resp.Body.Close()
+				record(resp, body)
+				if resp.StatusCode == http.StatusUnauthorized && !reauthorized {
+					// the token can be revoked before it expires
+					reauthorized = true
+					i.provider.Unauthorized(req)
+					continue
+				}
+				if resp.StatusCode >= 400 {
+					return statusError(resp.StatusCode)
+				}
 				return err
 			}
-
-			return nil
 		},
 		retry.RetryIf(func(err error) bool {
 			if err.Error() == SERVER_ERROR {
@@ -130,6 +178,7 @@ func (i *tdapiconfig) Call(etlConfig EtlConfig) (ApiCallSuccess, error) {
 			return false
 		}),
 		retry.Attempts(10),
+		retry.LastErrorOnly(true),
 		retry.OnRetry(func(n uint, err error) {
 			log.Printf("Retrying request after error: %v", err)
 		}),
@@ -139,41 +188,37 @@ func (i *tdapiconfig) Call(etlConfig EtlConfig) (ApiCallSuccess, error) {
 			return retry.BackOffDelay(n, err, config) + (time.Millisecond * 750 * (time.Duration(n * 16 / 10))) + (1 * time.Second)
 		}),
 	)
-
 	if err != nil {
-		return ApiCallSuccess{}, err
+		return nil, err
 	}
-
-	log.Println("Api call success: ", etlConfig.Symbol)
-
-	return CreateApiSuccess(body, etlConfig), nil
+	return body, nil
 }
 
-func (i *tdapiconfig) AddAuth(req *http.Request) {
-	req.Header.Add("Authorization", "Bearer "+i.token.Fetch())
+// statusError maps a failed response to the error do retries on, or a
+// StatusError when retrying won't help
+func statusError(status int) error {
+	if status == 401 {
+		return errors.New(UNAUTHORIZED)
+	}
+	if status == 429 || status >= 500 {
+		return errors.New(SERVER_ERROR)
+	}
+	return StatusError{StatusCode: status}
 }
 
-func (i *tdapiconfig) AddApiKey(query *url.Values) {
-	query.Add("apikey", i.apikey)
+// StatusError is an api response that retrying won't fix, ex 404 on a delisted symbol
+type StatusError struct {
+	StatusCode int
 }
 
-type PriceHistoryQuery struct {
-	periodType            string // default day
-	frequencyType         string // ex minute, daily
-	frequency             string // int ex 5
-	startDate             string // unix mseconds int
-	endDate               string // unix mseconds int
-	needExtendedHoursData string // bool
+func (e StatusError) Error() string {
+	return "Api call failed with status code: " + strconv.Itoa(e.StatusCode)
 }
 
-func (i *tdapiconfig) AddFetchPriceHistoryQuery(query *url.Values, p PriceHistoryQuery) {
-	query.Add("periodType", p.periodType)
-	query.Add("frequencyType", p.frequencyType)
-	query.Add("frequency", p.frequency)
-	query.Add("startDate", p.startDate)
-	query.Add("endDate", p.endDate)
-	query.Add("needExtendedHoursData", p.needExtendedHoursData)
-
+// IsPermanent reports whether the job should be dead lettered without further attempts
+func IsPermanent(err error) bool {
+	var statusErr StatusError
+	return errors.As(err, &statusErr) || errors.Is(err, ErrNotRecorded)
 }
 
 // log the api calls in table for transparency and analysis
@@ -186,7 +231,7 @@ func (i *tdapiconfig) InsertResponse(etlConfig EtlConfig, resp *http.Response, d
 			Path:   resp.Request.URL.Path,
 		},
 	}
-	err := i.mongo.ApiCalls.Cache(etlConfig, document)
+	err := i.store.ApiCalls.Cache(etlConfig, document)
 	if err != nil {
 		return err
 	}
@@ -201,7 +246,3 @@ type ApiCallSuccess struct {
 func CreateApiSuccess(body map[string]interface{}, etlConfig EtlConfig) ApiCallSuccess {
 	return ApiCallSuccess{Body: body, etlConfig: etlConfig}
 }
-
-func stringFormatDate(t time.Time) string {
-	return strconv.FormatInt(t.Unix()*1000, 10)
-}
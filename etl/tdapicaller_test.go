@@ -0,0 +1,76 @@
+package etl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/fakeapi"
+	"github.com/jaredtokuz/market-trader/marketdata"
+	"github.com/jaredtokuz/market-trader/token"
+)
+
+func TestCallNetworkError(t *testing.T) {
+	server := httptest.NewServer(fakeapi.New(fakeapi.Config{}))
+	server.Close()
+	td := NewTDApiService(NewMemoryStore(), marketdata.NewTDAmeritrade(server.URL+"/v1", "fake", staticToken("fake")))
+	if _, err := td.Call(NewEtlConfig("TSLA", Short)); err == nil || IsPermanent(err) {
+		t.Error("Expected a retryable error instead of a panic ", err)
+	}
+}
+
+// setFakeTokens writes a token file holding accessToken, unexpired, and
+// refreshes it against the fake api
+func setFakeTokens(t *testing.T, serverURL string, accessToken string) token.AccessTokenService {
+	tokenPath := path.Join(t.TempDir(), "token.json")
+	b, _ := json.Marshal(map[string]interface{}{
+		"Headers": map[string]string{"Date": time.Now().UTC().Format(http.TimeFormat)},
+		"Data":    map[string]interface{}{"access_token": accessToken, "refresh_token": "fake-refresh", "expires_in": 1800},
+	})
+	if err := os.WriteFile(tokenPath, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := token.NewAccessTokenService(token.Config{Path: tokenPath, TokenURL: serverURL + "/v1/oauth2/token", ClientID: "fake", RefreshSkew: token.DefaultRefreshSkew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestCallRefreshesRevokedToken(t *testing.T) {
+	// with a TokenTTL the fake only accepts tokens it issued, the one on file was revoked
+	fake := fakeapi.New(fakeapi.Config{TokenTTL: time.Hour})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	tokens := setFakeTokens(t, server.URL, "revoked")
+	td := NewTDApiService(NewMemoryStore(), marketdata.NewTDAmeritrade(server.URL+"/v1", "fake", tokens))
+
+	if _, err := td.Call(NewEtlConfig("TSLA", Short)); err != nil {
+		t.Fatal("Expected the call to succeed after a refresh ", err)
+	}
+	if stats := fake.Stats(); stats.Unauthorized != 1 || stats.Refreshes != 1 {
+		t.Error("Expected one 401 and one refresh ", stats)
+	}
+	if _, err := td.Call(NewEtlConfig("MSFT", Short)); err != nil || fake.Stats().Refreshes != 1 {
+		t.Error("The refreshed token should be reused ", fake.Stats(), err)
+	}
+}
+
+func TestCallUnauthorizedRetriesOnce(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Config{Unauthorized: 1})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	tokens := setFakeTokens(t, server.URL, "fake-access")
+	td := NewTDApiService(NewMemoryStore(), marketdata.NewTDAmeritrade(server.URL+"/v1", "fake", tokens))
+
+	if _, err := td.Call(NewEtlConfig("TSLA", Short)); err == nil || err.Error() != UNAUTHORIZED {
+		t.Error("Expected unauthorized once the refreshed token is rejected too ", err)
+	}
+	if stats := fake.Stats(); stats.Requests != 2 || stats.Refreshes != 1 {
+		t.Error("Expected a single refresh and retry ", stats)
+	}
+}
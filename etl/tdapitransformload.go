@@ -1,143 +1,125 @@
 package etl
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"log"
+	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/jaredtokuz/market-trader/events"
 )
 
-func TransformLoad(mongo MongoController, resp ApiCallSuccess) error {
+// TransformLoad loads the response and removes its job from the queue
+func TransformLoad(store *Store, resp ApiCallSuccess) error {
+	if err := Load(store, resp); err != nil {
+		return err
+	}
+	return store.ApiQueue.Remove(resp.etlConfig)
+}
+
+// Load transforms and saves the response, quarantining a malformed body.
+// It leaves the queue alone, so replays can load without touching live jobs.
+func Load(store *Store, resp ApiCallSuccess) error {
+	var err error
 	switch resp.etlConfig.Work {
 	case Macros:
-		var instrument Instrument
-		b, err := json.Marshal(resp.Body[resp.etlConfig.Symbol])
-		json.Unmarshal(b, &instrument)
-
-		*instrument.Fundamental.MarketCap = Round(*instrument.Fundamental.MarketCap)
-
-		// we exit earlier and save a smaller payload if marketcap is less than 500 million
-		if *instrument.Fundamental.MarketCap < 500 {
-			_, err := mongo.Macros.UpdateOne(context.TODO(),
-				bson.M{"symbol": resp.etlConfig.Symbol},
-				bson.M{"$set": bson.M{"marketCap": instrument.Fundamental.MarketCap}},
-				options.Update().SetUpsert(true))
-			if err != nil {
-				return err
-			}
-			break // exit out of switch
-		}
-
-		{
-			*instrument.Fundamental.High52 = Round(*instrument.Fundamental.High52)
-			*instrument.Fundamental.Low52 = Round(*instrument.Fundamental.Low52)
-			*instrument.Fundamental.DividendAmount = Round(*instrument.Fundamental.DividendAmount)
-			*instrument.Fundamental.DividendYield = Round(*instrument.Fundamental.DividendYield)
-			*instrument.Fundamental.PeRatio = Round(*instrument.Fundamental.PeRatio)
-			*instrument.Fundamental.PegRatio = Round(*instrument.Fundamental.PegRatio)
-			*instrument.Fundamental.PbRatio = Round(*instrument.Fundamental.PbRatio)
-			*instrument.Fundamental.PrRatio = Round(*instrument.Fundamental.PrRatio)
-			*instrument.Fundamental.PcfRatio = Round(*instrument.Fundamental.PcfRatio)
-			*instrument.Fundamental.GrossMarginTTM = Round(*instrument.Fundamental.GrossMarginTTM)
-			*instrument.Fundamental.GrossMarginMRQ = Round(*instrument.Fundamental.GrossMarginMRQ)
-			*instrument.Fundamental.NetProfitMarginTTM = Round(*instrument.Fundamental.NetProfitMarginTTM)
-			*instrument.Fundamental.NetProfitMarginMRQ = Round(*instrument.Fundamental.NetProfitMarginMRQ)
-			*instrument.Fundamental.OperatingMarginTTM = Round(*instrument.Fundamental.OperatingMarginTTM)
-			*instrument.Fundamental.OperatingMarginMRQ = Round(*instrument.Fundamental.OperatingMarginMRQ)
-			*instrument.Fundamental.ReturnOnEquity = Round(*instrument.Fundamental.ReturnOnEquity)
-			*instrument.Fundamental.ReturnOnAssets = Round(*instrument.Fundamental.ReturnOnAssets)
-			*instrument.Fundamental.ReturnOnInvestment = Round(*instrument.Fundamental.ReturnOnInvestment)
-			*instrument.Fundamental.QuickRatio = Round(*instrument.Fundamental.QuickRatio)
-			*instrument.Fundamental.CurrentRatio = Round(*instrument.Fundamental.CurrentRatio)
-			*instrument.Fundamental.InterestCoverage = Round(*instrument.Fundamental.InterestCoverage)
-			*instrument.Fundamental.TotalDebtToCapital = Round(*instrument.Fundamental.TotalDebtToCapital)
-			*instrument.Fundamental.LtDebtToEquity = Round(*instrument.Fundamental.LtDebtToEquity)
-			*instrument.Fundamental.TotalDebtToEquity = Round(*instrument.Fundamental.TotalDebtToEquity)
-			*instrument.Fundamental.EpsTTM = Round(*instrument.Fundamental.EpsTTM)
-			*instrument.Fundamental.EpsChangePercentTTM = Round(*instrument.Fundamental.EpsChangePercentTTM)
-			*instrument.Fundamental.EpsChangeYear = Round(*instrument.Fundamental.EpsChangeYear)
-			*instrument.Fundamental.RevChangeTTM = Round(*instrument.Fundamental.RevChangeTTM)
-			*instrument.Fundamental.MarketCapFloat = Round(*instrument.Fundamental.MarketCapFloat)
-			*instrument.Fundamental.BookValuePerShare = Round(*instrument.Fundamental.BookValuePerShare)
-			*instrument.Fundamental.DividendPayAmount = Round(*instrument.Fundamental.DividendPayAmount)
-			*instrument.Fundamental.Beta = Round(*instrument.Fundamental.Beta)
-		}
-
-		_, err = mongo.Macros.UpdateOne(context.TODO(),
-			bson.M{"symbol": resp.etlConfig.Symbol},
-			bson.M{"$set": instrument},
-			options.Update().SetUpsert(true))
-		if err != nil {
-			return err
-		}
-	case Medium:
-		candles, err := respBodyToPriceHistory(resp.Body)
-		_, err = mongo.Medium.UpdateOne(context.TODO(),
-			bson.M{"symbol": candles.Symbol},
-			bson.M{"$set": candles},
-			options.Update().SetUpsert(true))
-		if err != nil {
-			return err
-		}
-	case Short:
-		candles, err := respBodyToPriceHistory(resp.Body)
-		_, err = mongo.Short.UpdateOne(context.TODO(),
-			bson.M{"symbol": candles.Symbol},
-			bson.M{"$set": candles},
-			options.Update().SetUpsert(true))
-		if err != nil {
-			return err
-		}
-	case Signals:
-		candles, err := respBodyToPriceHistory(resp.Body)
-		_, err = mongo.Signals.UpdateOne(context.TODO(),
-			bson.M{"symbol": candles.Symbol},
-			bson.M{"$set": candles},
-			options.Update().SetUpsert(true))
-		if err != nil {
+		err = loadFundamental(store, resp)
+	case Medium, Short, Signals:
+		err = loadPriceHistory(store, resp.etlConfig.Work, resp.Body)
+	}
+	if errors.Is(err, ErrMalformed) {
+		if err := store.Quarantined.Add(resp.etlConfig, resp.Body, err); err != nil {
 			return err
 		}
+		log.Println("Transform load quarantined: ", resp.etlConfig.Symbol, resp.etlConfig.Work)
+		return nil
+	}
+	if err != nil {
+		return err
 	}
+	log.Println("Transform load success: ", resp.etlConfig.Symbol)
+	return nil
+}
 
-	err := mongo.ApiQueue.Remove(resp.etlConfig)
+func loadFundamental(store *Store, resp ApiCallSuccess) error {
+	instrument, err := TransformFundamental(resp.etlConfig.Symbol, resp.Body)
 	if err != nil {
 		return err
 	}
 
-	log.Println("Transform load success: ", resp.etlConfig.Symbol)
+	// we exit earlier and save a smaller payload if marketcap is less than 500 million
+	if marketCap := instrument.Fundamental.MarketCap; marketCap != nil && *marketCap < 500 {
+		return store.Fundamentals.SetMarketCap(resp.etlConfig.Symbol, *marketCap)
+	}
+	return store.Fundamentals.Upsert(resp.etlConfig.Symbol, instrument)
+}
 
-	return nil
+// loadPriceHistory replaces the job's snapshot and appends to the candle store
+func loadPriceHistory(store *Store, work EtlJob, body map[string]interface{}) error {
+	candles, err := TransformPriceHistory(body)
+	if err != nil {
+		return err
+	}
+	if err := store.Snapshots.Save(work, candles); err != nil {
+		return err
+	}
+	return loadCandles(store, work, candles)
 }
 
-func respBodyToPriceHistory(body interface{}) (*PriceHistory, error) {
-	var ph PriceHistory
-	b, err := json.Marshal(body)
-	json.Unmarshal(b, &ph)
+// loadCandles appends the fetched bars to the candle store and publishes the
+// ones that are new or replace the last stored, possibly partial, bar
+func loadCandles(store *Store, work EtlJob, ph *PriceHistory) error {
+	timeframe := JobTimeframe(work)
+	last, err := store.Candles.Last(ph.Symbol, timeframe)
+	if err != nil {
+		return err
+	}
+	if err := store.Candles.Upsert(ph.Symbol, timeframe, ph.Candles); err != nil {
+		return err
+	}
 
-	candles, err := calculatePriceHistory(ph)
+	fresh := ph.Candles
+	if last != nil {
+		fresh = nil
+		for _, c := range ph.Candles {
+			if c.Datetime >= last.Datetime {
+				fresh = append(fresh, c)
+			}
+		}
+	}
+	if len(fresh) == 0 || store.Events == nil {
+		return nil
+	}
+	err = store.Events.Publish(events.Event{
+		Kind:      events.CandlesLoaded,
+		Symbol:    ph.Symbol,
+		Job:       string(work),
+		Timeframe: string(timeframe),
+		Candles:   fresh,
+		At:        time.Now(),
+	})
 	if err != nil {
-		return nil, err
+		log.Println("Publishing candles failed ", ph.Symbol, err)
 	}
-	return candles, nil
+	return nil
 }
 
 type Instrument struct {
-	ID          *primitive.ObjectID `json:"id,omitempty"  bson:"_id,omitempty"`
-	Fundamental Fundamental         `json:"fundamental" bson:"fundamental"`
-	Cusip       *string             `json:"cusip" bson:"cusip"`
-	Symbol      *string             `json:"symbol" bson:"symbol"`
-	Description *string             `json:"description" bson:"description"`
-	Exchange    *string             `json:"exchange" bson:"exchange"`
-	AssetType   *string             `json:"assetType,omitempty" bson:"assetType,omitempty"`
+	ID            *primitive.ObjectID `json:"id,omitempty"  bson:"_id,omitempty"`
+	Fundamental   Fundamental         `json:"fundamental" bson:"fundamental"`
+	Cusip         *string             `json:"cusip" bson:"cusip"`
+	Symbol        *string             `json:"symbol" bson:"symbol" validate:"required"`
+	Description   *string             `json:"description" bson:"description"`
+	Exchange      *string             `json:"exchange" bson:"exchange"`
+	AssetType     *string             `json:"assetType,omitempty" bson:"assetType,omitempty"`
+	MissingFields []string            `json:"missingFields,omitempty" bson:"missingFields"` /* fundamental fields absent from the last response */
 }
 
 type Fundamental struct {
 	Symbol              *string  `json:"symbol" bson:"symbol"`
-	High52              *float64 `json:"high52" bson:"high52"`
-	Low52               *float64 `json:"low52" bson:"low52"`
+	High52              *float64 `json:"high52" bson:"high52" validate:"omitempty,gte=0"`
+	Low52               *float64 `json:"low52" bson:"low52" validate:"omitempty,gte=0"`
 	DividendAmount      *float64 `json:"dividendAmount" bson:"dividendAmount"`
 	DividendYield       *float64 `json:"dividendYield" bson:"dividendYield"`
 	DividendDate        *string  `json:"dividendDate" bson:"dividendDate"`
@@ -164,21 +146,21 @@ type Fundamental struct {
 	EpsTTM              *float64 `json:"epsTTM" bson:"epsTTM"`
 	EpsChangePercentTTM *float64 `json:"epsChangePercentTTM" bson:"epsChangePercentTTM"`
 	EpsChangeYear       *float64 `json:"epsChangeYear" bson:"epsChangeYear"`
-	EpsChange           *int     `json:"epsChange" bson:"epsChange"`
-	RevChangeYear       *int     `json:"revChangeYear" bson:"revChangeYear"`
+	EpsChange           *float64 `json:"epsChange" bson:"epsChange"`
+	RevChangeYear       *float64 `json:"revChangeYear" bson:"revChangeYear"`
 	RevChangeTTM        *float64 `json:"revChangeTTM" bson:"revChangeTTM"`
-	RevChangeIn         *int     `json:"revChangeIn" bson:"revChangeIn"`
-	SharesOutstanding   *float64 `json:"sharesOutstanding" bson:"sharesOutstanding"`
-	MarketCapFloat      *float64 `json:"marketCapFloat" bson:"marketCapFloat"`
-	MarketCap           *float64 `json:"marketCap" bson:"marketCap"`
+	RevChangeIn         *float64 `json:"revChangeIn" bson:"revChangeIn"`
+	SharesOutstanding   *float64 `json:"sharesOutstanding" bson:"sharesOutstanding" validate:"omitempty,gte=0"`
+	MarketCapFloat      *float64 `json:"marketCapFloat" bson:"marketCapFloat" validate:"omitempty,gte=0"`
+	MarketCap           *float64 `json:"marketCap" bson:"marketCap" validate:"omitempty,gte=0"`
 	BookValuePerShare   *float64 `json:"bookValuePerShare" bson:"bookValuePerShare"`
-	ShortIntToFloat     *int     `json:"shortIntToFloat" bson:"shortIntToFloat"`
-	ShortIntDayToCover  *int     `json:"shortIntDayToCover" bson:"shortIntDayToCover"`
-	DivGrowthRate3Year  *int     `json:"divGrowthRate3Year" bson:"divGrowthRate3Year"`
+	ShortIntToFloat     *float64 `json:"shortIntToFloat" bson:"shortIntToFloat"`
+	ShortIntDayToCover  *float64 `json:"shortIntDayToCover" bson:"shortIntDayToCover"`
+	DivGrowthRate3Year  *float64 `json:"divGrowthRate3Year" bson:"divGrowthRate3Year"`
 	DividendPayAmount   *float64 `json:"dividendPayAmount" bson:"dividendPayAmount"`
 	DividendPayDate     *string  `json:"dividendPayDate" bson:"dividendPayDate"`
 	Beta                *float64 `json:"beta" bson:"beta"`
-	Vol1DayAvg          *float64 `json:"vol1DayAvg" bson:"vol1DayAvg"`
-	Vol10DayAvg         *float64 `json:"vol10DayAvg" bson:"vol10DayAvg"`
-	Vol3MonthAvg        *float64 `json:"vol3MonthAvg" bson:"vol3MonthAvg"`
+	Vol1DayAvg          *float64 `json:"vol1DayAvg" bson:"vol1DayAvg" validate:"omitempty,gte=0"`
+	Vol10DayAvg         *float64 `json:"vol10DayAvg" bson:"vol10DayAvg" validate:"omitempty,gte=0"`
+	Vol3MonthAvg        *float64 `json:"vol3MonthAvg" bson:"vol3MonthAvg" validate:"omitempty,gte=0"`
 }
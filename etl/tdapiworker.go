@@ -2,57 +2,256 @@ package etl
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"sync"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
-
+	"github.com/jaredtokuz/market-trader/marketdata"
 	"github.com/jaredtokuz/market-trader/token"
 )
 
+type WorkerConfig struct {
+	Fetchers    int /* goroutines claiming jobs and calling the api */
+	Loaders     int /* goroutines running TransformLoad */
+	MaxAttempts int /* claims before a failing job is dead lettered */
+}
+
+// WorkerConfigFromEnv reads WORKER_FETCHERS, WORKER_LOADERS and QUEUE_MAX_ATTEMPTS
+func WorkerConfigFromEnv() WorkerConfig {
+	return WorkerConfig{
+		Fetchers:    envInt("WORKER_FETCHERS", 4),
+		Loaders:     envInt("WORKER_LOADERS", 2),
+		MaxAttempts: MaxAttempts(),
+	}
+}
+
 func InitWorker() error {
-	mg, err := NewMongoController(os.Getenv("MONGO_URI"), os.Getenv("DB_NAME"))
+	store, err := NewStoreFromEnv()
 	if err != nil {
 		log.Fatal(err)
 		return err
 	}
-	tokenHandler := token.NewAccessTokenService(os.Getenv("TOKEN_PATH"))
-	api_key := os.Getenv("API_KEY")
-
-	var (
-		workDoc *EtlConfig
-		wg      sync.WaitGroup
-	)
-	tdApiService := NewTDApiService(mg, api_key, tokenHandler)
-	mg.ApiQueue.Init() // sets all existing docs to stage api
-	for {
-		workDoc = mg.ApiQueue.Get()
-		if workDoc == nil {
-			// finished work
-			break
-		}
+	return RunWorker(store)
+}
 
-		success, err := tdApiService.Call(*workDoc)
-		time.Sleep(1000)                  // change this to backoff retry
-		mg.ApiQueue.UpdateStage(*workDoc) // update the stage to transform so apiqueue knows not to grab it again
+// RunWorker drains store's queue with the api service and pool size from the environment
+func RunWorker(store *Store) error {
+	tdApiService, err := NewTDApiServiceFromEnv(store)
+	if err != nil {
+		return err
+	}
+	store.ApiQueue.Init() // sets all docs without a live lease to stage api
+	return RunWorkerPool(store, tdApiService, WorkerConfigFromEnv())
+}
 
-		if err != nil {
-			log.Println("TD Call Error: ", err.Error())
-			mg.Logs.InsertOne(context.TODO(), bson.M{"msg": err.Error(), "category": "TD Call"})
-			continue
-		}
+// ReplayFromAPICalls is the REPLAY value that serves responses from APICalls,
+// any other non empty value is a fixtures directory
+const ReplayFromAPICalls = "apicalls"
+
+// NewTDApiServiceFromEnv builds the token service and market data provider
+// from the environment, or a replay service when REPLAY is set
+func NewTDApiServiceFromEnv(store *Store) (TDApiService, error) {
+	if source := os.Getenv("REPLAY"); source != "" {
+		return NewReplayServiceFromEnv(store, source)
+	}
+	tokenHandler, err := token.NewAccessTokenService(token.ConfigFromEnv())
+	if err != nil {
+		return nil, err
+	}
+	provider, err := marketdata.New(marketdata.ConfigFromEnv(), tokenHandler)
+	if err != nil {
+		return nil, err
+	}
+	return NewTDApiService(store, provider), nil
+}
+
+// NewReplayServiceFromEnv replays source, ReplayFromAPICalls or a fixtures
+// directory, normalizing bodies as MARKET_DATA_PROVIDER would
+func NewReplayServiceFromEnv(store *Store, source string) (TDApiService, error) {
+	provider, err := marketdata.New(marketdata.ConfigFromEnv(), nil) /* never sends a request */
+	if err != nil {
+		return nil, err
+	}
+	if source == ReplayFromAPICalls {
+		return NewReplayService(NewApiCallsSource(store.ApiCalls), provider), nil
+	}
+	if info, err := os.Stat(source); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("REPLAY must be %v or a fixtures directory: %v", ReplayFromAPICalls, source)
+	}
+	return NewReplayService(NewFixtureSource(source), provider), nil
+}
+
+// RunWorkerPool drains the api queue with cfg.Fetchers callers feeding
+// cfg.Loaders transform/loaders. The loads channel only buffers one result per
+// loader so fetchers block instead of piling responses up in memory. Request
+// pacing is left to the rate limiter inside tdApiService.Call.
+func RunWorkerPool(store *Store, tdApiService TDApiService, cfg WorkerConfig) error {
+	return RunWorkerPoolContext(context.Background(), store, tdApiService, cfg)
+}
+
+// RunWorkerPoolContext stops claiming new jobs once ctx is done, jobs already
+// claimed are finished
+func RunWorkerPoolContext(ctx context.Context, store *Store, tdApiService TDApiService, cfg WorkerConfig) error {
+	workerID := NewWorkerID()
+	lease := LeaseDuration()
+	log.Println("Worker started: ", workerID, cfg)
+
+	loads := make(chan fetched, cfg.Loaders)
+
+	// a queue error stops the fetcher that hit it and is returned, so a
+	// database outage doesn't look like a drained queue
+	var queueErr error
+	var queueErrOnce sync.Once
+	queueFailed := func(err error) {
+		log.Println("Queue error: ", err.Error())
+		queueErrOnce.Do(func() { queueErr = err })
+	}
+
+	var fetchers sync.WaitGroup
+	for n := 0; n < cfg.Fetchers; n++ {
+		fetchers.Add(1)
+		go func() {
+			defer fetchers.Done()
+			for ctx.Err() == nil {
+				workDoc, err := store.ApiQueue.Claim(workerID, lease)
+				if err != nil {
+					queueFailed(err)
+					return
+				}
+				if workDoc == nil {
+					// jobs still leased may be released by Fail, finished once none are left
+					more, err := queued(store.ApiQueue)
+					if err != nil {
+						queueFailed(err)
+						return
+					}
+					if !more || sleep(ctx, idlePoll) != nil {
+						return
+					}
+					continue
+				}
+				if load, ok := fetch(store, tdApiService, *workDoc, lease, cfg.MaxAttempts); ok {
+					loads <- load
+				}
+			}
+		}()
+	}
 
-		wg.Add(1)
+	var loaders sync.WaitGroup
+	for n := 0; n < cfg.Loaders; n++ {
+		loaders.Add(1)
 		go func() {
-			defer wg.Done()
-			err = TransformLoad(*mg, success)
-			if err != nil {
-				mg.Logs.InsertOne(context.TODO(), bson.M{"msg": err.Error(), "category": "TD TransformLoad"})
+			defer loaders.Done()
+			for load := range loads {
+				err := safeTransformLoad(store, load.success)
+				if err != nil {
+					store.Logs.Insert("TD TransformLoad", err.Error())
+					fail(store, load.success.etlConfig, err, cfg.MaxAttempts)
+				}
+				load.stopHeartbeat()
 			}
 		}()
 	}
-	wg.Wait()
-	return nil
+
+	fetchers.Wait()
+	close(loads)
+	loaders.Wait()
+	if queueErr != nil {
+		return queueErr
+	}
+	return ctx.Err()
+}
+
+// idlePoll is how often an idle fetcher looks for released jobs
+var idlePoll = time.Second
+
+// queued reports whether any job is left in the queue, leased or waiting
+func queued(queue ApiQueueService) (bool, error) {
+	depth, err := queue.Depth()
+	if err != nil {
+		return false, err
+	}
+	for _, d := range depth {
+		if d.Count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// safeTransformLoad turns a panic in a transform into a failed job so one bad
+// payload can't take the whole worker down
+func safeTransformLoad(store *Store, success ApiCallSuccess) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("transform panic %v %v: %v", success.etlConfig.Symbol, success.etlConfig.Work, r)
+		}
+	}()
+	return TransformLoad(store, success)
+}
+
+// fetched is a response waiting for a loader, its lease is renewed until
+// stopHeartbeat is called
+type fetched struct {
+	success       ApiCallSuccess
+	stopHeartbeat func()
+}
+
+// fetch calls the api for a claimed job and moves it to the transform stage.
+// The lease keeps being renewed while the response waits for a loader.
+func fetch(store *Store, tdApiService TDApiService, workDoc EtlConfig, lease time.Duration, maxAttempts int) (fetched, bool) {
+	stop := keepLeaseAlive(store.ApiQueue, workDoc, lease)
+	success, err := tdApiService.Call(workDoc)
+	if err != nil {
+		stop()
+		log.Println("TD Call Error: ", err.Error())
+		store.Logs.Insert("TD Call", err.Error())
+		fail(store, workDoc, err, maxAttempts)
+		return fetched{}, false
+	}
+
+	// update the stage to transform so apiqueue knows not to grab it again
+	if err := store.ApiQueue.UpdateStage(workDoc, lease); err != nil {
+		stop()
+		log.Println("Lease lost: ", workDoc.Symbol, workDoc.Work, err.Error())
+		return fetched{}, false
+	}
+	return fetched{success: success, stopHeartbeat: stop}, true
+}
+
+// fail hands the job back to the queue, which retries or dead letters it
+func fail(store *Store, workDoc EtlConfig, cause error, maxAttempts int) {
+	dead, err := store.ApiQueue.Fail(workDoc, cause, maxAttempts)
+	if err != nil {
+		log.Println("Queue fail update error: ", workDoc.Symbol, workDoc.Work, err.Error())
+		return
+	}
+	if dead {
+		log.Println("Dead lettered: ", workDoc.Symbol, workDoc.Work, cause.Error())
+	}
+}
+
+// keepLeaseAlive renews the job lease in the background until stop is called,
+// so long retry backoffs in Call or slow loaders don't let another worker
+// reclaim the job
+func keepLeaseAlive(queue ApiQueueService, etlConfig EtlConfig, lease time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(lease / 3)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := queue.Heartbeat(etlConfig, lease); err != nil {
+					log.Println("Heartbeat failed: ", etlConfig.Symbol, etlConfig.Work, err.Error())
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
 }
@@ -0,0 +1,98 @@
+package etl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator"
+)
+
+// ErrMalformed marks payloads that can't be loaded, Load quarantines
+// them instead of failing the job
+var ErrMalformed = errors.New("malformed payload")
+
+func malformed(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %v", ErrMalformed, fmt.Sprintf(format, a...))
+}
+
+// TransformFundamental validates the instruments response for symbol and rounds
+// the fields that are present. Fields TD left out, common for ETFs and new
+// listings, stay nil and are listed in MissingFields.
+func TransformFundamental(symbol string, body map[string]interface{}) (*Instrument, error) {
+	raw, ok := body[symbol]
+	if !ok || raw == nil {
+		return nil, malformed("no instrument for %v", symbol)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, malformed("%v", err)
+	}
+	var instrument Instrument
+	if err := json.Unmarshal(b, &instrument); err != nil {
+		return nil, malformed("%v", err)
+	}
+	if err := validator.New().Struct(instrument); err != nil {
+		return nil, malformed("%v", err)
+	}
+	if *instrument.Symbol != symbol {
+		return nil, malformed("instrument is for %v not %v", *instrument.Symbol, symbol)
+	}
+
+	f := &instrument.Fundamental
+	instrument.MissingFields = missingFields(f)
+	if len(instrument.MissingFields) == reflect.TypeOf(*f).NumField() {
+		return nil, malformed("no fundamental for %v", symbol)
+	}
+	for _, field := range []*float64{
+		f.MarketCap, f.High52, f.Low52, f.DividendAmount, f.DividendYield,
+		f.PeRatio, f.PegRatio, f.PbRatio, f.PrRatio, f.PcfRatio,
+		f.GrossMarginTTM, f.GrossMarginMRQ, f.NetProfitMarginTTM, f.NetProfitMarginMRQ,
+		f.OperatingMarginTTM, f.OperatingMarginMRQ, f.ReturnOnEquity, f.ReturnOnAssets,
+		f.ReturnOnInvestment, f.QuickRatio, f.CurrentRatio, f.InterestCoverage,
+		f.TotalDebtToCapital, f.LtDebtToEquity, f.TotalDebtToEquity, f.EpsTTM,
+		f.EpsChangePercentTTM, f.EpsChangeYear, f.RevChangeTTM, f.MarketCapFloat,
+		f.BookValuePerShare, f.DividendPayAmount, f.Beta, f.EpsChange, f.RevChangeYear,
+		f.RevChangeIn, f.ShortIntToFloat, f.ShortIntDayToCover, f.DivGrowthRate3Year,
+	} {
+		if field != nil {
+			*field = Round(*field)
+		}
+	}
+	return &instrument, nil
+}
+
+// missingFields lists the bson names of the nil fields of f
+func missingFields(f *Fundamental) []string {
+	var missing []string
+	v := reflect.ValueOf(f).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Kind() == reflect.Ptr && v.Field(i).IsNil() {
+			name := strings.Split(v.Type().Field(i).Tag.Get("bson"), ",")[0]
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// TransformPriceHistory decodes a pricehistory response and adds the volume
+// stats and indicators
+func TransformPriceHistory(body map[string]interface{}) (*PriceHistory, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, malformed("%v", err)
+	}
+	var ph PriceHistory
+	if err := json.Unmarshal(b, &ph); err != nil {
+		return nil, malformed("%v", err)
+	}
+	if ph.Symbol == "" {
+		return nil, malformed("no symbol")
+	}
+	if len(ph.Candles) == 0 {
+		return nil, malformed("no candles for %v", ph.Symbol)
+	}
+	return calculatePriceHistory(ph)
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Bus fans events out to subscribers in process. Publish never blocks, a
+// subscriber that falls behind loses events and counts them in Dropped.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[*Subscription]struct{}{}}
+}
+
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	filter  Filter
+	bus     *Bus
+	once    sync.Once
+	dropped int64
+}
+
+func (b *Bus) Subscribe(filter Filter, buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c, filter: filter, bus: b}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+func (b *Bus) Publish(e Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+	return nil
+}
+
+// Close unsubscribes and closes C
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.c)
+	})
+}
+
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
@@ -0,0 +1,67 @@
+// Package events carries signal changes and newly loaded candles from the
+// worker and signal engine to API subscribers. Producers write to a capped
+// Mongo collection, the API tails it into an in-process Bus.
+package events
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+type Kind string
+
+const (
+	CandlesLoaded Kind = "candles"
+	SignalChanged Kind = "signal"
+)
+
+type Event struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Kind      Kind               `json:"kind" bson:"kind"`
+	Symbol    string             `json:"symbol" bson:"symbol"`
+	Job       string             `json:"job,omitempty" bson:"job,omitempty"`             /* etl job that loaded the candles */
+	Timeframe string             `json:"timeframe,omitempty" bson:"timeframe,omitempty"` /* of the candles */
+	Candles   []shared.Candle    `json:"candles,omitempty" bson:"candles,omitempty"`     /* bars new or changed since the last load */
+	Signal    *SignalChange      `json:"signal,omitempty" bson:"signal,omitempty"`
+	At        time.Time          `json:"at" bson:"at"`
+}
+
+type SignalChange struct {
+	Active  bool     `json:"active" bson:"active"`
+	Reasons []string `json:"reasons" bson:"reasons"`
+}
+
+type Publisher interface {
+	Publish(e Event) error
+}
+
+// Filter selects events for a subscriber, empty fields match everything
+type Filter struct {
+	Symbols []string
+	Jobs    []string
+	Kinds   []Kind
+}
+
+func (f Filter) Match(e Event) bool {
+	kinds := make([]string, len(f.Kinds))
+	for i, k := range f.Kinds {
+		kinds[i] = string(k)
+	}
+	return matchAny(f.Symbols, e.Symbol) && matchAny(f.Jobs, e.Job) && matchAny(kinds, string(e.Kind))
+}
+
+func matchAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	candles := Event{Kind: CandlesLoaded, Symbol: "AAPL", Job: "Signals"}
+	signal := Event{Kind: SignalChanged, Symbol: "MSFT"}
+
+	cases := []struct {
+		filter  Filter
+		candles bool
+		signal  bool
+	}{
+		{Filter{}, true, true},
+		{Filter{Symbols: []string{"aapl"}}, true, false},
+		{Filter{Symbols: []string{"AAPL", "MSFT"}}, true, true},
+		{Filter{Jobs: []string{"Signals"}}, true, false},
+		{Filter{Jobs: []string{"Medium"}}, false, false},
+		{Filter{Kinds: []Kind{SignalChanged}}, false, true},
+	}
+	for _, c := range cases {
+		if c.filter.Match(candles) != c.candles || c.filter.Match(signal) != c.signal {
+			t.Error("Unexpected match for ", c.filter)
+		}
+	}
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe(Filter{}, 1)
+	aapl := bus.Subscribe(Filter{Symbols: []string{"AAPL"}}, 4)
+
+	bus.Publish(Event{Symbol: "AAPL"})
+	bus.Publish(Event{Symbol: "MSFT"})
+
+	if e := <-aapl.C; e.Symbol != "AAPL" {
+		t.Error("Expected AAPL got ", e.Symbol)
+	}
+	if len(aapl.C) != 0 {
+		t.Error("MSFT should be filtered out")
+	}
+	if e := <-all.C; e.Symbol != "AAPL" {
+		t.Error("Expected AAPL got ", e.Symbol)
+	}
+	if all.Dropped() != 1 {
+		t.Error("Full subscriber should drop MSFT got ", all.Dropped())
+	}
+
+	aapl.Close()
+	aapl.Close()
+	if _, ok := <-aapl.C; ok {
+		t.Error("Closed subscription channel should be closed")
+	}
+	bus.Publish(Event{Symbol: "AAPL"})
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Events is a capped collection so it can be tailed without a replica set
+const Events = "Events"
+
+const DefaultCapBytes = 16 << 20
+
+type mongoPublisher struct {
+	events *mongo.Collection
+}
+
+func NewMongoPublisher(mg *mongo.Database) Publisher {
+	return &mongoPublisher{events: mg.Collection(Events)}
+}
+
+func (p *mongoPublisher) Publish(e Event) error {
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	_, err := p.events.InsertOne(context.TODO(), e)
+	return err
+}
+
+// EnsureCollection creates the capped Events collection if it is missing.
+// Inserting first would create an uncapped collection that can't be tailed.
+func EnsureCollection(mg *mongo.Database, capBytes int64) error {
+	names, err := mg.ListCollectionNames(context.TODO(), bson.M{"name": Events})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return nil
+	}
+	return mg.CreateCollection(context.TODO(), Events, options.CreateCollection().SetCapped(true).SetSizeInBytes(capBytes))
+}
+
+// Tail publishes every event inserted after it starts to the bus until ctx is
+// done. The tailable cursor is reopened after errors or when it dies.
+func Tail(ctx context.Context, mg *mongo.Database, bus Publisher) {
+	collection := mg.Collection(Events)
+	last := primitive.NewObjectIDFromTimestamp(time.Now())
+	for ctx.Err() == nil {
+		cursor, err := collection.Find(ctx,
+			bson.M{"_id": bson.M{"$gt": last}},
+			options.Find().SetCursorType(options.TailableAwait).SetMaxAwaitTime(time.Second))
+		if err != nil {
+			log.Println("Events tail failed ", err)
+			sleep(ctx, 5*time.Second)
+			continue
+		}
+		for cursor.Next(ctx) {
+			var e Event
+			if err := cursor.Decode(&e); err != nil {
+				log.Println("Events decode failed ", err)
+				continue
+			}
+			last = e.ID
+			bus.Publish(e)
+		}
+		if err := cursor.Err(); err != nil && ctx.Err() == nil {
+			log.Println("Events cursor closed ", err)
+		}
+		cursor.Close(context.TODO())
+		// a tailable cursor on an empty collection dies right away
+		sleep(ctx, time.Second)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,169 @@
+package fakeapi
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+// seed is a stable number for symbol and any extra keys, every synthetic value
+// derives from it so the same request always gets the same response
+func seed(symbol string, keys ...int64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(symbol))
+	for _, k := range keys {
+		var b [8]byte
+		for i := range b {
+			b[i] = byte(k >> (8 * i))
+		}
+		h.Write(b[:])
+	}
+	return h.Sum64()
+}
+
+// unit maps symbol and keys to [0, 1)
+func unit(symbol string, keys ...int64) float64 {
+	return float64(seed(symbol, keys...)%1000000) / 1000000
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// isETF makes roughly one symbol in seven an ETF, which comes back without
+// margins, ratios or a market cap like the real api
+func isETF(symbol string) bool {
+	return seed(symbol, 7)%7 == 0
+}
+
+// basePrice is between 5 and 500
+func basePrice(symbol string) float64 {
+	return 5 + 495*unit(symbol, 1)*unit(symbol, 2)
+}
+
+// price wanders smoothly around basePrice with a 30 day and a 1 day cycle,
+// it is a function of time alone so overlapping windows agree
+func price(symbol string, t time.Time) float64 {
+	days := float64(t.Unix()) / 86400
+	phase := 2 * math.Pi * unit(symbol, 3)
+	p := basePrice(symbol) * (1 + 0.08*math.Sin(2*math.Pi*days/30+phase) + 0.01*math.Sin(2*math.Pi*days+phase))
+	return math.Max(0.01, p)
+}
+
+func bar(symbol string, start time.Time, d time.Duration) shared.Candle {
+	open := price(symbol, start)
+	close := price(symbol, start.Add(d))
+	spread := basePrice(symbol) * 0.002 * (1 + unit(symbol, start.Unix(), 1))
+	volume := int(1000 + 50000*unit(symbol, start.Unix(), 2)*unit(symbol, 4)*d.Minutes())
+	return shared.Candle{
+		Datetime: uint64(start.UnixMilli()),
+		Open:     round(open),
+		High:     round(math.Max(open, close) + spread),
+		Low:      round(math.Max(0.01, math.Min(open, close)-spread)),
+		Close:    round(close),
+		Volume:   volume,
+	}
+}
+
+// Candles are the bars the api returns for [start, end). Minute bars only cover
+// trading sessions, pre and post market included when extended, daily bars are
+// stamped at midnight New York.
+func Candles(symbol string, frequency time.Duration, daily bool, start time.Time, end time.Time, extended bool) []shared.Candle {
+	candles := []shared.Candle{}
+	if daily {
+		for d := calendar.Date(start); d.Before(end); d = d.AddDate(0, 0, 1) {
+			if s, ok := calendar.SessionOn(d); ok && !d.Before(start) {
+				day := bar(symbol, s.Open, s.Close.Sub(s.Open))
+				day.Datetime = uint64(d.UnixMilli())
+				day.Volume *= 20
+				candles = append(candles, day)
+			}
+		}
+		return candles
+	}
+	for d := calendar.Date(start); d.Before(end); d = d.AddDate(0, 0, 1) {
+		s, ok := calendar.SessionOn(d)
+		if !ok {
+			continue
+		}
+		from, to := s.Open, s.Close
+		if extended {
+			from, to = s.PreOpen, s.PostClose
+		}
+		for t := from; t.Before(to); t = t.Add(frequency) {
+			if !t.Before(start) && t.Before(end) {
+				candles = append(candles, bar(symbol, t, frequency))
+			}
+		}
+	}
+	return candles
+}
+
+// Fundamental is the fundamental block of the instruments response
+func Fundamental(symbol string, now time.Time) map[string]interface{} {
+	last := price(symbol, now)
+	volume := round(200000 + 30000000*unit(symbol, 5)*unit(symbol, 6))
+	f := map[string]interface{}{
+		"symbol":       symbol,
+		"high52":       round(basePrice(symbol) * 1.12),
+		"low52":        round(basePrice(symbol) * 0.88),
+		"vol1DayAvg":   volume,
+		"vol10DayAvg":  volume,
+		"vol3MonthAvg": volume,
+	}
+	if isETF(symbol) {
+		f["dividendYield"] = round(3 * unit(symbol, 8))
+		return f
+	}
+	shares := 10 + 5000*unit(symbol, 9) /* millions */
+	eps := last / (5 + 40*unit(symbol, 10))
+	f["marketCap"] = round(shares * last)
+	f["marketCapFloat"] = round(shares * 0.9)
+	f["sharesOutstanding"] = round(shares * 1000000)
+	f["peRatio"] = round(last / eps)
+	f["pegRatio"] = round(0.5 + 2*unit(symbol, 11))
+	f["pbRatio"] = round(1 + 10*unit(symbol, 12))
+	f["epsTTM"] = round(eps)
+	f["grossMarginTTM"] = round(20 + 60*unit(symbol, 13))
+	f["netProfitMarginTTM"] = round(-5 + 30*unit(symbol, 14))
+	f["returnOnEquity"] = round(-5 + 40*unit(symbol, 15))
+	f["currentRatio"] = round(0.5 + 3*unit(symbol, 16))
+	f["totalDebtToEquity"] = round(200 * unit(symbol, 17))
+	f["beta"] = round(0.3 + 2*unit(symbol, 18))
+	f["dividendAmount"] = 0.0
+	f["dividendYield"] = 0.0
+	return f
+}
+
+// Instrument is one entry of the instruments response
+func Instrument(symbol string, now time.Time) map[string]interface{} {
+	assetType := "EQUITY"
+	if isETF(symbol) {
+		assetType = "ETF"
+	}
+	return map[string]interface{}{
+		"cusip":       "FAKE" + symbol,
+		"symbol":      symbol,
+		"description": symbol + " Synthetic Inc",
+		"exchange":    "NASDAQ",
+		"assetType":   assetType,
+		"fundamental": Fundamental(symbol, now),
+	}
+}
+
+// Quote is one entry of the quotes response
+func Quote(symbol string, now time.Time) map[string]interface{} {
+	last := round(price(symbol, now))
+	return map[string]interface{}{
+		"assetType":       "EQUITY",
+		"symbol":          symbol,
+		"lastPrice":       last,
+		"bidPrice":        round(last - 0.01),
+		"askPrice":        round(last + 0.01),
+		"totalVolume":     int(1000000 * unit(symbol, 19)),
+		"quoteTimeInLong": now.UnixMilli(),
+	}
+}
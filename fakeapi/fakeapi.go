@@ -0,0 +1,272 @@
+// Package fakeapi is a local stand in for the TD Ameritrade api. It serves
+// instruments, price history, quotes and the oauth2 token endpoint with
+// deterministic synthetic data, and can inject 401s, 429s, server errors and
+// latency so retries, token refresh and rate limiting can be exercised offline.
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+)
+
+type Config struct {
+	Seed              int64         /* for injected faults and jitter */
+	Latency           time.Duration /* added to every response */
+	Jitter            time.Duration /* up to this much more latency, random */
+	Unauthorized      float64       /* fraction of requests answered 401 */
+	RateLimited       float64       /* fraction of requests answered 429 */
+	ServerErrors      float64       /* fraction of requests answered 500, 502 or 503 */
+	RequestsPerMinute int           /* 429 once exceeded in a minute, 0 for no limit */
+	TokenTTL          time.Duration /* lifetime of issued tokens, 0 accepts any bearer token */
+	NotFound          []string      /* symbols answered 404, ex delisted */
+	Verbose           bool          /* log every request */
+}
+
+// Stats counts responses by outcome
+type Stats struct {
+	Requests     int `json:"requests"`
+	OK           int `json:"ok"`
+	Unauthorized int `json:"unauthorized"`
+	RateLimited  int `json:"rateLimited"`
+	ServerErrors int `json:"serverErrors"`
+	NotFound     int `json:"notFound"`
+	Refreshes    int `json:"refreshes"`
+}
+
+type Server struct {
+	config Config
+	mux    *http.ServeMux
+	now    func() time.Time
+
+	mu          sync.Mutex
+	random      *rand.Rand
+	tokens      map[string]time.Time /* access token to expiry */
+	issued      int
+	window      time.Time /* start of the current rate limit minute */
+	windowCount int
+	stats       Stats
+}
+
+func New(config Config) *Server {
+	s := &Server{
+		config: config,
+		mux:    http.NewServeMux(),
+		now:    time.Now,
+		random: rand.New(rand.NewSource(config.Seed)),
+		tokens: make(map[string]time.Time),
+	}
+	s.mux.HandleFunc("POST /v1/oauth2/token", s.token)
+	s.mux.HandleFunc("GET /v1/instruments", s.api(s.instruments))
+	s.mux.HandleFunc("GET /v1/marketdata/quotes", s.api(s.quotes))
+	s.mux.HandleFunc("GET /v1/marketdata/{symbol}/pricehistory", s.api(s.priceHistory))
+	s.mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Stats())
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.Verbose {
+		log.Println(r.Method, r.URL.Path, r.URL.RawQuery)
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// api wraps a data handler with latency, fault injection, rate limiting and
+// bearer token checks, in that order
+func (s *Server) api(handler func(r *http.Request) (int, interface{})) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		delay := s.config.Latency
+		if s.config.Jitter > 0 {
+			delay += time.Duration(s.random.Int63n(int64(s.config.Jitter)))
+		}
+		status := s.fault(r)
+		s.mu.Unlock()
+		time.Sleep(delay)
+
+		var body interface{}
+		if status == 0 {
+			status, body = handler(r)
+		} else {
+			body = map[string]interface{}{"error": http.StatusText(status)}
+		}
+		s.count(status)
+		writeJSON(w, status, body)
+	}
+}
+
+// fault picks an injected status for the request or 0 to serve it, s.mu is held
+func (s *Server) fault(r *http.Request) int {
+	s.stats.Requests++
+	if s.config.RequestsPerMinute > 0 {
+		now := s.now()
+		if now.Sub(s.window) >= time.Minute {
+			s.window, s.windowCount = now, 0
+		}
+		s.windowCount++
+		if s.windowCount > s.config.RequestsPerMinute {
+			return http.StatusTooManyRequests
+		}
+	}
+	roll := s.random.Float64()
+	switch {
+	case roll < s.config.Unauthorized:
+		return http.StatusUnauthorized
+	case roll < s.config.Unauthorized+s.config.RateLimited:
+		return http.StatusTooManyRequests
+	case roll < s.config.Unauthorized+s.config.RateLimited+s.config.ServerErrors:
+		return []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}[s.random.Intn(3)]
+	}
+	if !s.authorized(r) {
+		return http.StatusUnauthorized
+	}
+	return 0
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if bearer == "" || bearer == r.Header.Get("Authorization") {
+		return false
+	}
+	if s.config.TokenTTL == 0 {
+		return true
+	}
+	expires, ok := s.tokens[bearer]
+	return ok && s.now().Before(expires)
+}
+
+func (s *Server) count(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case status == http.StatusOK:
+		s.stats.OK++
+	case status == http.StatusUnauthorized:
+		s.stats.Unauthorized++
+	case status == http.StatusTooManyRequests:
+		s.stats.RateLimited++
+	case status == http.StatusNotFound:
+		s.stats.NotFound++
+	case status >= 500:
+		s.stats.ServerErrors++
+	}
+}
+
+// token runs the refresh_token grant, any refresh token is accepted
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid_grant"})
+		return
+	}
+	ttl := s.config.TokenTTL
+	if ttl == 0 {
+		ttl = 30 * time.Minute
+	}
+	s.mu.Lock()
+	s.issued++
+	s.stats.Refreshes++
+	access := fmt.Sprintf("fake-access-%v", s.issued)
+	s.tokens[access] = s.now().Add(ttl)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   int(ttl.Seconds()),
+		"scope":        "PlaceTrades AccountAccess MoveMoney",
+	})
+}
+
+func (s *Server) notFound(symbol string) bool {
+	for _, missing := range s.config.NotFound {
+		if strings.EqualFold(missing, symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) instruments(r *http.Request) (int, interface{}) {
+	body := map[string]interface{}{}
+	for _, symbol := range strings.Split(r.URL.Query().Get("symbol"), ",") {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if symbol == "" || s.notFound(symbol) {
+			continue
+		}
+		body[symbol] = Instrument(symbol, s.now())
+	}
+	if len(body) == 0 {
+		return http.StatusNotFound, map[string]interface{}{"error": "no instruments found"}
+	}
+	return http.StatusOK, body
+}
+
+func (s *Server) quotes(r *http.Request) (int, interface{}) {
+	body := map[string]interface{}{}
+	for _, symbol := range strings.Split(r.URL.Query().Get("symbol"), ",") {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if symbol != "" && !s.notFound(symbol) {
+			body[symbol] = Quote(symbol, s.now())
+		}
+	}
+	return http.StatusOK, body
+}
+
+// priceHistory reads the query parameters the TD provider sends, startDate and
+// endDate in unix milliseconds, falling back to the last 10 sessions
+func (s *Server) priceHistory(r *http.Request) (int, interface{}) {
+	symbol := strings.ToUpper(r.PathValue("symbol"))
+	if s.notFound(symbol) {
+		return http.StatusNotFound, map[string]interface{}{"error": "symbol not found " + symbol}
+	}
+	query := r.URL.Query()
+	daily := query.Get("frequencyType") == "daily"
+	frequency, err := strconv.Atoi(query.Get("frequency"))
+	if err != nil || frequency <= 0 {
+		frequency = 1
+	}
+	switch frequency {
+	case 1, 5, 10, 15, 30:
+	default:
+		if !daily {
+			return http.StatusBadRequest, map[string]interface{}{"error": "frequency must be 1, 5, 10, 15 or 30"}
+		}
+	}
+
+	end := s.now()
+	if ms, err := strconv.ParseInt(query.Get("endDate"), 10, 64); err == nil {
+		end = time.UnixMilli(ms)
+	}
+	start := calendar.LastSessions(end, 10)[0].PreOpen
+	if ms, err := strconv.ParseInt(query.Get("startDate"), 10, 64); err == nil {
+		start = time.UnixMilli(ms)
+	}
+	if !end.After(start) {
+		return http.StatusBadRequest, map[string]interface{}{"error": "endDate must be after startDate"}
+	}
+
+	extended := query.Get("needExtendedHoursData") != "false"
+	candles := Candles(symbol, time.Duration(frequency)*time.Minute, daily, start, end, extended)
+	return http.StatusOK, map[string]interface{}{"symbol": symbol, "empty": len(candles) == 0, "candles": candles}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
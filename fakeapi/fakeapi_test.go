@@ -0,0 +1,209 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/marketdata"
+	"github.com/jaredtokuz/market-trader/token"
+)
+
+type staticToken string
+
+func (s staticToken) Fetch() (string, error) {
+	return string(s), nil
+}
+
+func (s staticToken) Invalidate(accessToken string) {}
+
+func start(t *testing.T, config Config) (*Server, *httptest.Server) {
+	s := New(config)
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+// get sends a request built by the provider, status is 0 when it couldn't be sent
+func get(req *http.Request, err error) (int, map[string]interface{}) {
+	if err != nil {
+		return 0, nil
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil
+	}
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestPriceHistory(t *testing.T) {
+	_, server := start(t, Config{})
+	td := marketdata.NewTDAmeritrade(server.URL+"/v1", "key", staticToken("anything"))
+	sessions := calendar.LastSessions(time.Date(2023, 2, 8, 21, 0, 0, 0, calendar.NewYork), 2)
+	query := marketdata.PriceHistoryQuery{
+		PeriodType: "day", FrequencyType: "minute", Frequency: 15,
+		StartDate: sessions[0].PreOpen, EndDate: sessions[1].PostClose, NeedExtendedHoursData: true,
+	}
+
+	status, first := get(td.PriceHistory("TSLA", query))
+	if status != http.StatusOK {
+		t.Fatal("Expected 200 got ", status, first)
+	}
+	ph, err := etl.TransformPriceHistory(first)
+	if err != nil {
+		t.Fatal("Fake price history should transform ", err)
+	}
+	if len(ph.Candles) != 2*16*4 {
+		t.Error("Expected 64 extended hours bars a session, got ", len(ph.Candles))
+	}
+	_, again := get(td.PriceHistory("TSLA", query))
+	if !reflect.DeepEqual(first, again) {
+		t.Error("Expected the same response for the same request")
+	}
+
+	// a window over the second session only agrees with the first response
+	query.StartDate = sessions[1].Open
+	query.NeedExtendedHoursData = false
+	_, regular := get(td.PriceHistory("TSLA", query))
+	candles := regular["candles"].([]interface{})
+	if len(candles) != 26 {
+		t.Error("Expected 26 regular hours bars, got ", len(candles))
+	}
+	all := first["candles"].([]interface{})
+	if !reflect.DeepEqual(candles[0], all[64+22]) {
+		t.Error("Overlapping windows disagree ", candles[0], all[64+22])
+	}
+
+	query.FrequencyType, query.Frequency = "daily", 1
+	query.StartDate = time.Date(2023, 1, 1, 0, 0, 0, 0, calendar.NewYork)
+	_, daily := get(td.PriceHistory("TSLA", query))
+	if n := len(daily["candles"].([]interface{})); n != 26 {
+		t.Error("Expected 26 sessions from January 1st to February 8th, got ", n)
+	}
+}
+
+func TestInstruments(t *testing.T) {
+	_, server := start(t, Config{NotFound: []string{"GONE"}})
+	td := marketdata.NewTDAmeritrade(server.URL+"/v1", "key", staticToken("anything"))
+
+	var equity, etf string
+	for _, symbol := range []string{"AAPL", "MSFT", "TSLA", "SPY", "QQQ", "IWM", "DIA", "XLF", "XLE", "GLD", "VTI", "ARKK"} {
+		if isETF(symbol) && etf == "" {
+			etf = symbol
+		}
+		if !isETF(symbol) && equity == "" {
+			equity = symbol
+		}
+	}
+	if etf == "" {
+		t.Fatal("Expected an ETF among the test symbols")
+	}
+	for _, symbol := range []string{equity, etf} {
+		status, body := get(td.Fundamentals(symbol))
+		if status != http.StatusOK {
+			t.Fatal("Expected 200 got ", status)
+		}
+		instrument, err := etl.TransformFundamental(symbol, body)
+		if err != nil {
+			t.Fatal("Fake instrument should transform ", err)
+		}
+		if (instrument.Fundamental.MarketCap == nil) != isETF(symbol) {
+			t.Error("Only ETFs should be missing a market cap ", symbol, instrument.MissingFields)
+		}
+	}
+	if status, _ := get(td.Fundamentals("GONE")); status != http.StatusNotFound {
+		t.Error("Expected 404 for a delisted symbol got ", status)
+	}
+	status, quotes := get(td.Quotes([]string{"AAPL", "GONE", "TSLA"}))
+	if status != http.StatusOK || len(quotes) != 2 {
+		t.Error("Expected quotes for AAPL and TSLA ", quotes)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s, server := start(t, Config{Seed: 1, ServerErrors: 0.3, RateLimited: 0.2})
+	td := marketdata.NewTDAmeritrade(server.URL+"/v1", "key", staticToken("anything"))
+	for i := 0; i < 200; i++ {
+		get(td.Fundamentals("AAPL"))
+	}
+	stats := s.Stats()
+	if stats.ServerErrors < 40 || stats.ServerErrors > 80 || stats.RateLimited < 20 || stats.RateLimited > 60 {
+		t.Error("Expected about 60 server errors and 40 rate limits ", stats)
+	}
+	if stats.OK+stats.ServerErrors+stats.RateLimited != 200 {
+		t.Error("Every request should be counted ", stats)
+	}
+
+	// a fixed seed injects the same faults in the same order
+	replay, server := start(t, Config{Seed: 1, ServerErrors: 0.3, RateLimited: 0.2})
+	td = marketdata.NewTDAmeritrade(server.URL+"/v1", "key", staticToken("anything"))
+	for i := 0; i < 200; i++ {
+		get(td.Fundamentals("AAPL"))
+	}
+	if replay.Stats() != stats {
+		t.Error("Expected the same faults for the same seed ", replay.Stats(), stats)
+	}
+
+	limited, server := start(t, Config{RequestsPerMinute: 3})
+	td = marketdata.NewTDAmeritrade(server.URL+"/v1", "key", staticToken("anything"))
+	for i := 0; i < 5; i++ {
+		get(td.Fundamentals("AAPL"))
+	}
+	if stats := limited.Stats(); stats.OK != 3 || stats.RateLimited != 2 {
+		t.Error("Expected requests past the per minute limit to get 429 ", stats)
+	}
+	limited.now = func() time.Time { return time.Now().Add(time.Minute) }
+	if status, _ := get(td.Fundamentals("AAPL")); status != http.StatusOK {
+		t.Error("Expected the limit to reset after a minute got ", status)
+	}
+
+	slow, server := start(t, Config{Latency: 50 * time.Millisecond})
+	td = marketdata.NewTDAmeritrade(server.URL+"/v1", "key", staticToken("anything"))
+	began := time.Now()
+	get(td.Fundamentals("AAPL"))
+	if time.Since(began) < 50*time.Millisecond || slow.Stats().OK != 1 {
+		t.Error("Expected the response delayed")
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	s, server := start(t, Config{TokenTTL: time.Hour})
+	path := filepath.Join(t.TempDir(), "token.json")
+	expired := `{"Headers": {"Date": "` + time.Now().Add(-2*time.Hour).UTC().Format(http.TimeFormat) + `"},
+		"Data": {"access_token": "stale", "refresh_token": "refresh", "expires_in": 1800}}`
+	if err := os.WriteFile(path, []byte(expired), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := marketdata.NewTDAmeritrade(server.URL+"/v1", "key", staticToken("stale"))
+	if status, _ := get(stale.Fundamentals("AAPL")); status != http.StatusUnauthorized {
+		t.Error("Expected 401 for a token the server never issued got ", status)
+	}
+
+	tokens, err := token.NewAccessTokenService(token.Config{Path: path, TokenURL: server.URL + "/v1/oauth2/token", ClientID: "key@AMER.OAUTHAP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := marketdata.NewTDAmeritrade(server.URL+"/v1", "key", tokens)
+	if status, _ := get(td.Fundamentals("AAPL")); status != http.StatusOK {
+		t.Error("Expected 200 after refreshing the token got ", status)
+	}
+	if s.Stats().Refreshes != 1 {
+		t.Error("Expected one refresh ", s.Stats())
+	}
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if status, _ := get(td.Fundamentals("AAPL")); status != http.StatusUnauthorized {
+		t.Error("Expected 401 once the issued token expired got ", status)
+	}
+}
@@ -0,0 +1,193 @@
+// Package history backfills daily candles from directories of EODData files.
+// Bars are keyed by (symbol, date) in the candle store so files can be imported
+// any number of times and in any order, and each file's checksum is kept in
+// DailyImports so a rerun over years of history skips what is already loaded.
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/eoddata"
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+type Options struct {
+	Exchanges []string  /* only files for these exchanges, by file name */
+	From      time.Time /* inclusive, zero for no bound */
+	To        time.Time /* exclusive, zero for no bound */
+	Force     bool      /* reimport files whose checksum is already recorded */
+	DryRun    bool
+}
+
+// File is the outcome of importing one csv
+type File struct {
+	Path     string
+	Exchange string
+	Checksum string
+	Rows     int /* candles written */
+	Symbols  int
+	Filtered int /* rows outside From/To */
+	Skipped  bool
+}
+
+type Result struct {
+	Files    []File
+	Rows     int
+	Imported int
+	Skipped  int
+}
+
+type Importer interface {
+	ImportFile(path string) (File, error)
+	Import(paths ...string) (Result, error) /* files or directories, walked recursively */
+}
+
+type importer struct {
+	candles etl.CandleStore
+	ledger  Ledger
+	options Options
+}
+
+func NewImporter(store *etl.Store, options Options) Importer {
+	return newImporter(store.Candles, NewLedger(store), options)
+}
+
+func newImporter(candles etl.CandleStore, ledger Ledger, options Options) *importer {
+	return &importer{candles: candles, ledger: ledger, options: options}
+}
+
+func (im *importer) Import(paths ...string) (Result, error) {
+	var result Result
+	files, err := im.find(paths)
+	if err != nil {
+		return result, err
+	}
+	for _, path := range files {
+		file, err := im.ImportFile(path)
+		if err != nil {
+			return result, err
+		}
+		result.Files = append(result.Files, file)
+		result.Rows += file.Rows
+		if file.Skipped {
+			result.Skipped++
+		} else {
+			result.Imported++
+		}
+	}
+	return result, nil
+}
+
+func (im *importer) ImportFile(path string) (File, error) {
+	file := File{Path: path}
+	if exchange, _, err := eoddata.ParseFilename(path); err == nil {
+		file.Exchange = exchange
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return file, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	rows, err := eoddata.Read(io.TeeReader(f, hash))
+	if err != nil {
+		return file, fmt.Errorf("%v: %w", path, err)
+	}
+	file.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if !im.options.Force {
+		done, err := im.ledger.Imported(filepath.Base(path), file.Checksum)
+		if err != nil {
+			return file, err
+		}
+		if done {
+			file.Skipped = true
+			return file, nil
+		}
+	}
+
+	series := make(map[string][]shared.Candle)
+	for _, row := range rows {
+		if !im.inRange(row.Date) {
+			file.Filtered++
+			continue
+		}
+		series[row.Symbol] = append(series[row.Symbol], row.Candle())
+		file.Rows++
+	}
+	file.Symbols = len(series)
+	if im.options.DryRun {
+		return file, nil
+	}
+	if err := im.candles.UpsertMany(etl.Daily, series); err != nil {
+		return file, fmt.Errorf("%v: %w", path, err)
+	}
+	if file.Filtered > 0 {
+		return file, nil /* partly loaded, a wider range has to read it again */
+	}
+	return file, im.ledger.Record(filepath.Base(path), file)
+}
+
+func (im *importer) inRange(date time.Time) bool {
+	if !im.options.From.IsZero() && date.Before(im.options.From) {
+		return false
+	}
+	if !im.options.To.IsZero() && !date.Before(im.options.To) {
+		return false
+	}
+	return true
+}
+
+// find expands directories to their csv files, keeps the exchanges asked for and
+// orders by the date in the file name so a partial backfill loads oldest first
+func (im *importer) find(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".csv") {
+				return nil
+			}
+			if im.wanted(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		_, a, _ := eoddata.ParseFilename(files[i])
+		_, b, _ := eoddata.ParseFilename(files[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
+
+func (im *importer) wanted(path string) bool {
+	exchange, date, err := eoddata.ParseFilename(path)
+	if err != nil {
+		return len(im.options.Exchanges) == 0 /* rows are still filtered by date */
+	}
+	if len(im.options.Exchanges) > 0 && !shared.StringInSlice(exchange, im.options.Exchanges) {
+		return false
+	}
+	return im.inRange(date)
+}
@@ -0,0 +1,192 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+type memoryCandles struct {
+	bars   map[string]map[uint64]shared.Candle
+	writes int
+}
+
+func (m *memoryCandles) Upsert(symbol string, timeframe etl.Timeframe, candles []shared.Candle) error {
+	return m.UpsertMany(timeframe, map[string][]shared.Candle{symbol: candles})
+}
+
+func (m *memoryCandles) UpsertMany(timeframe etl.Timeframe, series map[string][]shared.Candle) error {
+	m.writes++
+	for symbol, candles := range series {
+		if m.bars[symbol] == nil {
+			m.bars[symbol] = make(map[uint64]shared.Candle)
+		}
+		for _, c := range candles {
+			m.bars[symbol][c.Datetime] = c
+		}
+	}
+	return nil
+}
+
+func (m *memoryCandles) Range(symbol string, timeframe etl.Timeframe, from time.Time, to time.Time) ([]shared.Candle, error) {
+	return nil, nil
+}
+
+func (m *memoryCandles) Last(symbol string, timeframe etl.Timeframe) (*shared.Candle, error) {
+	return nil, nil
+}
+
+type memoryLedger map[string]File
+
+func (l memoryLedger) Imported(name string, checksum string) (bool, error) {
+	return l[name].Checksum == checksum, nil
+}
+
+func (l memoryLedger) Record(name string, file File) error {
+	l[name] = file
+	return nil
+}
+
+func (l memoryLedger) List() ([]ImportDocument, error) {
+	return nil, nil
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const header = "Symbol,Date,Open,High,Low,Close,Volume\n"
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "2023", "NASDAQ_20230208.csv"), header+
+		"AAPL,08-Feb-2023,153.88,154.58,151.17,151.92,64120100\n"+
+		"MSFT,08-Feb-2023,273.2,276.76,266.21,266.73,54686000\n")
+	writeFile(t, filepath.Join(dir, "2023", "NASDAQ_20230207.csv"), header+
+		"AAPL,07-Feb-2023,150.64,155.23,150.64,154.65,83322600\n")
+	writeFile(t, filepath.Join(dir, "NYSE_20230208.csv"), header+
+		"IBM,08-Feb-2023,135.71,136.74,135.1,135.54,4000000\n")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not a csv")
+
+	store := &memoryCandles{bars: make(map[string]map[uint64]shared.Candle)}
+	ledger := memoryLedger{}
+	result, err := newImporter(store, ledger, Options{}).Import(dir)
+	if err != nil {
+		t.Fatal("Import failed ", err)
+	}
+	if result.Imported != 3 || result.Rows != 4 {
+		t.Fatal("Expected 3 files and 4 rows ", result)
+	}
+	if filepath.Base(result.Files[0].Path) != "NASDAQ_20230207.csv" {
+		t.Error("Expected the oldest file first ", result.Files[0].Path)
+	}
+	if len(store.bars["AAPL"]) != 2 || len(store.bars["IBM"]) != 1 {
+		t.Error("Missing daily bars ", store.bars)
+	}
+	feb8 := uint64(time.Date(2023, 2, 8, 0, 0, 0, 0, calendar.NewYork).UnixMilli())
+	if store.bars["MSFT"][feb8].Close != 266.73 {
+		t.Error("Expected MSFT stamped at midnight New York ", store.bars["MSFT"])
+	}
+
+	// a rerun skips unchanged files and reimports edited ones
+	writes := store.writes
+	writeFile(t, filepath.Join(dir, "NYSE_20230208.csv"), header+
+		"IBM,08-Feb-2023,135.71,136.74,135.1,135.6,4100000\n")
+	result, err = newImporter(store, ledger, Options{}).Import(dir)
+	if err != nil {
+		t.Fatal("Import failed ", err)
+	}
+	if result.Skipped != 2 || result.Imported != 1 || store.writes != writes+1 {
+		t.Error("Expected only the changed file imported ", result)
+	}
+	if len(store.bars["IBM"]) != 1 || store.bars["IBM"][feb8].Close != 135.6 {
+		t.Error("Expected the corrected bar to replace the first ", store.bars["IBM"])
+	}
+}
+
+func TestImportOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "NASDAQ_20230208.csv"), header+"AAPL,08-Feb-2023,1,1,1,1,1\n")
+	writeFile(t, filepath.Join(dir, "NYSE_20230208.csv"), header+"IBM,08-Feb-2023,1,1,1,1,1\n")
+	writeFile(t, filepath.Join(dir, "NASDAQ_20230207.csv"), header+"AAPL,07-Feb-2023,1,1,1,1,1\n")
+	writeFile(t, filepath.Join(dir, "AAPL.csv"), header+ /* history for one symbol */
+		"AAPL,03-Feb-2023,1,1,1,1,1\n"+
+		"AAPL,06-Feb-2023,1,1,1,1,1\n"+
+		"AAPL,07-Feb-2023,1,1,1,1,1\n")
+
+	store := &memoryCandles{bars: make(map[string]map[uint64]shared.Candle)}
+	ledger := memoryLedger{}
+	options := Options{
+		Exchanges: []string{"NASDAQ"},
+		From:      time.Date(2023, 2, 6, 0, 0, 0, 0, calendar.NewYork),
+		To:        time.Date(2023, 2, 8, 0, 0, 0, 0, calendar.NewYork),
+	}
+	result, err := newImporter(store, ledger, options).Import(dir)
+	if err != nil {
+		t.Fatal("Import failed ", err)
+	}
+	if len(result.Files) != 1 {
+		t.Fatal("Expected only NASDAQ_20230207.csv, AAPL.csv has no exchange ", result.Files)
+	}
+
+	options.Exchanges = nil
+	result, err = newImporter(store, ledger, options).Import(dir)
+	if err != nil {
+		t.Fatal("Import failed ", err)
+	}
+	if result.Skipped != 1 || result.Imported != 1 || result.Rows != 2 {
+		t.Error("Expected 2 rows of AAPL.csv in range ", result)
+	}
+	if _, ok := ledger["AAPL.csv"]; ok {
+		t.Error("A partly imported file should not be recorded")
+	}
+	if len(store.bars["AAPL"]) != 2 {
+		t.Error("Expected AAPL on the 6th and 7th ", store.bars["AAPL"])
+	}
+
+	options = Options{DryRun: true}
+	store = &memoryCandles{bars: make(map[string]map[uint64]shared.Candle)}
+	result, err = newImporter(store, memoryLedger{}, options).Import(dir)
+	if err != nil || result.Rows != 6 || store.writes != 0 {
+		t.Error("Dry run should count rows without writing ", result, err)
+	}
+}
+
+func TestImportSample(t *testing.T) {
+	store := &memoryCandles{bars: make(map[string]map[uint64]shared.Candle)}
+	file, err := newImporter(store, memoryLedger{}, Options{}).ImportFile("../data/NASDAQ_20230208.csv")
+	if err != nil {
+		t.Fatal("Import failed ", err)
+	}
+	if file.Exchange != "NASDAQ" || file.Rows == 0 || file.Symbols != len(store.bars) {
+		t.Error("Unexpected import of the sample file ", file.Exchange, file.Rows, file.Symbols)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	ledger := NewLedger(etl.NewMemoryStore())
+	ledger.Record("NYSE_20230208.csv", File{Exchange: "NYSE", Checksum: "b", Rows: 1})
+	ledger.Record("NASDAQ_20230208.csv", File{Exchange: "NASDAQ", Checksum: "a", Rows: 1})
+	ledger.Record("NASDAQ_20230208.csv", File{Exchange: "NASDAQ", Checksum: "c", Rows: 2})
+
+	if done, _ := ledger.Imported("NASDAQ_20230208.csv", "a"); done {
+		t.Error("A changed file should import again")
+	}
+	if done, _ := ledger.Imported("NASDAQ_20230208.csv", "c"); !done {
+		t.Error("Expected the recorded checksum to be imported")
+	}
+	docs, err := ledger.List()
+	if err != nil || len(docs) != 2 || docs[0].Name != "NASDAQ_20230208.csv" || docs[0].Rows != 2 {
+		t.Error("Expected one entry per file by name ", docs, err)
+	}
+}
@@ -0,0 +1,63 @@
+package history
+
+import (
+	"time"
+
+	"github.com/jaredtokuz/market-trader/etl"
+)
+
+const DailyImports = "DailyImports"
+
+// Ledger remembers which files were imported so reruns can skip them
+type Ledger interface {
+	Imported(name string, checksum string) (bool, error)
+	Record(name string, file File) error
+	List() ([]ImportDocument, error)
+}
+
+type ImportDocument struct {
+	Name       string    `json:"name" bson:"_id"` /* file name without the directory */
+	Exchange   string    `json:"exchange" bson:"exchange"`
+	Checksum   string    `json:"checksum" bson:"checksum"` /* sha256 of the contents */
+	Rows       int       `json:"rows" bson:"rows"`
+	Symbols    int       `json:"symbols" bson:"symbols"`
+	ImportedAt time.Time `json:"importedAt" bson:"importedAt"`
+}
+
+type ledger struct {
+	imports etl.DocumentStore
+}
+
+func NewLedger(store *etl.Store) Ledger {
+	return &ledger{imports: store.Documents(DailyImports)}
+}
+
+func (l *ledger) Imported(name string, checksum string) (bool, error) {
+	count, err := l.imports.Count(
+		etl.Filter{Field: "_id", Op: "eq", Value: name},
+		etl.Filter{Field: "checksum", Op: "eq", Value: checksum})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (l *ledger) Record(name string, file File) error {
+	doc := ImportDocument{
+		Name:       name,
+		Exchange:   file.Exchange,
+		Checksum:   file.Checksum,
+		Rows:       file.Rows,
+		Symbols:    file.Symbols,
+		ImportedAt: time.Now(),
+	}
+	return l.imports.Replace(name, doc)
+}
+
+func (l *ledger) List() ([]ImportDocument, error) {
+	var docs []ImportDocument
+	if err := l.imports.Find(etl.Query{Sort: []string{"_id"}}, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
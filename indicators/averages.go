@@ -0,0 +1,82 @@
+package indicators
+
+// SMA is the simple moving average of the last period values
+type SMA struct {
+	window *window
+	sum    float64
+}
+
+func NewSMA(period int) *SMA {
+	return &SMA{window: newWindow(period)}
+}
+
+func (s *SMA) Update(v float64) float64 {
+	if old, ok := s.window.push(v); ok {
+		s.sum -= old
+	}
+	s.sum += v
+	return s.Value()
+}
+
+func (s *SMA) Ready() bool {
+	return s.window.full
+}
+
+func (s *SMA) Value() float64 {
+	if s.window.len() == 0 {
+		return 0
+	}
+	return s.sum / float64(s.window.len())
+}
+
+// EMA is the exponential moving average, seeded with the SMA of the first period values
+type EMA struct {
+	k     float64
+	seed  *SMA
+	value float64
+	ready bool
+}
+
+func NewEMA(period int) *EMA {
+	return &EMA{k: 2 / float64(period+1), seed: NewSMA(period)}
+}
+
+func (e *EMA) Update(v float64) float64 {
+	if !e.ready {
+		e.value = e.seed.Update(v)
+		e.ready = e.seed.Ready()
+		return e.value
+	}
+	e.value = v*e.k + e.value*(1-e.k)
+	return e.value
+}
+
+func (e *EMA) Ready() bool {
+	return e.ready
+}
+
+func (e *EMA) Value() float64 {
+	return e.value
+}
+
+// wilder is Wilder's smoothing, an average of the first period values then
+// avg = (avg * (period - 1) + v) / period
+type wilder struct {
+	period float64
+	n      int
+	value  float64
+}
+
+func (w *wilder) update(v float64) float64 {
+	w.n++
+	if w.n <= int(w.period) {
+		w.value += (v - w.value) / float64(w.n)
+		return w.value
+	}
+	w.value = (w.value*(w.period-1) + v) / w.period
+	return w.value
+}
+
+func (w *wilder) ready() bool {
+	return w.n >= int(w.period)
+}
@@ -0,0 +1,179 @@
+// Package indicators computes technical indicators over candles. Each indicator
+// is a streaming type updated one bar at a time, so a series can be extended
+// with new bars without recomputing from the start.
+package indicators
+
+import (
+	"math"
+
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+// Snapshot is the latest value of every indicator, nil until enough bars are seen
+type Snapshot struct {
+	Datetime        uint64   `json:"datetime" bson:"datetime"` /* bar the values were computed at */
+	SMA20           *float64 `json:"sma20,omitempty" bson:"sma20,omitempty"`
+	SMA50           *float64 `json:"sma50,omitempty" bson:"sma50,omitempty"`
+	EMA12           *float64 `json:"ema12,omitempty" bson:"ema12,omitempty"`
+	EMA26           *float64 `json:"ema26,omitempty" bson:"ema26,omitempty"`
+	RSI14           *float64 `json:"rsi14,omitempty" bson:"rsi14,omitempty"`
+	MACD            *float64 `json:"macd,omitempty" bson:"macd,omitempty"`
+	MACDSignal      *float64 `json:"macdSignal,omitempty" bson:"macdSignal,omitempty"`
+	MACDHist        *float64 `json:"macdHist,omitempty" bson:"macdHist,omitempty"`
+	BollingerUpper  *float64 `json:"bollingerUpper,omitempty" bson:"bollingerUpper,omitempty"`
+	BollingerMiddle *float64 `json:"bollingerMiddle,omitempty" bson:"bollingerMiddle,omitempty"`
+	BollingerLower  *float64 `json:"bollingerLower,omitempty" bson:"bollingerLower,omitempty"`
+	ATR14           *float64 `json:"atr14,omitempty" bson:"atr14,omitempty"`
+	VWAP            *float64 `json:"vwap,omitempty" bson:"vwap,omitempty"`
+	OBV             *float64 `json:"obv,omitempty" bson:"obv,omitempty"`
+	StochK          *float64 `json:"stochK,omitempty" bson:"stochK,omitempty"`
+	StochD          *float64 `json:"stochD,omitempty" bson:"stochD,omitempty"`
+	ADX14           *float64 `json:"adx14,omitempty" bson:"adx14,omitempty"`
+	PlusDI          *float64 `json:"plusDI,omitempty" bson:"plusDI,omitempty"`
+	MinusDI         *float64 `json:"minusDI,omitempty" bson:"minusDI,omitempty"`
+}
+
+// Set is every indicator in a Snapshot with the standard periods
+type Set struct {
+	SMA20      *SMA
+	SMA50      *SMA
+	EMA12      *EMA
+	EMA26      *EMA
+	RSI14      *RSI
+	MACD       *MACD
+	Bollinger  *Bollinger
+	ATR14      *ATR
+	VWAP       *VWAP
+	OBV        *OBV
+	Stochastic *Stochastic
+	ADX14      *ADX
+	last       uint64
+}
+
+func NewSet() *Set {
+	return &Set{
+		SMA20:      NewSMA(20),
+		SMA50:      NewSMA(50),
+		EMA12:      NewEMA(12),
+		EMA26:      NewEMA(26),
+		RSI14:      NewRSI(14),
+		MACD:       NewMACD(12, 26, 9),
+		Bollinger:  NewBollinger(20, 2),
+		ATR14:      NewATR(14),
+		VWAP:       NewVWAP(),
+		OBV:        NewOBV(),
+		Stochastic: NewStochastic(14, 3),
+		ADX14:      NewADX(14),
+	}
+}
+
+func (s *Set) Update(c shared.Candle) {
+	s.SMA20.Update(c.Close)
+	s.SMA50.Update(c.Close)
+	s.EMA12.Update(c.Close)
+	s.EMA26.Update(c.Close)
+	s.RSI14.Update(c.Close)
+	s.MACD.Update(c.Close)
+	s.Bollinger.Update(c.Close)
+	s.ATR14.Update(c)
+	s.VWAP.Update(c)
+	s.OBV.Update(c)
+	s.Stochastic.Update(c)
+	s.ADX14.Update(c)
+	s.last = c.Datetime
+}
+
+func (s *Set) Snapshot() Snapshot {
+	snapshot := Snapshot{Datetime: s.last}
+	if s.SMA20.Ready() {
+		snapshot.SMA20 = value(s.SMA20.Value())
+	}
+	if s.SMA50.Ready() {
+		snapshot.SMA50 = value(s.SMA50.Value())
+	}
+	if s.EMA12.Ready() {
+		snapshot.EMA12 = value(s.EMA12.Value())
+	}
+	if s.EMA26.Ready() {
+		snapshot.EMA26 = value(s.EMA26.Value())
+	}
+	if s.RSI14.Ready() {
+		snapshot.RSI14 = value(s.RSI14.Value())
+	}
+	if s.MACD.Ready() {
+		macd, signal, hist := s.MACD.Values()
+		snapshot.MACD, snapshot.MACDSignal, snapshot.MACDHist = value(macd), value(signal), value(hist)
+	}
+	if s.Bollinger.Ready() {
+		upper, middle, lower := s.Bollinger.Values()
+		snapshot.BollingerUpper, snapshot.BollingerMiddle, snapshot.BollingerLower = value(upper), value(middle), value(lower)
+	}
+	if s.ATR14.Ready() {
+		snapshot.ATR14 = value(s.ATR14.Value())
+	}
+	if s.VWAP.Ready() {
+		snapshot.VWAP = value(s.VWAP.Value())
+	}
+	if s.OBV.Ready() {
+		snapshot.OBV = value(s.OBV.Value())
+	}
+	if s.Stochastic.Ready() {
+		k, d := s.Stochastic.Values()
+		snapshot.StochK, snapshot.StochD = value(k), value(d)
+	}
+	if s.ADX14.Ready() {
+		adx, plus, minus := s.ADX14.Values()
+		snapshot.ADX14, snapshot.PlusDI, snapshot.MinusDI = value(adx), value(plus), value(minus)
+	}
+	return snapshot
+}
+
+// Compute runs every indicator over candles, oldest first
+func Compute(candles []shared.Candle) Snapshot {
+	set := NewSet()
+	for _, c := range candles {
+		set.Update(c)
+	}
+	return set.Snapshot()
+}
+
+// value rounds to 4 places for storage
+func value(v float64) *float64 {
+	r := math.Round(v*10000) / 10000
+	return &r
+}
+
+// window is a fixed size ring of the most recent values
+type window struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func newWindow(size int) *window {
+	return &window{values: make([]float64, size)}
+}
+
+// push adds v and returns the value it replaced, ok false until the window is full
+func (w *window) push(v float64) (old float64, ok bool) {
+	old, ok = w.values[w.next], w.full
+	w.values[w.next] = v
+	w.next = (w.next + 1) % len(w.values)
+	if w.next == 0 {
+		w.full = true
+	}
+	return old, ok
+}
+
+func (w *window) len() int {
+	if w.full {
+		return len(w.values)
+	}
+	return w.next
+}
+
+func (w *window) each(f func(v float64)) {
+	for i := 0; i < w.len(); i++ {
+		f(w.values[i])
+	}
+}
@@ -0,0 +1,210 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// bars builds 15 minute candles from closes with a 1 point range around each close
+func bars(closes ...float64) []shared.Candle {
+	start := time.Date(2023, 2, 8, 14, 30, 0, 0, time.UTC)
+	candles := make([]shared.Candle, len(closes))
+	for i, c := range closes {
+		candles[i] = shared.Candle{
+			Datetime: uint64(start.Add(time.Duration(i) * 15 * time.Minute).UnixMilli()),
+			Open:     c, High: c + 0.5, Low: c - 0.5, Close: c, Volume: 100,
+		}
+	}
+	return candles
+}
+
+func rising(n int) []float64 {
+	closes := make([]float64, n)
+	for i := range closes {
+		closes[i] = float64(i + 1)
+	}
+	return closes
+}
+
+func TestSMA(t *testing.T) {
+	sma := NewSMA(3)
+	for _, v := range []float64{1, 2, 3, 4, 5} {
+		sma.Update(v)
+	}
+	if !sma.Ready() || !near(sma.Value(), 4) {
+		t.Error("Expected SMA 4, got ", sma.Value())
+	}
+}
+
+func TestEMA(t *testing.T) {
+	// seeded with SMA(1,2,3) = 2, k = 0.5, so each following bar lands one below the close
+	ema := NewEMA(3)
+	for _, v := range rising(10) {
+		ema.Update(v)
+	}
+	if !ema.Ready() || !near(ema.Value(), 9) {
+		t.Error("Expected EMA 9, got ", ema.Value())
+	}
+}
+
+func TestRSI(t *testing.T) {
+	up := NewRSI(14)
+	for _, v := range rising(15) {
+		up.Update(v)
+	}
+	if !up.Ready() || up.Value() != 100 {
+		t.Error("Only gains should be RSI 100, got ", up.Value())
+	}
+
+	// alternating +1 -1 has equal average gain and loss
+	even := NewRSI(4)
+	for _, v := range []float64{10, 11, 10, 11, 10} {
+		even.Update(v)
+	}
+	if !near(even.Value(), 50) {
+		t.Error("Expected RSI 50, got ", even.Value())
+	}
+}
+
+func TestMACD(t *testing.T) {
+	macd := NewMACD(12, 26, 9)
+	for _, c := range bars(make([]float64, 40)...) {
+		macd.Update(c.Close + 100)
+	}
+	line, signal, hist := macd.Values()
+	if !macd.Ready() || !near(line, 0) || !near(signal, 0) || !near(hist, 0) {
+		t.Error("Flat prices should have a zero MACD ", line, signal, hist)
+	}
+
+	macd = NewMACD(12, 26, 9)
+	for _, v := range rising(40) {
+		macd.Update(v)
+	}
+	line, _, _ = macd.Values()
+	if line <= 0 {
+		t.Error("Rising prices should have a positive MACD ", line)
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	bands := NewBollinger(4, 2)
+	for _, v := range []float64{2, 4, 4, 6} {
+		bands.Update(v)
+	}
+	// mean 4, population std sqrt(2)
+	upper, middle, lower := bands.Values()
+	if !near(middle, 4) || !near(upper, 4+2*math.Sqrt2) || !near(lower, 4-2*math.Sqrt2) {
+		t.Error("Unexpected bands ", upper, middle, lower)
+	}
+}
+
+func TestATR(t *testing.T) {
+	atr := NewATR(3)
+	for _, c := range bars(10, 10, 10, 10) {
+		atr.Update(c)
+	}
+	if !atr.Ready() || !near(atr.Value(), 1) {
+		t.Error("Expected ATR 1, got ", atr.Value())
+	}
+
+	// gap up: true range extends to the previous close
+	atr = NewATR(1)
+	for _, c := range bars(10, 15) {
+		atr.Update(c)
+	}
+	if !near(atr.Value(), 5.5) {
+		t.Error("Expected gap true range 5.5, got ", atr.Value())
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	candles := bars(10, 20)
+	candles[1].Volume = 300
+	vwap := NewVWAP()
+	for _, c := range candles {
+		vwap.Update(c)
+	}
+	if !near(vwap.Value(), (10*100+20*300)/400.0) {
+		t.Error("Unexpected VWAP ", vwap.Value())
+	}
+
+	// next trading day starts over
+	next := candles[1]
+	next.Datetime += uint64(24 * time.Hour / time.Millisecond)
+	if v := vwap.Update(next); !near(v, 20) {
+		t.Error("VWAP should reset each day, got ", v)
+	}
+}
+
+func TestOBV(t *testing.T) {
+	obv := NewOBV()
+	for _, c := range bars(10, 11, 11, 9, 12) {
+		obv.Update(c)
+	}
+	// +100, 0, -100, +100
+	if !near(obv.Value(), 100) {
+		t.Error("Expected OBV 100, got ", obv.Value())
+	}
+}
+
+func TestStochastic(t *testing.T) {
+	stoch := NewStochastic(5, 3)
+	for _, c := range bars(rising(10)...) {
+		stoch.Update(c)
+	}
+	// close is 0.5 below the high of the window spanning 5.5 points
+	k, d := stoch.Values()
+	expected := (10 - 5.5) / (10.5 - 5.5) * 100
+	if !stoch.Ready() || !near(k, expected) || !near(d, expected) {
+		t.Error("Unexpected stochastic ", k, d)
+	}
+}
+
+func TestADX(t *testing.T) {
+	adx := NewADX(14)
+	for _, c := range bars(rising(40)...) {
+		adx.Update(c)
+	}
+	value, plus, minus := adx.Values()
+	if !adx.Ready() {
+		t.Fatal("ADX should be ready after 40 bars")
+	}
+	if minus != 0 || plus <= 0 || !near(value, 100) {
+		t.Error("Steady uptrend should be all +DI ", value, plus, minus)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	snapshot := Compute(bars(rising(30)...))
+	if snapshot.SMA20 == nil || *snapshot.SMA20 != 20.5 {
+		t.Error("Unexpected SMA20 ", snapshot.SMA20)
+	}
+	if snapshot.SMA50 != nil || snapshot.MACD != nil {
+		t.Error("Indicators without enough bars should be nil")
+	}
+	if snapshot.RSI14 == nil || snapshot.ATR14 == nil || snapshot.ADX14 == nil || snapshot.VWAP == nil {
+		t.Error("Expected indicators with 30 bars ", snapshot)
+	}
+
+	// incremental updates match a full recompute
+	candles := bars(rising(60)...)
+	set := NewSet()
+	for _, c := range candles[:45] {
+		set.Update(c)
+	}
+	for _, c := range candles[45:] {
+		set.Update(c)
+	}
+	full := Compute(candles)
+	incremental := set.Snapshot()
+	if *full.MACD != *incremental.MACD || *full.SMA50 != *incremental.SMA50 || full.Datetime != incremental.Datetime {
+		t.Error("Incremental snapshot differs from full compute")
+	}
+}
@@ -0,0 +1,122 @@
+package indicators
+
+import "github.com/jaredtokuz/market-trader/shared"
+
+// RSI is Wilder's relative strength index
+type RSI struct {
+	prev    float64
+	hasPrev bool
+	avgGain wilder
+	avgLoss wilder
+}
+
+func NewRSI(period int) *RSI {
+	return &RSI{avgGain: wilder{period: float64(period)}, avgLoss: wilder{period: float64(period)}}
+}
+
+func (r *RSI) Update(close float64) float64 {
+	if !r.hasPrev {
+		r.prev, r.hasPrev = close, true
+		return r.Value()
+	}
+	change := close - r.prev
+	r.prev = close
+	if change > 0 {
+		r.avgGain.update(change)
+		r.avgLoss.update(0)
+	} else {
+		r.avgGain.update(0)
+		r.avgLoss.update(-change)
+	}
+	return r.Value()
+}
+
+func (r *RSI) Ready() bool {
+	return r.avgGain.ready()
+}
+
+func (r *RSI) Value() float64 {
+	if r.avgLoss.value == 0 {
+		if r.avgGain.value == 0 {
+			return 50
+		}
+		return 100
+	}
+	rs := r.avgGain.value / r.avgLoss.value
+	return 100 - 100/(1+rs)
+}
+
+// MACD is the fast EMA minus the slow EMA, with an EMA of that line as signal
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+}
+
+func NewMACD(fast int, slow int, signal int) *MACD {
+	return &MACD{fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal)}
+}
+
+func (m *MACD) Update(close float64) {
+	m.fast.Update(close)
+	m.slow.Update(close)
+	if m.slow.Ready() {
+		m.signal.Update(m.fast.Value() - m.slow.Value())
+	}
+}
+
+func (m *MACD) Ready() bool {
+	return m.signal.Ready()
+}
+
+// Values returns the macd line, signal line and histogram
+func (m *MACD) Values() (macd float64, signal float64, hist float64) {
+	macd = m.fast.Value() - m.slow.Value()
+	signal = m.signal.Value()
+	return macd, signal, macd - signal
+}
+
+// Stochastic is the %K position of the close in the last kPeriod range with %D its SMA
+type Stochastic struct {
+	highs *window
+	lows  *window
+	k     float64
+	d     *SMA
+}
+
+func NewStochastic(kPeriod int, dPeriod int) *Stochastic {
+	return &Stochastic{highs: newWindow(kPeriod), lows: newWindow(kPeriod), d: NewSMA(dPeriod)}
+}
+
+func (s *Stochastic) Update(c shared.Candle) {
+	s.highs.push(c.High)
+	s.lows.push(c.Low)
+	if !s.highs.full {
+		return
+	}
+	highest, lowest := c.High, c.Low
+	s.highs.each(func(v float64) {
+		if v > highest {
+			highest = v
+		}
+	})
+	s.lows.each(func(v float64) {
+		if v < lowest {
+			lowest = v
+		}
+	})
+	s.k = 50
+	if highest > lowest {
+		s.k = (c.Close - lowest) / (highest - lowest) * 100
+	}
+	s.d.Update(s.k)
+}
+
+func (s *Stochastic) Ready() bool {
+	return s.d.Ready()
+}
+
+// Values returns %K and %D
+func (s *Stochastic) Values() (k float64, d float64) {
+	return s.k, s.d.Value()
+}
@@ -0,0 +1,147 @@
+package indicators
+
+import (
+	"math"
+
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+// Bollinger bands are the SMA plus and minus k population standard deviations
+type Bollinger struct {
+	sma *SMA
+	k   float64
+}
+
+func NewBollinger(period int, k float64) *Bollinger {
+	return &Bollinger{sma: NewSMA(period), k: k}
+}
+
+func (b *Bollinger) Update(close float64) {
+	b.sma.Update(close)
+}
+
+func (b *Bollinger) Ready() bool {
+	return b.sma.Ready()
+}
+
+// Values returns the upper, middle and lower bands
+func (b *Bollinger) Values() (upper float64, middle float64, lower float64) {
+	middle = b.sma.Value()
+	var variance float64
+	b.sma.window.each(func(v float64) {
+		variance += (v - middle) * (v - middle)
+	})
+	std := math.Sqrt(variance / float64(b.sma.window.len()))
+	return middle + b.k*std, middle, middle - b.k*std
+}
+
+// trueRange is the bar range extended to the previous close
+type trueRange struct {
+	prevClose float64
+	hasPrev   bool
+}
+
+func (t *trueRange) update(c shared.Candle) float64 {
+	tr := c.High - c.Low
+	if t.hasPrev {
+		tr = math.Max(tr, math.Max(math.Abs(c.High-t.prevClose), math.Abs(c.Low-t.prevClose)))
+	}
+	t.prevClose, t.hasPrev = c.Close, true
+	return tr
+}
+
+// ATR is Wilder's average true range
+type ATR struct {
+	tr  trueRange
+	avg wilder
+}
+
+func NewATR(period int) *ATR {
+	return &ATR{avg: wilder{period: float64(period)}}
+}
+
+func (a *ATR) Update(c shared.Candle) float64 {
+	return a.avg.update(a.tr.update(c))
+}
+
+func (a *ATR) Ready() bool {
+	return a.avg.ready()
+}
+
+func (a *ATR) Value() float64 {
+	return a.avg.value
+}
+
+// ADX is Wilder's average directional index with the +DI and -DI lines
+type ADX struct {
+	period  float64
+	tr      trueRange
+	prev    shared.Candle
+	hasPrev bool
+	n       int
+	sumTR   float64
+	sumPlus float64
+	sumMin  float64
+	plusDI  float64
+	minusDI float64
+	adx     wilder
+}
+
+func NewADX(period int) *ADX {
+	return &ADX{period: float64(period), adx: wilder{period: float64(period)}}
+}
+
+func (a *ADX) Update(c shared.Candle) {
+	tr := a.tr.update(c)
+	if !a.hasPrev {
+		a.prev, a.hasPrev = c, true
+		return
+	}
+	up := c.High - a.prev.High
+	down := a.prev.Low - c.Low
+	a.prev = c
+
+	var plusDM, minusDM float64
+	if up > down && up > 0 {
+		plusDM = up
+	}
+	if down > up && down > 0 {
+		minusDM = down
+	}
+
+	// sums over the first period, then Wilder smoothed sums
+	a.n++
+	if a.n <= int(a.period) {
+		a.sumTR += tr
+		a.sumPlus += plusDM
+		a.sumMin += minusDM
+		if a.n < int(a.period) {
+			return
+		}
+	} else {
+		a.sumTR = a.sumTR - a.sumTR/a.period + tr
+		a.sumPlus = a.sumPlus - a.sumPlus/a.period + plusDM
+		a.sumMin = a.sumMin - a.sumMin/a.period + minusDM
+	}
+
+	if a.sumTR == 0 {
+		a.plusDI, a.minusDI = 0, 0
+	} else {
+		a.plusDI = 100 * a.sumPlus / a.sumTR
+		a.minusDI = 100 * a.sumMin / a.sumTR
+	}
+	var dx float64
+	if a.plusDI+a.minusDI > 0 {
+		dx = 100 * math.Abs(a.plusDI-a.minusDI) / (a.plusDI + a.minusDI)
+	}
+	a.adx.update(dx)
+}
+
+func (a *ADX) Ready() bool {
+	return a.adx.ready()
+}
+
+// Values returns ADX, +DI and -DI
+func (a *ADX) Values() (adx float64, plusDI float64, minusDI float64) {
+	return a.adx.value, a.plusDI, a.minusDI
+}
@@ -0,0 +1,74 @@
+package indicators
+
+import (
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+// VWAP is the volume weighted average typical price, reset each trading day
+type VWAP struct {
+	day    string
+	volume float64
+	pv     float64
+	last   float64
+}
+
+func NewVWAP() *VWAP {
+	return &VWAP{}
+}
+
+func (v *VWAP) Update(c shared.Candle) float64 {
+	day := time.UnixMilli(int64(c.Datetime)).In(calendar.NewYork).Format("2006-01-02")
+	if day != v.day {
+		v.day, v.volume, v.pv = day, 0, 0
+	}
+	typical := (c.High + c.Low + c.Close) / 3
+	v.last = typical
+	v.volume += float64(c.Volume)
+	v.pv += typical * float64(c.Volume)
+	return v.Value()
+}
+
+func (v *VWAP) Ready() bool {
+	return v.day != ""
+}
+
+func (v *VWAP) Value() float64 {
+	if v.volume == 0 {
+		return v.last
+	}
+	return v.pv / v.volume
+}
+
+// OBV is on balance volume, volume added on up closes and subtracted on down closes
+type OBV struct {
+	prevClose float64
+	hasPrev   bool
+	value     float64
+}
+
+func NewOBV() *OBV {
+	return &OBV{}
+}
+
+func (o *OBV) Update(c shared.Candle) float64 {
+	if o.hasPrev {
+		if c.Close > o.prevClose {
+			o.value += float64(c.Volume)
+		} else if c.Close < o.prevClose {
+			o.value -= float64(c.Volume)
+		}
+	}
+	o.prevClose, o.hasPrev = c.Close, true
+	return o.value
+}
+
+func (o *OBV) Ready() bool {
+	return o.hasPrev
+}
+
+func (o *OBV) Value() float64 {
+	return o.value
+}
@@ -0,0 +1,103 @@
+package marketdata
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/token"
+)
+
+// MarketDataProvider builds authorized requests for a broker's market data api
+// and converts its responses to the TD Ameritrade shape the etl package reads
+type MarketDataProvider interface {
+	Name() string
+	Fundamentals(symbol string) (*http.Request, error)
+	PriceHistory(symbol string, query PriceHistoryQuery) (*http.Request, error)
+	Quotes(symbols []string) (*http.Request, error)
+	Normalize(kind Kind, body map[string]interface{}) map[string]interface{}
+	Unauthorized(req *http.Request) /* req was answered 401, its token is refreshed before the next request */
+}
+
+// Kind is the type of request a response body came from
+type Kind string
+
+const (
+	FundamentalsKind Kind = "fundamentals"
+	PriceHistoryKind Kind = "pricehistory"
+	QuotesKind       Kind = "quotes"
+)
+
+type PriceHistoryQuery struct {
+	PeriodType            string // default day
+	FrequencyType         string // ex minute, daily
+	Frequency             int    // ex 5
+	StartDate             time.Time
+	EndDate               time.Time
+	NeedExtendedHoursData bool
+}
+
+// Provider names accepted by MARKET_DATA_PROVIDER
+const (
+	TDAmeritradeProvider = "td"
+	SchwabProvider       = "schwab"
+)
+
+type Config struct {
+	Provider string /* td or schwab */
+	BaseURL  string /* overrides the provider default, ex a local stand in */
+	ApiKey   string /* TD Ameritrade only */
+}
+
+// ConfigFromEnv reads MARKET_DATA_PROVIDER, MARKET_DATA_BASE_URL and API_KEY
+func ConfigFromEnv() Config {
+	return Config{
+		Provider: os.Getenv("MARKET_DATA_PROVIDER"),
+		BaseURL:  os.Getenv("MARKET_DATA_BASE_URL"),
+		ApiKey:   os.Getenv("API_KEY"),
+	}
+}
+
+// invalidate drops the bearer token req was sent with
+func invalidate(accessTokens token.AccessTokenService, req *http.Request) {
+	if accessTokens == nil {
+		return
+	}
+	accessTokens.Invalidate(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+}
+
+func New(config Config, token token.AccessTokenService) (MarketDataProvider, error) {
+	switch config.Provider {
+	case TDAmeritradeProvider, "":
+		baseURL := config.BaseURL
+		if baseURL == "" {
+			baseURL = TDA_BASE_URL
+		}
+		return NewTDAmeritrade(baseURL, config.ApiKey, token), nil
+	case SchwabProvider:
+		baseURL := config.BaseURL
+		if baseURL == "" {
+			baseURL = SCHWAB_BASE_URL
+		}
+		return NewSchwab(baseURL, token), nil
+	}
+	return nil, errors.New("unknown market data provider: " + config.Provider)
+}
+
+func addPriceHistoryQuery(query url.Values, p PriceHistoryQuery) {
+	query.Add("periodType", p.PeriodType)
+	query.Add("frequencyType", p.FrequencyType)
+	query.Add("frequency", strconv.Itoa(p.Frequency))
+	query.Add("startDate", stringFormatDate(p.StartDate))
+	query.Add("endDate", stringFormatDate(p.EndDate))
+	query.Add("needExtendedHoursData", strconv.FormatBool(p.NeedExtendedHoursData))
+}
+
+// unix milliseconds
+func stringFormatDate(t time.Time) string {
+	return strconv.FormatInt(t.Unix()*1000, 10)
+}
@@ -0,0 +1,126 @@
+package marketdata
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jaredtokuz/market-trader/token"
+)
+
+const SCHWAB_BASE_URL = "https://api.schwabapi.com/marketdata/v1"
+
+type schwab struct {
+	baseURL string
+	token   token.AccessTokenService
+}
+
+// NewSchwab is the Schwab Trader API, successor to the TD Ameritrade api.
+// Auth is the oauth bearer token only, there is no apikey query param.
+func NewSchwab(baseURL string, token token.AccessTokenService) MarketDataProvider {
+	return &schwab{baseURL: baseURL, token: token}
+}
+
+func (s *schwab) Name() string {
+	return SchwabProvider
+}
+
+func (s *schwab) Fundamentals(symbol string) (*http.Request, error) {
+	req, err := s.newRequest(s.baseURL + "/instruments")
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	query.Add("symbol", symbol)
+	query.Add("projection", "fundamental")
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+}
+
+func (s *schwab) PriceHistory(symbol string, p PriceHistoryQuery) (*http.Request, error) {
+	req, err := s.newRequest(s.baseURL + "/pricehistory")
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	query.Add("symbol", symbol)
+	addPriceHistoryQuery(query, p)
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+}
+
+func (s *schwab) Quotes(symbols []string) (*http.Request, error) {
+	req, err := s.newRequest(s.baseURL + "/quotes")
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	query.Add("symbols", strings.Join(symbols, ","))
+	query.Add("fields", "quote")
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+}
+
+// Normalize reshapes Schwab responses:
+//
+//	instruments {"instruments": [{symbol...}]} -> {symbol: {...}}
+//	quotes      {symbol: {quote: {...}}}       -> {symbol: {...}}
+//
+// price history already matches TD
+func (s *schwab) Normalize(kind Kind, body map[string]interface{}) map[string]interface{} {
+	switch kind {
+	case FundamentalsKind:
+		instruments, ok := body["instruments"].([]interface{})
+		if !ok {
+			return body
+		}
+		normalized := map[string]interface{}{}
+		for _, i := range instruments {
+			instrument, ok := i.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if symbol, ok := instrument["symbol"].(string); ok {
+				normalized[symbol] = instrument
+			}
+		}
+		return normalized
+	case QuotesKind:
+		normalized := map[string]interface{}{}
+		for symbol, q := range body {
+			entry, ok := q.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			quote, ok := entry["quote"].(map[string]interface{})
+			if !ok {
+				normalized[symbol] = entry
+				continue
+			}
+			quote["symbol"] = symbol
+			if quoteTime, ok := quote["quoteTime"]; ok {
+				quote["quoteTimeInLong"] = quoteTime
+			}
+			normalized[symbol] = quote
+		}
+		return normalized
+	}
+	return body
+}
+
+func (s *schwab) Unauthorized(req *http.Request) {
+	invalidate(s.token, req)
+}
+
+func (s *schwab) newRequest(url string) (*http.Request, error) {
+	accessToken, err := s.token.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Accept", "application/json")
+	return req, nil
+}
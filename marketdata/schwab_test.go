@@ -0,0 +1,160 @@
+package marketdata
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type staticToken string
+
+func (s staticToken) Fetch() (string, error) {
+	return string(s), nil
+}
+
+func (s staticToken) Invalidate(accessToken string) {}
+
+// schwabStandIn serves canned Schwab Trader API responses and records the last request
+func schwabStandIn(t *testing.T, last **http.Request) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/marketdata/v1/instruments", func(w http.ResponseWriter, r *http.Request) {
+		*last = r
+		w.Write([]byte(`{"instruments": [{
+			"cusip": "88160R101", "symbol": "TSLA", "description": "Tesla Inc", "exchange": "NASDAQ", "assetType": "EQUITY",
+			"fundamental": {"symbol": "TSLA", "high52": 299.29, "low52": 138.8, "marketCap": 629342.5, "vol10DayAvg": 101234567}
+		}]}`))
+	})
+	mux.HandleFunc("/marketdata/v1/pricehistory", func(w http.ResponseWriter, r *http.Request) {
+		*last = r
+		w.Write([]byte(`{"symbol": "TSLA", "empty": false, "candles": [
+			{"open": 200.1, "high": 201.5, "low": 199.8, "close": 201.2, "volume": 150000, "datetime": 1675866600000}
+		]}`))
+	})
+	mux.HandleFunc("/marketdata/v1/quotes", func(w http.ResponseWriter, r *http.Request) {
+		*last = r
+		w.Write([]byte(`{"TSLA": {"assetMainType": "EQUITY", "symbol": "TSLA",
+			"quote": {"lastPrice": 201.2, "bidPrice": 201.1, "askPrice": 201.3, "totalVolume": 1500000, "quoteTime": 1675866600000}
+		}}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func call(t *testing.T, req *http.Request, err error) map[string]interface{} {
+	if err != nil {
+		t.Fatal("Failed to build request ", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Request failed ", err)
+	}
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal("Failed to decode body ", err)
+	}
+	return body
+}
+
+func newTestSchwab(t *testing.T, last **http.Request) MarketDataProvider {
+	server := schwabStandIn(t, last)
+	provider, err := New(Config{Provider: SchwabProvider, BaseURL: server.URL + "/marketdata/v1"}, staticToken("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestSchwabFundamentals(t *testing.T) {
+	var last *http.Request
+	provider := newTestSchwab(t, &last)
+
+	req, err := provider.Fundamentals("TSLA")
+	body := provider.Normalize(FundamentalsKind, call(t, req, err))
+
+	if last.Header.Get("Authorization") != "Bearer abc" {
+		t.Error("Missing bearer token ", last.Header)
+	}
+	query := last.URL.Query()
+	if query.Get("symbol") != "TSLA" || query.Get("projection") != "fundamental" {
+		t.Error("Unexpected query ", query)
+	}
+	if query.Has("apikey") {
+		t.Error("Schwab does not take an apikey")
+	}
+
+	instrument, ok := body["TSLA"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Instruments not keyed by symbol ", body)
+	}
+	fundamental := instrument["fundamental"].(map[string]interface{})
+	if fundamental["high52"] != 299.29 {
+		t.Error("Fundamental lost in normalize ", fundamental)
+	}
+}
+
+func TestSchwabPriceHistory(t *testing.T) {
+	var last *http.Request
+	provider := newTestSchwab(t, &last)
+
+	start := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 7)
+	req, err := provider.PriceHistory("TSLA", PriceHistoryQuery{
+		PeriodType:            "day",
+		FrequencyType:         "minute",
+		Frequency:             30,
+		StartDate:             start,
+		EndDate:               end,
+		NeedExtendedHoursData: true,
+	})
+	body := provider.Normalize(PriceHistoryKind, call(t, req, err))
+
+	query := last.URL.Query()
+	expected := map[string]string{
+		"symbol":                "TSLA",
+		"periodType":            "day",
+		"frequencyType":         "minute",
+		"frequency":             "30",
+		"startDate":             "1675209600000",
+		"endDate":               "1675814400000",
+		"needExtendedHoursData": "true",
+	}
+	for key, value := range expected {
+		if query.Get(key) != value {
+			t.Errorf("Query %v = %v, expected %v", key, query.Get(key), value)
+		}
+	}
+
+	candles, ok := body["candles"].([]interface{})
+	if !ok || len(candles) != 1 || body["symbol"] != "TSLA" {
+		t.Error("Unexpected price history ", body)
+	}
+}
+
+func TestSchwabQuotes(t *testing.T) {
+	var last *http.Request
+	provider := newTestSchwab(t, &last)
+
+	req, err := provider.Quotes([]string{"TSLA", "MSFT"})
+	body := provider.Normalize(QuotesKind, call(t, req, err))
+
+	if last.URL.Query().Get("symbols") != "TSLA,MSFT" {
+		t.Error("Unexpected symbols ", last.URL.Query())
+	}
+	quote, ok := body["TSLA"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Quotes not keyed by symbol ", body)
+	}
+	if quote["lastPrice"] != 201.2 || quote["quoteTimeInLong"] != float64(1675866600000) {
+		t.Error("Quote not flattened to the TD shape ", quote)
+	}
+}
+
+func TestUnknownProvider(t *testing.T) {
+	if _, err := New(Config{Provider: "etrade"}, staticToken("abc")); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
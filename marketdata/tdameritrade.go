@@ -0,0 +1,84 @@
+package marketdata
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jaredtokuz/market-trader/token"
+)
+
+const TDA_BASE_URL = "https://api.tdameritrade.com/v1"
+
+type tdameritrade struct {
+	baseURL string
+	apikey  string
+	token   token.AccessTokenService
+}
+
+func NewTDAmeritrade(baseURL string, apikey string, token token.AccessTokenService) MarketDataProvider {
+	return &tdameritrade{baseURL: baseURL, apikey: apikey, token: token}
+}
+
+func (td *tdameritrade) Name() string {
+	return TDAmeritradeProvider
+}
+
+func (td *tdameritrade) Fundamentals(symbol string) (*http.Request, error) {
+	req, err := td.newRequest(td.baseURL + "/instruments")
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	query.Add("apikey", td.apikey)
+	query.Add("projection", "fundamental")
+	query.Add("symbol", symbol)
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+}
+
+func (td *tdameritrade) PriceHistory(symbol string, p PriceHistoryQuery) (*http.Request, error) {
+	req, err := td.newRequest(fmt.Sprintf(td.baseURL+"/marketdata/%v/pricehistory", symbol))
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	query.Add("apikey", td.apikey)
+	addPriceHistoryQuery(query, p)
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+}
+
+func (td *tdameritrade) Quotes(symbols []string) (*http.Request, error) {
+	req, err := td.newRequest(td.baseURL + "/marketdata/quotes")
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	query.Add("apikey", td.apikey)
+	query.Add("symbol", strings.Join(symbols, ","))
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+}
+
+// TD responses are already in the shape the etl package expects
+func (td *tdameritrade) Normalize(kind Kind, body map[string]interface{}) map[string]interface{} {
+	return body
+}
+
+func (td *tdameritrade) Unauthorized(req *http.Request) {
+	invalidate(td.token, req)
+}
+
+func (td *tdameritrade) newRequest(url string) (*http.Request, error) {
+	accessToken, err := td.token.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	return req, nil
+}
@@ -0,0 +1,85 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/* server error codes treated as already done */
+const (
+	namespaceNotFound = 26
+	indexNotFound     = 27
+	namespaceExists   = 48
+)
+
+func isCode(err error, code int) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && int(cmdErr.Code) == code
+}
+
+// Index is a named index, the name is what Down drops
+type Index struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	TTL    time.Duration /* expire documents this long after the single date key */
+}
+
+// CreateIndexes is a no op for indexes that already exist with the same keys and options
+func CreateIndexes(db *mongo.Database, collection string, indexes ...Index) error {
+	models := make([]mongo.IndexModel, len(indexes))
+	for i, index := range indexes {
+		opts := options.Index().SetName(index.Name)
+		if index.Unique {
+			opts.SetUnique(true)
+		}
+		if index.TTL > 0 {
+			opts.SetExpireAfterSeconds(int32(index.TTL.Seconds()))
+		}
+		models[i] = mongo.IndexModel{Keys: index.Keys, Options: opts}
+	}
+	_, err := db.Collection(collection).Indexes().CreateMany(context.TODO(), models)
+	return err
+}
+
+// DropIndexes ignores indexes or collections that are already gone
+func DropIndexes(db *mongo.Database, collection string, names ...string) error {
+	for _, name := range names {
+		_, err := db.Collection(collection).Indexes().DropOne(context.TODO(), name)
+		if err != nil && !isCode(err, indexNotFound) && !isCode(err, namespaceNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateCollection ignores a collection that already exists, whatever its options
+func CreateCollection(db *mongo.Database, collection string, opts ...*options.CreateCollectionOptions) error {
+	err := db.CreateCollection(context.TODO(), collection, opts...)
+	if isCode(err, namespaceExists) {
+		return nil
+	}
+	return err
+}
+
+// SetValidator replaces the collection's $jsonSchema validator, nil removes it.
+// Validation is moderate so documents written before it can still be updated.
+func SetValidator(db *mongo.Database, collection string, schema bson.M) error {
+	if err := CreateCollection(db, collection); err != nil {
+		return err
+	}
+	validator := bson.M{}
+	if schema != nil {
+		validator = bson.M{"$jsonSchema": schema}
+	}
+	return db.RunCommand(context.TODO(), bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+	}).Err()
+}
@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migrations is the collection recording applied versions
+const Migrations = "Migrations"
+
+// Migration is one versioned schema change. Up and Down must be safe to run
+// again, processes starting together may both apply the same version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(db *mongo.Database) error
+	Down        func(db *mongo.Database) error
+}
+
+type AppliedDocument struct {
+	Version     int       `json:"version" bson:"_id"`
+	Description string    `json:"description" bson:"description"`
+	AppliedAt   time.Time `json:"appliedAt" bson:"appliedAt"`
+}
+
+type Status struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"` /* nil while pending */
+}
+
+type Migrator interface {
+	Up(target int) ([]Migration, error)  /* applies pending versions up to target, all when 0 */
+	Down(steps int) ([]Migration, error) /* reverts the newest applied versions */
+	Status() ([]Status, error)
+}
+
+// Ledger records which versions were applied
+type Ledger interface {
+	Applied() (map[int]AppliedDocument, error)
+	Record(doc AppliedDocument) error
+	Remove(version int) error
+}
+
+type migrator struct {
+	db         *mongo.Database
+	ledger     Ledger
+	migrations []Migration
+}
+
+func NewMigrator(db *mongo.Database, migrations []Migration) (Migrator, error) {
+	return newMigrator(db, NewLedger(db), migrations)
+}
+
+func newMigrator(db *mongo.Database, ledger Ledger, migrations []Migration) (Migrator, error) {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || m.Up == nil || m.Down == nil {
+			return nil, fmt.Errorf("migration %d needs a positive version, Up and Down", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migration %d is defined twice", m.Version)
+		}
+	}
+	return &migrator{db: db, ledger: ledger, migrations: sorted}, nil
+}
+
+func (m *migrator) Up(target int) ([]Migration, error) {
+	applied, err := m.ledger.Applied()
+	if err != nil {
+		return nil, err
+	}
+	var ran []Migration
+	for _, migration := range m.migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := migration.Up(m.db); err != nil {
+			return ran, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Description, err)
+		}
+		err := m.ledger.Record(AppliedDocument{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now()})
+		if err != nil {
+			return ran, err
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+func (m *migrator) Down(steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, errors.New("steps must be positive")
+	}
+	applied, err := m.ledger.Applied()
+	if err != nil {
+		return nil, err
+	}
+	var ran []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(ran) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := migration.Down(m.db); err != nil {
+			return ran, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Description, err)
+		}
+		if err := m.ledger.Remove(migration.Version); err != nil {
+			return ran, err
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+func (m *migrator) Status() ([]Status, error) {
+	applied, err := m.ledger.Applied()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		status[i] = Status{Version: migration.Version, Description: migration.Description}
+		if doc, ok := applied[migration.Version]; ok {
+			at := doc.AppliedAt
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+type ledger struct {
+	migrations *mongo.Collection
+}
+
+func NewLedger(db *mongo.Database) Ledger {
+	return &ledger{migrations: db.Collection(Migrations)}
+}
+
+func (l *ledger) Applied() (map[int]AppliedDocument, error) {
+	cursor, err := l.migrations.Find(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var docs []AppliedDocument
+	if err := cursor.All(context.TODO(), &docs); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]AppliedDocument, len(docs))
+	for _, doc := range docs {
+		applied[doc.Version] = doc
+	}
+	return applied, nil
+}
+
+func (l *ledger) Record(doc AppliedDocument) error {
+	_, err := l.migrations.ReplaceOne(context.TODO(), bson.M{"_id": doc.Version}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (l *ledger) Remove(version int) error {
+	_, err := l.migrations.DeleteOne(context.TODO(), bson.M{"_id": version})
+	return err
+}
@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryLedger map[int]AppliedDocument
+
+func (l memoryLedger) Applied() (map[int]AppliedDocument, error) {
+	applied := make(map[int]AppliedDocument, len(l))
+	for version, doc := range l {
+		applied[version] = doc
+	}
+	return applied, nil
+}
+
+func (l memoryLedger) Record(doc AppliedDocument) error {
+	l[doc.Version] = doc
+	return nil
+}
+
+func (l memoryLedger) Remove(version int) error {
+	delete(l, version)
+	return nil
+}
+
+// recorder builds migrations that log which steps ran
+func recorder(log *[]string, fail map[string]bool, versions ...int) []Migration {
+	var migrations []Migration
+	for _, version := range versions {
+		up, down := fmt.Sprint("up", version), fmt.Sprint("down", version)
+		migrations = append(migrations, Migration{
+			Version:     version,
+			Description: up,
+			Up: func(db *mongo.Database) error {
+				if fail[up] {
+					return errors.New("boom")
+				}
+				*log = append(*log, up)
+				return nil
+			},
+			Down: func(db *mongo.Database) error {
+				*log = append(*log, down)
+				return nil
+			},
+		})
+	}
+	return migrations
+}
+
+func TestUpDown(t *testing.T) {
+	var ran []string
+	ledger := memoryLedger{}
+	// defined out of order, applied by version
+	m, err := newMigrator(nil, ledger, recorder(&ran, nil, 3, 1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if applied, err := m.Up(2); err != nil || len(applied) != 2 {
+		t.Fatal("Expected versions 1 and 2 ", applied, err)
+	}
+	if applied, err := m.Up(0); err != nil || len(applied) != 1 || applied[0].Version != 3 {
+		t.Fatal("Expected only version 3 pending ", applied, err)
+	}
+	if applied, _ := m.Up(0); len(applied) != 0 {
+		t.Error("Up should be a no op once everything is applied ", applied)
+	}
+	if !reflect.DeepEqual(ran, []string{"up1", "up2", "up3"}) {
+		t.Error("Unexpected up order ", ran)
+	}
+
+	ran = nil
+	if reverted, err := m.Down(2); err != nil || len(reverted) != 2 {
+		t.Fatal("Expected 2 reverted ", reverted, err)
+	}
+	if !reflect.DeepEqual(ran, []string{"down3", "down2"}) {
+		t.Error("Down should revert newest first ", ran)
+	}
+	status, _ := m.Status()
+	if len(status) != 3 || status[0].AppliedAt == nil || status[1].AppliedAt != nil || status[2].AppliedAt != nil {
+		t.Error("Expected only version 1 applied ", status)
+	}
+	if _, err := m.Down(0); err == nil {
+		t.Error("Down without steps should fail")
+	}
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	var ran []string
+	ledger := memoryLedger{}
+	m, _ := newMigrator(nil, ledger, recorder(&ran, map[string]bool{"up2": true}, 1, 2, 3))
+
+	applied, err := m.Up(0)
+	if err == nil || len(applied) != 1 {
+		t.Fatal("Expected the failure after version 1 ", applied, err)
+	}
+	if _, ok := ledger[2]; ok {
+		t.Error("Failed migration should not be recorded")
+	}
+	if _, ok := ledger[3]; ok {
+		t.Error("Migrations after a failure should not run")
+	}
+}
+
+func TestNewMigratorValidates(t *testing.T) {
+	var ran []string
+	if _, err := newMigrator(nil, memoryLedger{}, recorder(&ran, nil, 1, 1)); err == nil {
+		t.Error("Duplicate versions should be rejected")
+	}
+	if _, err := newMigrator(nil, memoryLedger{}, []Migration{{Version: 1}}); err == nil {
+		t.Error("Migrations without Up and Down should be rejected")
+	}
+}
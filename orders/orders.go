@@ -0,0 +1,133 @@
+// Package orders describes orders and when they fill against a bar. The
+// backtester and paper trader share it so both simulate fills the same way.
+package orders
+
+import (
+	"errors"
+
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+type Side string
+
+const (
+	Buy  Side = "buy"
+	Sell Side = "sell"
+)
+
+type Type string
+
+const (
+	Market    Type = "market"
+	Limit     Type = "limit"
+	Stop      Type = "stop"
+	StopLimit Type = "stop_limit"
+)
+
+type Order struct {
+	ID         string  `json:"id" bson:"id"`
+	Symbol     string  `json:"symbol" bson:"symbol"`
+	Side       Side    `json:"side" bson:"side"`
+	Type       Type    `json:"type" bson:"type"`
+	Quantity   int     `json:"quantity" bson:"quantity"`
+	LimitPrice float64 `json:"limitPrice,omitempty" bson:"limitPrice,omitempty"`
+	StopPrice  float64 `json:"stopPrice,omitempty" bson:"stopPrice,omitempty"`
+	Triggered  bool    `json:"triggered,omitempty" bson:"triggered,omitempty"` /* stop limit has reached its stop */
+}
+
+func (o Order) Validate() error {
+	if o.Side != Buy && o.Side != Sell {
+		return errors.New("order side must be buy or sell")
+	}
+	if o.Quantity <= 0 {
+		return errors.New("order quantity must be positive")
+	}
+	switch o.Type {
+	case Market:
+	case Limit:
+		if o.LimitPrice <= 0 {
+			return errors.New("limit order needs a limit price")
+		}
+	case Stop:
+		if o.StopPrice <= 0 {
+			return errors.New("stop order needs a stop price")
+		}
+	case StopLimit:
+		if o.LimitPrice <= 0 || o.StopPrice <= 0 {
+			return errors.New("stop limit order needs a stop and limit price")
+		}
+	default:
+		return errors.New("unknown order type: " + string(o.Type))
+	}
+	return nil
+}
+
+// Match returns the price the order fills at during bar c. Gaps through a
+// price fill at the open, otherwise at the order's price. A stop limit that
+// reaches its stop is marked Triggered and rests as a limit order after.
+func Match(o *Order, c shared.Candle) (float64, bool) {
+	switch o.Type {
+	case Market:
+		return c.Open, true
+	case Limit:
+		return matchLimit(o.Side, o.LimitPrice, c)
+	case Stop:
+		return matchStop(o.Side, o.StopPrice, c)
+	case StopLimit:
+		if o.Triggered {
+			return matchLimit(o.Side, o.LimitPrice, c)
+		}
+		stopPrice, ok := matchStop(o.Side, o.StopPrice, c)
+		if !ok {
+			return 0, false
+		}
+		o.Triggered = true
+		// the rest of the bar after the stop traded, starting at the stop price
+		rest := shared.Candle{Open: stopPrice, High: c.High, Low: c.Low, Close: c.Close}
+		return matchLimit(o.Side, o.LimitPrice, rest)
+	}
+	return 0, false
+}
+
+// MatchPrice matches against a single traded price such as a quote
+func MatchPrice(o *Order, price float64) (float64, bool) {
+	return Match(o, shared.Candle{Open: price, High: price, Low: price, Close: price})
+}
+
+func matchLimit(side Side, limit float64, c shared.Candle) (float64, bool) {
+	if side == Buy {
+		if c.Open <= limit {
+			return c.Open, true
+		}
+		if c.Low <= limit {
+			return limit, true
+		}
+		return 0, false
+	}
+	if c.Open >= limit {
+		return c.Open, true
+	}
+	if c.High >= limit {
+		return limit, true
+	}
+	return 0, false
+}
+
+func matchStop(side Side, stop float64, c shared.Candle) (float64, bool) {
+	if side == Buy {
+		if c.Open >= stop {
+			return c.Open, true
+		}
+		if c.High >= stop {
+			return stop, true
+		}
+		return 0, false
+	}
+	if c.Open <= stop {
+		return c.Open, true
+	}
+	if c.Low <= stop {
+		return stop, true
+	}
+	return 0, false
+}
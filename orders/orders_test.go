@@ -0,0 +1,104 @@
+package orders
+
+import (
+	"testing"
+
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+func TestMatch(t *testing.T) {
+	bar := shared.Candle{Open: 100, High: 105, Low: 95, Close: 102}
+	gapUp := shared.Candle{Open: 110, High: 112, Low: 108, Close: 111}
+
+	cases := []struct {
+		name  string
+		order Order
+		bar   shared.Candle
+		price float64
+		ok    bool
+	}{
+		{"market", Order{Side: Buy, Type: Market}, bar, 100, true},
+		{"buy limit touched", Order{Side: Buy, Type: Limit, LimitPrice: 97}, bar, 97, true},
+		{"buy limit above open", Order{Side: Buy, Type: Limit, LimitPrice: 101}, bar, 100, true},
+		{"buy limit missed", Order{Side: Buy, Type: Limit, LimitPrice: 94}, bar, 0, false},
+		{"sell limit touched", Order{Side: Sell, Type: Limit, LimitPrice: 104}, bar, 104, true},
+		{"sell limit missed", Order{Side: Sell, Type: Limit, LimitPrice: 106}, bar, 0, false},
+		{"buy stop touched", Order{Side: Buy, Type: Stop, StopPrice: 104}, bar, 104, true},
+		{"buy stop gapped", Order{Side: Buy, Type: Stop, StopPrice: 106}, gapUp, 110, true},
+		{"sell stop touched", Order{Side: Sell, Type: Stop, StopPrice: 96}, bar, 96, true},
+		{"sell stop missed", Order{Side: Sell, Type: Stop, StopPrice: 94}, bar, 0, false},
+		{"buy stop limit", Order{Side: Buy, Type: StopLimit, StopPrice: 103, LimitPrice: 104}, bar, 103, true},
+		{"buy stop limit gapped past limit", Order{Side: Buy, Type: StopLimit, StopPrice: 106, LimitPrice: 107}, gapUp, 0, false},
+	}
+	for _, c := range cases {
+		order := c.order
+		price, ok := Match(&order, c.bar)
+		if price != c.price || ok != c.ok {
+			t.Errorf("%v: got %v %v, expected %v %v", c.name, price, ok, c.price, c.ok)
+		}
+	}
+}
+
+func TestStopLimitRestsAfterTrigger(t *testing.T) {
+	order := Order{Side: Buy, Type: StopLimit, StopPrice: 106, LimitPrice: 107}
+	if _, ok := Match(&order, shared.Candle{Open: 110, High: 112, Low: 108, Close: 111}); ok {
+		t.Fatal("Should not fill above the limit")
+	}
+	if !order.Triggered {
+		t.Fatal("Stop should be triggered")
+	}
+	// stop is no longer needed, fills once price comes back to the limit
+	price, ok := MatchPrice(&order, 106.5)
+	if !ok || price != 106.5 {
+		t.Error("Triggered stop limit should fill as a limit ", price, ok)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []Order{
+		{Side: "hold", Type: Market, Quantity: 1},
+		{Side: Buy, Type: Market},
+		{Side: Buy, Type: Limit, Quantity: 1},
+		{Side: Buy, Type: StopLimit, Quantity: 1, StopPrice: 10},
+		{Side: Buy, Type: "trailing", Quantity: 1},
+	}
+	for _, o := range invalid {
+		if o.Validate() == nil {
+			t.Error("Expected invalid order ", o)
+		}
+	}
+	if err := (Order{Side: Sell, Type: Stop, Quantity: 5, StopPrice: 10}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	var p Position
+	p.Apply(Buy, 10, 100)
+	p.Apply(Buy, 10, 110)
+	if p.Quantity != 20 || p.AvgPrice != 105 {
+		t.Fatal("Expected 20 @ 105 got ", p.Quantity, p.AvgPrice)
+	}
+	if u := p.Unrealized(100); u != -100 {
+		t.Error("Expected unrealized -100 got ", u)
+	}
+
+	realized, closed := p.Apply(Sell, 5, 115)
+	if realized != 50 || closed != 5 || p.AvgPrice != 105 {
+		t.Error("Partial close got ", realized, closed, p.AvgPrice)
+	}
+
+	// sell through the position into a short
+	realized, closed = p.Apply(Sell, 20, 100)
+	if realized != -75 || closed != 15 {
+		t.Error("Flip got ", realized, closed)
+	}
+	if p.Quantity != -5 || p.AvgPrice != 100 || p.Realized != -25 {
+		t.Error("Expected short 5 @ 100 realized -25 got ", p.Quantity, p.AvgPrice, p.Realized)
+	}
+
+	realized, _ = p.Apply(Buy, 5, 90)
+	if realized != 50 || p.Quantity != 0 || p.AvgPrice != 0 {
+		t.Error("Short cover got ", realized, p.Quantity, p.AvgPrice)
+	}
+}
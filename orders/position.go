@@ -0,0 +1,60 @@
+package orders
+
+// Position is a signed share count with its average cost. Short positions
+// have a negative Quantity.
+type Position struct {
+	Symbol   string  `json:"symbol" bson:"symbol"`
+	Quantity int     `json:"quantity" bson:"quantity"`
+	AvgPrice float64 `json:"avgPrice" bson:"avgPrice"`
+	Realized float64 `json:"realized" bson:"realized"` /* closed P&L before commissions */
+}
+
+// Apply books a fill and returns the P&L realized by it and how many
+// shares it closed. A fill larger than the position flips it.
+func (p *Position) Apply(side Side, quantity int, price float64) (realized float64, closed int) {
+	signed := quantity
+	if side == Sell {
+		signed = -quantity
+	}
+
+	if p.Quantity == 0 || (p.Quantity > 0) == (signed > 0) {
+		total := abs(p.Quantity) + quantity
+		p.AvgPrice = (p.AvgPrice*float64(abs(p.Quantity)) + price*float64(quantity)) / float64(total)
+		p.Quantity += signed
+		return 0, 0
+	}
+
+	closed = quantity
+	if abs(p.Quantity) < closed {
+		closed = abs(p.Quantity)
+	}
+	direction := 1.0
+	if p.Quantity < 0 {
+		direction = -1
+	}
+	realized = (price - p.AvgPrice) * float64(closed) * direction
+	p.Realized += realized
+	p.Quantity += signed
+	switch {
+	case p.Quantity == 0:
+		p.AvgPrice = 0
+	case closed < quantity:
+		p.AvgPrice = price
+	}
+	return realized, closed
+}
+
+func (p Position) MarketValue(price float64) float64 {
+	return float64(p.Quantity) * price
+}
+
+func (p Position) Unrealized(price float64) float64 {
+	return (price - p.AvgPrice) * float64(p.Quantity)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,106 @@
+// Package paper keeps simulated accounts, positions and open orders in Mongo
+// and fills the orders against Signals candles or quotes as they arrive.
+package paper
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/jaredtokuz/market-trader/orders"
+)
+
+const (
+	Accounts  = "PaperAccounts"
+	Positions = "PaperPositions"
+	Orders    = "PaperOrders"
+)
+
+type OrderStatus string
+
+const (
+	Open      OrderStatus = "open"
+	Filled    OrderStatus = "filled"
+	Cancelled OrderStatus = "cancelled"
+)
+
+type Account struct {
+	Name      string    `json:"name" bson:"_id"`
+	Cash      float64   `json:"cash" bson:"cash"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+type OrderDocument struct {
+	ID           *primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Account      string              `json:"account" bson:"account"`
+	orders.Order `bson:",inline"`
+	Status       OrderStatus `json:"status" bson:"status"`
+	SubmittedAt  time.Time   `json:"submittedAt" bson:"submittedAt"`
+	FilledAt     *time.Time  `json:"filledAt,omitempty" bson:"filledAt,omitempty"`
+	FillPrice    float64     `json:"fillPrice,omitempty" bson:"fillPrice,omitempty"`
+	Commission   float64     `json:"commission,omitempty" bson:"commission,omitempty"`
+}
+
+type PositionDocument struct {
+	Account         string `json:"account" bson:"account"`
+	orders.Position `bson:",inline"`
+	Commissions     float64   `json:"commissions" bson:"commissions"`
+	LastPrice       float64   `json:"lastPrice" bson:"lastPrice"`
+	Unrealized      float64   `json:"unrealized" bson:"unrealized"`
+	UpdatedAt       time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Costs are charged on every simulated fill
+type Costs struct {
+	Commission    float64 /* per share */
+	MinCommission float64 /* per order */
+	SlippageBps   float64 /* basis points against the trader */
+}
+
+func (c Costs) fill(side orders.Side, quantity int, price float64) (fillPrice float64, commission float64) {
+	slip := price * c.SlippageBps / 10000
+	if side == orders.Buy {
+		fillPrice = price + slip
+	} else {
+		fillPrice = price - slip
+	}
+	commission = math.Max(c.Commission*float64(quantity), c.MinCommission)
+	return fillPrice, commission
+}
+
+// cashDelta is the change to account cash for a fill
+func cashDelta(side orders.Side, quantity int, price float64, commission float64) float64 {
+	value := price * float64(quantity)
+	if side == orders.Buy {
+		return -value - commission
+	}
+	return value - commission
+}
+
+// mark reprices a position at the latest traded price
+func (p *PositionDocument) mark(price float64, at time.Time) {
+	p.LastPrice = price
+	p.Unrealized = p.Position.Unrealized(price)
+	p.UpdatedAt = at
+}
+
+type Summary struct {
+	Cash        float64 `json:"cash"`
+	MarketValue float64 `json:"marketValue"`
+	Equity      float64 `json:"equity"`
+	Realized    float64 `json:"realized"` /* net of commissions */
+	Unrealized  float64 `json:"unrealized"`
+}
+
+func Summarize(account Account, positions []PositionDocument) Summary {
+	s := Summary{Cash: account.Cash}
+	for _, p := range positions {
+		s.MarketValue += p.MarketValue(p.LastPrice)
+		s.Realized += p.Realized - p.Commissions
+		s.Unrealized += p.Unrealized
+	}
+	s.Equity = s.Cash + s.MarketValue
+	return s
+}
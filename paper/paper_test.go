@@ -0,0 +1,53 @@
+package paper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/orders"
+)
+
+func TestCosts(t *testing.T) {
+	costs := Costs{Commission: 0.01, MinCommission: 1, SlippageBps: 10}
+
+	price, commission := costs.fill(orders.Buy, 50, 100)
+	if price != 100.1 || commission != 1 {
+		t.Error("Expected 100.1 and min commission got ", price, commission)
+	}
+	price, commission = costs.fill(orders.Sell, 500, 100)
+	if price != 99.9 || commission != 5 {
+		t.Error("Expected 99.9 and 5 commission got ", price, commission)
+	}
+
+	if d := cashDelta(orders.Buy, 10, 100, 1); d != -1001 {
+		t.Error("Expected buy to cost 1001 got ", d)
+	}
+	if d := cashDelta(orders.Sell, 10, 100, 1); d != 999 {
+		t.Error("Expected sell to return 999 got ", d)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	long := PositionDocument{Position: orders.Position{Symbol: "AAPL"}}
+	long.Apply(orders.Buy, 10, 100)
+	long.Commissions = 1
+	long.mark(110, time.Now())
+
+	short := PositionDocument{Position: orders.Position{Symbol: "TSLA"}}
+	short.Apply(orders.Sell, 10, 200)
+	short.Apply(orders.Buy, 5, 180)
+	short.Commissions = 2
+	short.mark(190, time.Now())
+
+	if long.Unrealized != 100 || short.Unrealized != 50 {
+		t.Fatal("Unexpected unrealized ", long.Unrealized, short.Unrealized)
+	}
+
+	s := Summarize(Account{Cash: 10000}, []PositionDocument{long, short})
+	if s.MarketValue != 1100-950 {
+		t.Error("Unexpected market value ", s.MarketValue)
+	}
+	if s.Equity != 10150 || s.Realized != 100-3 || s.Unrealized != 150 {
+		t.Error("Unexpected summary ", s)
+	}
+}
@@ -0,0 +1,264 @@
+package paper
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/jaredtokuz/market-trader/orders"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+var ErrOrderNotOpen = errors.New("order is not open")
+
+type Portfolio interface {
+	OpenAccount(name string, cash float64) (Account, error) /* no-op when the account exists */
+	Account(name string) (Account, error)
+	Submit(account string, order orders.Order) (OrderDocument, error)
+	Cancel(account string, id primitive.ObjectID) error
+	Orders(account string, status OrderStatus) ([]OrderDocument, error)
+	Positions(account string) ([]PositionDocument, error)
+	Symbols() ([]string, error) /* symbols with open orders or positions */
+	OnCandle(symbol string, candle shared.Candle) ([]OrderDocument, error)
+	OnQuote(symbol string, price float64, at time.Time) ([]OrderDocument, error)
+}
+
+type portfolio struct {
+	accounts  *mongo.Collection
+	positions *mongo.Collection
+	orders    *mongo.Collection
+	costs     Costs
+}
+
+// NewPortfolio fills are not transactional, run one process per database
+func NewPortfolio(mg *mongo.Database, costs Costs) Portfolio {
+	return &portfolio{
+		accounts:  mg.Collection(Accounts),
+		positions: mg.Collection(Positions),
+		orders:    mg.Collection(Orders),
+		costs:     costs,
+	}
+}
+
+func (p *portfolio) OpenAccount(name string, cash float64) (Account, error) {
+	now := time.Now()
+	_, err := p.accounts.UpdateOne(context.TODO(),
+		bson.M{"_id": name},
+		bson.M{"$setOnInsert": Account{Name: name, Cash: cash, CreatedAt: now, UpdatedAt: now}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return Account{}, err
+	}
+	return p.Account(name)
+}
+
+func (p *portfolio) Account(name string) (Account, error) {
+	var account Account
+	err := p.accounts.FindOne(context.TODO(), bson.M{"_id": name}).Decode(&account)
+	return account, err
+}
+
+func (p *portfolio) Submit(account string, order orders.Order) (OrderDocument, error) {
+	if err := order.Validate(); err != nil {
+		return OrderDocument{}, err
+	}
+	if order.Symbol == "" {
+		return OrderDocument{}, errors.New("order needs a symbol")
+	}
+	if _, err := p.Account(account); err != nil {
+		return OrderDocument{}, err
+	}
+	id := primitive.NewObjectID()
+	order.ID = id.Hex()
+	doc := OrderDocument{ID: &id, Account: account, Order: order, Status: Open, SubmittedAt: time.Now()}
+	if _, err := p.orders.InsertOne(context.TODO(), doc); err != nil {
+		return OrderDocument{}, err
+	}
+	return doc, nil
+}
+
+func (p *portfolio) Cancel(account string, id primitive.ObjectID) error {
+	result, err := p.orders.UpdateOne(context.TODO(),
+		bson.M{"_id": id, "account": account, "status": Open},
+		bson.M{"$set": bson.M{"status": Cancelled}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOrderNotOpen
+	}
+	return nil
+}
+
+func (p *portfolio) Orders(account string, status OrderStatus) ([]OrderDocument, error) {
+	filter := bson.M{"account": account}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := p.orders.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"submittedAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []OrderDocument
+	err = cursor.All(context.TODO(), &docs)
+	return docs, err
+}
+
+func (p *portfolio) Positions(account string) ([]PositionDocument, error) {
+	cursor, err := p.positions.Find(context.TODO(), bson.M{"account": account}, options.Find().SetSort(bson.M{"symbol": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []PositionDocument
+	err = cursor.All(context.TODO(), &docs)
+	return docs, err
+}
+
+func (p *portfolio) Symbols() ([]string, error) {
+	seen := map[string]bool{}
+	var symbols []string
+	for _, q := range []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{
+		{p.orders, bson.M{"status": Open}},
+		{p.positions, bson.M{"quantity": bson.M{"$ne": 0}}},
+	} {
+		values, err := q.collection.Distinct(context.TODO(), "symbol", q.filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			if s, ok := v.(string); ok && !seen[s] {
+				seen[s] = true
+				symbols = append(symbols, s)
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// OnCandle matches open orders submitted before the bar began, then marks
+// positions at its close
+func (p *portfolio) OnCandle(symbol string, candle shared.Candle) ([]OrderDocument, error) {
+	start := time.UnixMilli(int64(candle.Datetime))
+	filled, err := p.match(symbol, start, func(o *orders.Order) (float64, bool) {
+		return orders.Match(o, candle)
+	})
+	if err != nil {
+		return filled, err
+	}
+	return filled, p.mark(symbol, candle.Close, start)
+}
+
+func (p *portfolio) OnQuote(symbol string, price float64, at time.Time) ([]OrderDocument, error) {
+	filled, err := p.match(symbol, at, func(o *orders.Order) (float64, bool) {
+		return orders.MatchPrice(o, price)
+	})
+	if err != nil {
+		return filled, err
+	}
+	return filled, p.mark(symbol, price, at)
+}
+
+func (p *portfolio) match(symbol string, at time.Time, match func(*orders.Order) (float64, bool)) ([]OrderDocument, error) {
+	cursor, err := p.orders.Find(context.TODO(),
+		bson.M{"symbol": symbol, "status": Open, "submittedAt": bson.M{"$lte": at}},
+		options.Find().SetSort(bson.M{"submittedAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var open []OrderDocument
+	if err := cursor.All(context.TODO(), &open); err != nil {
+		return nil, err
+	}
+
+	var filled []OrderDocument
+	for _, doc := range open {
+		wasTriggered := doc.Triggered
+		price, ok := match(&doc.Order)
+		if !ok {
+			if doc.Triggered != wasTriggered {
+				_, err := p.orders.UpdateOne(context.TODO(), bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"triggered": true}})
+				if err != nil {
+					return filled, err
+				}
+			}
+			continue
+		}
+		if err := p.fill(&doc, price, at); err != nil {
+			if errors.Is(err, ErrOrderNotOpen) {
+				continue
+			}
+			return filled, err
+		}
+		filled = append(filled, doc)
+	}
+	return filled, nil
+}
+
+func (p *portfolio) fill(doc *OrderDocument, price float64, at time.Time) error {
+	price, commission := p.costs.fill(doc.Side, doc.Quantity, price)
+	doc.Status = Filled
+	doc.FilledAt = &at
+	doc.FillPrice = price
+	doc.Commission = commission
+
+	// claim the order first so a concurrent cancel or fill cannot double book
+	result, err := p.orders.UpdateOne(context.TODO(),
+		bson.M{"_id": doc.ID, "status": Open},
+		bson.M{"$set": bson.M{"status": Filled, "filledAt": at, "fillPrice": price, "commission": commission, "triggered": doc.Triggered}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOrderNotOpen
+	}
+
+	_, err = p.accounts.UpdateOne(context.TODO(),
+		bson.M{"_id": doc.Account},
+		bson.M{"$inc": bson.M{"cash": cashDelta(doc.Side, doc.Quantity, price, commission)}, "$set": bson.M{"updatedAt": at}})
+	if err != nil {
+		return err
+	}
+
+	position := PositionDocument{Account: doc.Account, Position: orders.Position{Symbol: doc.Symbol}}
+	err = p.positions.FindOne(context.TODO(), bson.M{"account": doc.Account, "symbol": doc.Symbol}).Decode(&position)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	position.Apply(doc.Side, doc.Quantity, price)
+	position.Commissions += commission
+	position.mark(price, at)
+	_, err = p.positions.ReplaceOne(context.TODO(),
+		bson.M{"account": doc.Account, "symbol": doc.Symbol},
+		position,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+func (p *portfolio) mark(symbol string, price float64, at time.Time) error {
+	cursor, err := p.positions.Find(context.TODO(), bson.M{"symbol": symbol})
+	if err != nil {
+		return err
+	}
+	var positions []PositionDocument
+	if err := cursor.All(context.TODO(), &positions); err != nil {
+		return err
+	}
+	for _, position := range positions {
+		position.mark(price, at)
+		_, err := p.positions.UpdateOne(context.TODO(),
+			bson.M{"account": position.Account, "symbol": symbol},
+			bson.M{"$set": bson.M{"lastPrice": position.LastPrice, "unrealized": position.Unrealized, "updatedAt": at}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Package resample builds longer bars from stored candles. Intraday buckets are
+// anchored to the start of each market phase, so an hourly bar runs 9:30 to
+// 10:30, never mixes pre market with regular trading, and the last bar before a
+// close (or an early close) is short rather than spilling into the next phase.
+package resample
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+type Options struct {
+	Extended bool /* include pre and post market bars, regular hours only by default */
+}
+
+var intraday = map[etl.Timeframe]time.Duration{
+	etl.Minute15: 15 * time.Minute,
+	etl.Minute30: 30 * time.Minute,
+	etl.Hour1:    time.Hour,
+	etl.Hour4:    4 * time.Hour,
+}
+
+// Duration is the length of an intraday timeframe, zero for daily and weekly
+func Duration(tf etl.Timeframe) time.Duration {
+	return intraday[tf]
+}
+
+func Valid(tf etl.Timeframe) bool {
+	return Duration(tf) > 0 || tf == etl.Daily || tf == etl.Weekly
+}
+
+// CanResample reports whether bars of from can be combined into bars of to
+func CanResample(from etl.Timeframe, to etl.Timeframe) bool {
+	switch {
+	case Duration(from) > 0 && Duration(to) > 0:
+		return Duration(to)%Duration(from) == 0
+	case Duration(from) > 0:
+		return to == etl.Daily || to == etl.Weekly
+	case from == etl.Daily:
+		return to == etl.Daily || to == etl.Weekly
+	case from == etl.Weekly:
+		return to == etl.Weekly
+	}
+	return false
+}
+
+// Resample combines candles of timeframe from into timeframe to. Each output bar
+// is stamped with the start of its bucket, daily and weekly bars at midnight New
+// York of the session date and of the week's Monday. Intraday bars outside the
+// phases asked for are dropped, as are bars on days the market was closed.
+func Resample(candles []shared.Candle, from etl.Timeframe, to etl.Timeframe, opts Options) ([]shared.Candle, error) {
+	if !CanResample(from, to) {
+		return nil, fmt.Errorf("can't resample %v candles to %v", from, to)
+	}
+	sorted := make([]shared.Candle, len(candles))
+	copy(sorted, candles)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Datetime < sorted[j].Datetime })
+
+	var bars []shared.Candle
+	for _, c := range sorted {
+		t := time.UnixMilli(int64(c.Datetime)).In(calendar.NewYork)
+		start, ok := bucket(t, from, to, opts)
+		if !ok {
+			continue
+		}
+		stamp := uint64(start.UnixMilli())
+		if n := len(bars); n > 0 && bars[n-1].Datetime == stamp {
+			last := &bars[n-1]
+			last.High = math.Max(last.High, c.High)
+			last.Low = math.Min(last.Low, c.Low)
+			last.Close = c.Close
+			last.Volume += c.Volume
+			continue
+		}
+		c.Datetime = stamp
+		bars = append(bars, c)
+	}
+	return bars, nil
+}
+
+// bucket is the start of the to bar that the from bar starting at t falls in
+func bucket(t time.Time, from etl.Timeframe, to etl.Timeframe, opts Options) (time.Time, bool) {
+	if Duration(from) == 0 {
+		/* daily and weekly bars are stamped at midnight, there's no phase to check */
+		if to == etl.Weekly {
+			return weekOf(t), true
+		}
+		return calendar.Date(t), true
+	}
+
+	s, ok := calendar.SessionOn(t)
+	if !ok {
+		return time.Time{}, false
+	}
+	var anchor time.Time
+	switch s.Phase(t) {
+	case calendar.Regular:
+		anchor = s.Open
+	case calendar.Pre:
+		anchor = s.PreOpen
+	case calendar.Post:
+		anchor = s.Close
+	default:
+		return time.Time{}, false
+	}
+	if !opts.Extended && anchor != s.Open {
+		return time.Time{}, false
+	}
+
+	switch to {
+	case etl.Daily:
+		return s.Date, true
+	case etl.Weekly:
+		return weekOf(s.Date), true
+	}
+	d := Duration(to)
+	return anchor.Add(t.Sub(anchor) / d * d), true
+}
+
+// weekOf is midnight New York on the Monday of t's week
+func weekOf(t time.Time) time.Time {
+	d := calendar.Date(t)
+	offset := (int(d.Weekday()) + 6) % 7
+	return d.AddDate(0, 0, -offset)
+}
+
+/* stored timeframes to try for each one asked for, coarsest first */
+var sources = map[etl.Timeframe][]etl.Timeframe{
+	etl.Minute15: {etl.Minute15},
+	etl.Minute30: {etl.Minute30, etl.Minute15},
+	etl.Hour1:    {etl.Minute30, etl.Minute15},
+	etl.Hour4:    {etl.Minute30, etl.Minute15},
+	etl.Daily:    {etl.Daily, etl.Minute30, etl.Minute15},
+	etl.Weekly:   {etl.Daily, etl.Minute30, etl.Minute15},
+}
+
+// Query returns the symbol's bars at any timeframe whose start is in [from, to).
+// It reads the coarsest stored timeframe that has bars in the range and divides
+// into tf, so 1h comes from Medium's 30m bars and falls back to Short's 15m.
+func Query(store etl.CandleStore, symbol string, tf etl.Timeframe, from time.Time, to time.Time, opts Options) ([]shared.Candle, error) {
+	if !Valid(tf) {
+		return nil, fmt.Errorf("unknown timeframe %v", tf)
+	}
+	/* the last bucket starting before to may end after it */
+	end := to.Add(Duration(tf))
+	switch tf {
+	case etl.Daily:
+		end = to.AddDate(0, 0, 1)
+	case etl.Weekly:
+		end = to.AddDate(0, 0, 7)
+	}
+	for _, source := range sources[tf] {
+		candles, err := store.Range(symbol, source, from, end)
+		if err != nil {
+			return nil, err
+		}
+		if len(candles) == 0 {
+			continue
+		}
+		bars, err := Resample(candles, source, tf, opts)
+		if err != nil {
+			return nil, err
+		}
+		i := sort.Search(len(bars), func(i int) bool { return bars[i].Datetime >= uint64(from.UnixMilli()) })
+		j := sort.Search(len(bars), func(j int) bool { return bars[j].Datetime >= uint64(to.UnixMilli()) })
+		return bars[i:j], nil
+	}
+	return []shared.Candle{}, nil
+}
@@ -0,0 +1,214 @@
+package resample
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/shared"
+)
+
+func at(year int, month time.Month, day int, hour int, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, calendar.NewYork)
+}
+
+// bars returns every 15m bar from start up to end, each with volume 1 and a
+// close one higher than the last
+func bars(start time.Time, end time.Time) []shared.Candle {
+	var candles []shared.Candle
+	for t, i := start, 0; t.Before(end); t, i = t.Add(15*time.Minute), i+1 {
+		price := float64(100 + i)
+		candles = append(candles, shared.Candle{
+			Datetime: uint64(t.UnixMilli()), Open: price - 0.5, High: price + 1, Low: price - 1, Close: price, Volume: 1,
+		})
+	}
+	return candles
+}
+
+func stamps(candles []shared.Candle) []string {
+	s := make([]string, len(candles))
+	for i, c := range candles {
+		s[i] = time.UnixMilli(int64(c.Datetime)).In(calendar.NewYork).Format("01-02 15:04")
+	}
+	return s
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHourly(t *testing.T) {
+	day := bars(at(2023, 2, 8, 4, 0), at(2023, 2, 8, 20, 0)) /* a whole extended session */
+
+	regular, err := Resample(day, etl.Minute15, etl.Hour1, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"02-08 09:30", "02-08 10:30", "02-08 11:30", "02-08 12:30", "02-08 13:30", "02-08 14:30", "02-08 15:30"}
+	if !equal(stamps(regular), expected) {
+		t.Error("Expected hourly bars anchored at the open ", stamps(regular))
+	}
+	first := regular[0]
+	if first.Volume != 4 || first.Open != day[22].Open || first.Close != day[25].Close || first.High != day[25].High || first.Low != day[22].Low {
+		t.Error("9:30 bar should combine 9:30 to 10:15 ", first)
+	}
+	if regular[6].Volume != 2 {
+		t.Error("15:30 bar should stop at the close ", regular[6])
+	}
+
+	extended, err := Resample(day, etl.Minute15, etl.Hour1, Options{Extended: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extended) != 6+7+4 {
+		t.Error("Expected 6 pre, 7 regular and 4 post market bars ", stamps(extended))
+	}
+	if s := stamps(extended); s[5] != "02-08 09:00" || s[6] != "02-08 09:30" || s[13] != "02-08 16:00" {
+		t.Error("Phases should not share a bar ", s)
+	}
+	if extended[5].Volume != 2 {
+		t.Error("9:00 pre market bar should stop at the open ", extended[5])
+	}
+
+	four, _ := Resample(day, etl.Minute15, etl.Hour4, Options{})
+	if !equal(stamps(four), []string{"02-08 09:30", "02-08 13:30"}) || four[0].Volume != 16 || four[1].Volume != 10 {
+		t.Error("Unexpected 4h bars ", stamps(four), four)
+	}
+}
+
+func TestEarlyClose(t *testing.T) {
+	/* the day after thanksgiving closes at 13:00 */
+	day := bars(at(2023, 11, 24, 9, 30), at(2023, 11, 24, 16, 0))
+	hourly, _ := Resample(day, etl.Minute15, etl.Hour1, Options{})
+	if len(hourly) != 4 || hourly[3].Volume != 2 {
+		t.Error("Expected a short 12:30 bar and nothing after the early close ", stamps(hourly))
+	}
+	daily, _ := Resample(day, etl.Minute15, etl.Daily, Options{})
+	if len(daily) != 1 || daily[0].Volume != 14 {
+		t.Error("Expected one daily bar of the shortened session ", daily)
+	}
+}
+
+func TestDailyAndWeekly(t *testing.T) {
+	var candles []shared.Candle
+	for d := at(2023, 2, 6, 0, 0); d.Before(at(2023, 2, 25, 0, 0)); d = d.AddDate(0, 0, 1) {
+		candles = append(candles, bars(d.Add(9*time.Hour+30*time.Minute), d.Add(16*time.Hour))...)
+	}
+	candles = append(candles, bars(at(2023, 2, 8, 7, 0), at(2023, 2, 8, 8, 0))...) /* pre market */
+
+	daily, err := Resample(candles, etl.Minute15, etl.Daily, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* weekends and presidents day are dropped */
+	if len(daily) != 14 {
+		t.Error("Expected 14 sessions ", stamps(daily))
+	}
+	if daily[2].Volume != 26 {
+		t.Error("Pre market should be excluded from the regular daily bar ", daily[2])
+	}
+	withPre, _ := Resample(candles, etl.Minute15, etl.Daily, Options{Extended: true})
+	if withPre[2].Volume != 30 {
+		t.Error("Pre market should be included in the extended daily bar ", withPre[2])
+	}
+
+	weekly, _ := Resample(daily, etl.Daily, etl.Weekly, Options{})
+	if !equal(stamps(weekly), []string{"02-06 00:00", "02-13 00:00", "02-20 00:00"}) {
+		t.Error("Expected weeks stamped on Monday ", stamps(weekly))
+	}
+	if weekly[2].Volume != 4*26 || weekly[2].Open != daily[10].Open || weekly[2].Close != daily[13].Close {
+		t.Error("Holiday week should combine its 4 sessions ", weekly[2])
+	}
+	direct, _ := Resample(candles, etl.Minute15, etl.Weekly, Options{})
+	if !equal(stamps(direct), stamps(weekly)) || direct[1] != weekly[1] {
+		t.Error("Weekly from 15m should match weekly from daily ", direct, weekly)
+	}
+}
+
+func TestCanResample(t *testing.T) {
+	for _, c := range []struct {
+		from, to etl.Timeframe
+		ok       bool
+	}{
+		{etl.Minute15, etl.Hour1, true},
+		{etl.Minute30, etl.Hour4, true},
+		{etl.Minute30, etl.Minute15, false},
+		{etl.Minute15, etl.Weekly, true},
+		{etl.Daily, etl.Weekly, true},
+		{etl.Daily, etl.Hour1, false},
+		{etl.Weekly, etl.Daily, false},
+	} {
+		if CanResample(c.from, c.to) != c.ok {
+			t.Error("CanResample ", c.from, c.to, " expected ", c.ok)
+		}
+	}
+	if _, err := Resample(nil, etl.Daily, etl.Hour4, Options{}); err == nil {
+		t.Error("Expected an error resampling daily to 4h")
+	}
+}
+
+type store map[etl.Timeframe][]shared.Candle
+
+func (s store) Upsert(symbol string, timeframe etl.Timeframe, candles []shared.Candle) error {
+	return nil
+}
+
+func (s store) UpsertMany(timeframe etl.Timeframe, series map[string][]shared.Candle) error {
+	return nil
+}
+
+func (s store) Range(symbol string, timeframe etl.Timeframe, from time.Time, to time.Time) ([]shared.Candle, error) {
+	var candles []shared.Candle
+	for _, c := range s[timeframe] {
+		if c.Datetime >= uint64(from.UnixMilli()) && c.Datetime < uint64(to.UnixMilli()) {
+			candles = append(candles, c)
+		}
+	}
+	return candles, nil
+}
+
+func (s store) Last(symbol string, timeframe etl.Timeframe) (*shared.Candle, error) {
+	return nil, nil
+}
+
+func TestQuery(t *testing.T) {
+	s := store{etl.Minute15: bars(at(2023, 2, 8, 9, 30), at(2023, 2, 8, 16, 0))}
+
+	hourly, err := Query(s, "AAPL", etl.Hour1, at(2023, 2, 8, 10, 0), at(2023, 2, 8, 12, 0), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(stamps(hourly), []string{"02-08 10:30", "02-08 11:30"}) || hourly[1].Volume != 4 {
+		t.Error("Expected whole bars starting in the range from 15m ", stamps(hourly), hourly)
+	}
+
+	s[etl.Minute30], _ = Resample(s[etl.Minute15], etl.Minute15, etl.Minute30, Options{})
+	s[etl.Minute30][0].Volume = 100 /* tells which source was read */
+	hourly, _ = Query(s, "AAPL", etl.Hour1, at(2023, 2, 8, 0, 0), at(2023, 2, 9, 0, 0), Options{})
+	if len(hourly) != 7 || hourly[0].Volume != 102 {
+		t.Error("Expected hourly bars from the 30m source ", hourly)
+	}
+
+	daily, _ := Query(s, "AAPL", etl.Daily, at(2023, 2, 8, 0, 0), at(2023, 2, 9, 0, 0), Options{})
+	if len(daily) != 1 || daily[0].Volume != 26+98 {
+		t.Error("Expected a daily bar from intraday bars ", daily)
+	}
+	s[etl.Daily] = []shared.Candle{{Datetime: uint64(at(2023, 2, 8, 0, 0).UnixMilli()), Close: 1, Volume: 5}}
+	daily, _ = Query(s, "AAPL", etl.Daily, at(2023, 2, 8, 0, 0), at(2023, 2, 9, 0, 0), Options{})
+	if len(daily) != 1 || daily[0].Volume != 5 {
+		t.Error("Expected the stored daily bar ", daily)
+	}
+
+	if _, err := Query(s, "AAPL", "2h", time.Time{}, time.Now(), Options{}); err == nil {
+		t.Error("Expected an unknown timeframe error")
+	}
+}
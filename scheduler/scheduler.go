@@ -0,0 +1,242 @@
+// Package scheduler runs jobs on cron expressions in America/New_York, gated
+// on the market calendar. A job still running when its next tick fires is
+// skipped rather than started twice.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+)
+
+// Market limits when a job's ticks actually run
+type Market string
+
+const (
+	Always        Market = "always"
+	TradingDays   Market = "trading_days" /* default */
+	RegularHours  Market = "regular"
+	ExtendedHours Market = "extended" /* pre, regular or post market */
+)
+
+func (m Market) Allows(t time.Time) bool {
+	switch m {
+	case Always:
+		return true
+	case RegularHours:
+		return calendar.PhaseAt(t) == calendar.Regular
+	case ExtendedHours:
+		return calendar.PhaseAt(t) != calendar.Closed
+	default:
+		return calendar.IsTradingDay(t)
+	}
+}
+
+type Job struct {
+	Name     string
+	Schedule string /* standard 5 field cron expression */
+	Market   Market
+	Run      func(ctx context.Context) error
+}
+
+type Status struct {
+	Name        string     `json:"name"`
+	Schedule    string     `json:"schedule"`
+	Market      Market     `json:"market"`
+	Running     bool       `json:"running"`
+	Next        time.Time  `json:"next"`
+	LastStart   *time.Time `json:"lastStart,omitempty"`
+	LastEnd     *time.Time `json:"lastEnd,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastSkip    *time.Time `json:"lastSkip,omitempty"`
+	LastSkipWhy string     `json:"lastSkipWhy,omitempty"`
+	Runs        int        `json:"runs"`
+	Skips       int        `json:"skips"`
+}
+
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	ErrStopped    = errors.New("scheduler stopped")
+	errSkipped    = errors.New("skipped")
+)
+
+type entry struct {
+	job    Job
+	id     cron.EntryID
+	status Status
+}
+
+type Scheduler struct {
+	cron    *cron.Cron
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	entries []*entry
+	stopped bool /* no job starts once set, guarded by mu */
+	running sync.WaitGroup
+	now     func() time.Time
+}
+
+func New() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		cron:   cron.New(cron.WithLocation(calendar.NewYork)),
+		ctx:    ctx,
+		cancel: cancel,
+		now:    time.Now,
+	}
+}
+
+func (s *Scheduler) Add(job Job) error {
+	if job.Market == "" {
+		job.Market = TradingDays
+	}
+	e := &entry{job: job, status: Status{Name: job.Name, Schedule: job.Schedule, Market: job.Market}}
+	id, err := s.cron.AddFunc(job.Schedule, func() { s.tick(e, false) })
+	if err != nil {
+		return err
+	}
+	e.id = id
+	s.mu.Lock()
+	s.entries = append(s.entries, e)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop cancels the context given to jobs and waits for running jobs to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	done := s.cron.Stop()
+	s.cancel()
+	<-done.Done()
+	s.running.Wait()
+}
+
+// Trigger starts a job now in the background, ignoring its market gate.
+// It is skipped like a tick if the job is already running.
+func (s *Scheduler) Trigger(name string) error {
+	e := s.entry(name)
+	if e == nil {
+		return ErrUnknownJob
+	}
+	now, err := s.start(e, true)
+	if err == ErrStopped {
+		return err
+	}
+	if err == nil {
+		go s.run(e, now)
+	}
+	return nil
+}
+
+func (s *Scheduler) entry(name string) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.job.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) tick(e *entry, manual bool) {
+	if now, err := s.start(e, manual); err == nil {
+		s.run(e, now)
+	}
+}
+
+// start marks the job running and adds it to s.running under mu, so Stop
+// either waits for it or it never starts
+func (s *Scheduler) start(e *entry, manual bool) (time.Time, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return now, ErrStopped
+	}
+	skip := ""
+	switch {
+	case e.status.Running:
+		skip = "still running"
+	case !manual && !e.job.Market.Allows(now):
+		skip = "market closed"
+	}
+	if skip != "" {
+		e.status.Skips++
+		e.status.LastSkip = &now
+		e.status.LastSkipWhy = skip
+		return now, errSkipped
+	}
+	e.status.Running = true
+	e.status.Runs++
+	e.status.LastStart = &now
+	s.running.Add(1)
+	return now, nil
+}
+
+// run runs a job start let through
+func (s *Scheduler) run(e *entry, now time.Time) {
+	defer s.running.Done()
+
+	log.Println("Job started ", e.job.Name)
+	err := e.job.Run(s.ctx)
+
+	end := s.now()
+	s.mu.Lock()
+	e.status.Running = false
+	e.status.LastEnd = &end
+	e.status.LastError = ""
+	if err != nil {
+		e.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+	log.Println("Job finished ", e.job.Name, end.Sub(now), err)
+}
+
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]Status, len(s.entries))
+	for i, e := range s.entries {
+		statuses[i] = e.status
+		statuses[i].Next = s.next(e)
+	}
+	return statuses
+}
+
+// next is the next tick the market gate lets through, up to a few weeks out
+func (s *Scheduler) next(e *entry) time.Time {
+	schedule := s.cron.Entry(e.id).Schedule
+	if schedule == nil {
+		return time.Time{}
+	}
+	t := s.now()
+	limit := t.AddDate(0, 0, 21)
+	for {
+		t = schedule.Next(t)
+		if t.IsZero() || t.After(limit) || e.job.Market.Allows(t) {
+			return t
+		}
+	}
+}
+
+// ServeHTTP writes the status of every job as json
+func (s *Scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Status())
+}
@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/calendar"
+)
+
+func ny(year int, month time.Month, dom int, hour int, min int) time.Time {
+	return time.Date(year, month, dom, hour, min, 0, 0, calendar.NewYork)
+}
+
+func TestMarketAllows(t *testing.T) {
+	weekday := ny(2024, 3, 28, 8, 0)
+	holiday := ny(2024, 3, 29, 11, 0)
+	cases := []struct {
+		market  Market
+		at      time.Time
+		allowed bool
+	}{
+		{Always, holiday, true},
+		{TradingDays, holiday, false},
+		{"", weekday, true},
+		{RegularHours, weekday, false},
+		{RegularHours, ny(2024, 3, 28, 10, 0), true},
+		{ExtendedHours, weekday, true},
+		{ExtendedHours, ny(2024, 3, 28, 21, 0), false},
+	}
+	for _, c := range cases {
+		if c.market.Allows(c.at) != c.allowed {
+			t.Error(c.market, c.at, " expected ", c.allowed)
+		}
+	}
+}
+
+func TestSkipsOverlap(t *testing.T) {
+	s := New()
+	s.now = func() time.Time { return ny(2024, 3, 28, 10, 0) }
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	err := s.Add(Job{Name: "slow", Schedule: "* * * * *", Run: func(ctx context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Trigger("slow"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	s.tick(s.entry("slow"), false)
+	close(release)
+	s.Stop()
+
+	if len(started) != 0 {
+		t.Error("Overlapping run started")
+	}
+	status := s.Status()[0]
+	if status.Runs != 1 || status.Skips != 1 || status.LastSkipWhy != "still running" || status.Running {
+		t.Error("Unexpected status ", status)
+	}
+	if status.LastEnd == nil {
+		t.Error("Expected a finished run")
+	}
+	if s.Trigger("missing") != ErrUnknownJob {
+		t.Error("Expected unknown job error")
+	}
+	if err := s.Trigger("slow"); err != ErrStopped {
+		t.Error("Expected a stopped scheduler to refuse triggers ", err)
+	}
+	if s.Status()[0].Runs != 1 {
+		t.Error("Nothing should start after Stop")
+	}
+}
+
+func TestNextSkipsClosedDays(t *testing.T) {
+	s := New()
+	// thursday before good friday, next weekday 9am run is monday
+	s.now = func() time.Time { return ny(2024, 3, 28, 10, 0) }
+	if err := s.Add(Job{Name: "daily", Schedule: "0 9 * * *", Run: func(ctx context.Context) error { return nil }}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Job{Name: "bad", Schedule: "not cron"}); err == nil {
+		t.Error("Expected invalid schedule error")
+	}
+
+	s.tick(s.entry("daily"), false)
+	if s.Status()[0].Runs != 1 {
+		t.Error("Expected the job to run on a trading day")
+	}
+	s.now = func() time.Time { return ny(2024, 3, 29, 9, 0) }
+	s.tick(s.entry("daily"), false)
+	status := s.Status()[0]
+	if status.Runs != 1 || status.LastSkipWhy != "market closed" {
+		t.Error("Expected the holiday tick to be skipped ", status)
+	}
+	if !status.Next.Equal(ny(2024, 4, 1, 9, 0)) {
+		t.Error("Expected next run Apr 1 got ", status.Next)
+	}
+}
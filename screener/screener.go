@@ -0,0 +1,111 @@
+// Package screener loads named screens from a yaml or json file. A screen
+// selects symbols from Macros with field filters and queues them for an EtlJob.
+package screener
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-playground/validator"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/universe"
+)
+
+type Config struct {
+	Screens []Screen `json:"screens" yaml:"screens" validate:"dive"`
+}
+
+type Screen struct {
+	Name     string     `json:"name" yaml:"name" validate:"required"`
+	Job      etl.EtlJob `json:"job" yaml:"job" validate:"required,oneof=Macros Medium Short Signals"`
+	Schedule string     `json:"schedule" yaml:"schedule"`                                                             /* cron expression, America/New_York */
+	Market   string     `json:"market" yaml:"market" validate:"omitempty,oneof=always trading_days regular extended"` /* when scheduled runs may start */
+	Filters  []Filter   `json:"filters" yaml:"filters" validate:"dive"`
+}
+
+// Filter matches a Macros document path ex fundamental.vol10DayAvg
+type Filter = etl.Filter
+
+// PathFromEnv is SCREENS_PATH, ./config/screens.yaml when unset
+func PathFromEnv() string {
+	if path := os.Getenv("SCREENS_PATH"); path != "" {
+		return path
+	}
+	return "./config/screens.yaml"
+}
+
+// Load reads a .yaml, .yml or .json screens file
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &config)
+	case ".json":
+		err = json.Unmarshal(b, &config)
+	default:
+		return nil, errors.New("screens file must be yaml or json: " + path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %v: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c Config) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, s := range c.Screens {
+		if names[s.Name] {
+			return errors.New("duplicate screen name: " + s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+func (c Config) Screen(name string) (Screen, bool) {
+	for _, s := range c.Screens {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Screen{}, false
+}
+
+// Query is the Macros filter for the screen, every filter must match
+func (s Screen) Query() bson.M {
+	return etl.MongoFilter(s.Filters)
+}
+
+// Run queues every Macros symbol matching the screen for its job, symbols
+// the universe import marked delisted are never queued
+func Run(store *etl.Store, s Screen) error {
+	filters := append([]Filter{{Field: "universe.status", Op: "ne", Value: universe.Delisted}}, s.Filters...)
+	var docs []etl.SymbolDoc
+	if err := store.Fundamentals.Find(etl.Query{Filters: filters}, &docs); err != nil {
+		return err
+	}
+	symbols := make([]string, len(docs))
+	for i, doc := range docs {
+		symbols[i] = doc.Symbol
+	}
+	return store.ApiQueue.Enqueue(symbols, s.Job)
+}
@@ -0,0 +1,101 @@
+package screener
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/universe"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRepoScreens(t *testing.T) {
+	config, err := Load("../config/screens.yaml")
+	if err != nil {
+		t.Fatal("Repo screens failed to load ", err)
+	}
+	medium, ok := config.Screen("medium")
+	if !ok || medium.Job != etl.Medium {
+		t.Fatal("Missing medium screen")
+	}
+	expected := bson.M{"fundamental.vol10DayAvg": bson.M{"$gt": 2000000}}
+	if !reflect.DeepEqual(medium.Query(), expected) {
+		t.Error("Unexpected medium query ", medium.Query())
+	}
+	signals, _ := config.Screen("signals")
+	if !reflect.DeepEqual(signals.Query(), bson.M{"signal": bson.M{"$eq": true}}) {
+		t.Error("Unexpected signals query ", signals.Query())
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeFile(t, "screens.json", `{"screens": [{
+		"name": "largecap", "job": "Short", "schedule": "0 10 * * 1-5",
+		"filters": [
+			{"field": "fundamental.marketCap", "op": "gte", "value": 10000},
+			{"field": "fundamental.marketCap", "op": "lt", "value": 200000},
+			{"field": "exchange", "op": "in", "value": ["NASDAQ", "NYSE"]}
+		]
+	}]}`)
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := config.Screens[0].Query()
+	expected := bson.M{
+		"fundamental.marketCap": bson.M{"$gte": float64(10000), "$lt": float64(200000)},
+		"exchange":              bson.M{"$in": []interface{}{"NASDAQ", "NYSE"}},
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Error("Filters on one field should merge ", query)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"unknown job": `screens: [{name: a, job: Weekly}]`,
+		"unknown op":  `screens: [{name: a, job: Short, filters: [{field: x, op: like, value: 1}]}]`,
+		"no name":     `screens: [{job: Short}]`,
+		"duplicate":   `screens: [{name: a, job: Short}, {name: a, job: Medium}]`,
+	}
+	for reason, content := range invalid {
+		if _, err := Load(writeFile(t, "screens.yaml", content)); err == nil {
+			t.Error("Expected an error for ", reason)
+		}
+	}
+	if _, err := Load(writeFile(t, "screens.toml", "")); err == nil {
+		t.Error("Expected an error for an unsupported extension")
+	}
+}
+
+func TestRun(t *testing.T) {
+	config, _ := Load("../config/screens.yaml")
+	medium, _ := config.Screen("medium")
+	store := etl.NewMemoryStore()
+	for symbol, volume := range map[string]float64{"TSLA": 3e6, "MSFT": 1e6, "GONE": 5e6} {
+		symbol, volume := symbol, volume
+		store.Fundamentals.Upsert(symbol, &etl.Instrument{Symbol: &symbol, Fundamental: etl.Fundamental{Vol10DayAvg: &volume}})
+	}
+	store.Fundamentals.Update(map[string]etl.FieldUpdate{"GONE": {Set: bson.M{"universe.status": universe.Delisted}}})
+
+	if err := Run(store, medium); err != nil {
+		t.Fatal("Run failed ", err)
+	}
+	job, _ := store.ApiQueue.Claim("test", time.Minute)
+	next, _ := store.ApiQueue.Claim("test", time.Minute)
+	if job == nil || job.Symbol != "TSLA" || job.Work != etl.Medium || next != nil {
+		t.Error("Expected only TSLA queued for Medium ", job)
+	}
+}
@@ -24,8 +24,7 @@ done
 
 >&2 echo "Mongo is up and running on port ${DB_PORT} - running migrations now!"
 
-# Example command to run a migration 
-docker exec mongo mongosh ${DB_NAME} --eval "db.createCollection('Macros')"
-docker exec mongo mongosh ${DB_NAME} --eval "db.Macros.createIndex( { symbol: 1 }, { unique: true } )"
+# indexes, TTLs and validators are versioned in etl/migrations.go
+MONGO_URI="${MONGO_URI:=mongodb://localhost:${DB_PORT}}" DB_NAME="${DB_NAME}" go run ./cmd/migrate up
 
 >&2 echo "Mongo has been setup, ready to go!"
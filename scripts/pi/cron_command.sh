@@ -1,6 +0,0 @@
-# Example
-
-# best
-run-one  etlworker
-
-flock -n /var/lock/etlworker.lock   etlworker
\ No newline at end of file
@@ -1,11 +1,23 @@
 #!/usr/bin/env bash
 
-env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/macros ./cmd/assign/macros
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/assign ./cmd/assign
 
-env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/medium ./cmd/assign/medium
+mkdir -p ./dist/config && cp ./config/screens.yaml ./dist/config/screens.yaml
 
-env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/short ./cmd/assign/short
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/worker ./cmd/worker
 
-env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/signals ./cmd/assign/signals
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/deadletter ./cmd/deadletter
 
-env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/worker ./cmd/worker
\ No newline at end of file
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/signalengine ./cmd/signalengine
+
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/paper ./cmd/paper
+
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/scheduler ./cmd/scheduler
+
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/universe ./cmd/universe
+
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/history ./cmd/history
+
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/replay ./cmd/replay
+
+env GOOS=linux GOARCH=arm GOARM=7 go build -o ./dist/migrate ./cmd/migrate
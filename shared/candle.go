@@ -0,0 +1,10 @@
+package shared
+
+type Candle struct {
+	Datetime uint64  `json:"datetime" bson:"datetime"` /* unix milliseconds */
+	Close    float64 `json:"close" bson:"close"`
+	High     float64 `json:"high" bson:"high"`
+	Low      float64 `json:"low" bson:"low"`
+	Open     float64 `json:"open" bson:"open"`
+	Volume   int     `json:"volume" bson:"volume"`
+}
@@ -0,0 +1,167 @@
+// Package signals evaluates stored Medium and Short data against rules and
+// maintains the signal flag on Macros that the signals screen in
+// config/screens.yaml queues from, through cmd/assign or cmd/scheduler.
+package signals
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/events"
+)
+
+// SignalHistory records every time a symbol enters or leaves the signal set
+const SignalHistory = "SignalHistory"
+
+const (
+	Entered = "entered"
+	Exited  = "exited"
+)
+
+type HistoryDocument struct {
+	Symbol  string    `json:"symbol" bson:"symbol"`
+	Event   string    `json:"event" bson:"event"`
+	Reasons []string  `json:"reasons" bson:"reasons"`
+	At      time.Time `json:"at" bson:"at"`
+}
+
+// macrosDoc is the part of a Macros document the engine reads
+type macrosDoc struct {
+	Symbol        string          `bson:"symbol"`
+	Fundamental   etl.Fundamental `bson:"fundamental"`
+	Signal        bool            `bson:"signal"`
+	SignalReasons []string        `bson:"signalReasons"`
+}
+
+type Engine struct {
+	store   *etl.Store
+	history etl.DocumentStore
+	rules   []Rule
+}
+
+func NewEngine(store *etl.Store, rules []Rule) *Engine {
+	return &Engine{store: store, history: store.Documents(SignalHistory), rules: rules}
+}
+
+type Result struct {
+	Evaluated int
+	Entered   int
+	Exited    int
+}
+
+// Run evaluates every symbol with Medium data. Symbols still flagged from an
+// earlier run that no longer have data are cleared.
+func (e *Engine) Run() (Result, error) {
+	var result Result
+
+	shorts, err := e.store.Snapshots.List(etl.Short)
+	if err != nil {
+		return result, err
+	}
+	short := make(map[string]*etl.PriceHistory, len(shorts))
+	for i := range shorts {
+		short[shorts[i].Symbol] = &shorts[i]
+	}
+	mediums, err := e.store.Snapshots.List(etl.Medium)
+	if err != nil {
+		return result, err
+	}
+	symbols := make([]string, len(mediums))
+	for i, medium := range mediums {
+		symbols[i] = medium.Symbol
+	}
+	var docs []macrosDoc
+	err = e.store.Fundamentals.Find(etl.Query{Filters: []etl.Filter{{Field: "symbol", Op: "in", Value: symbols}}}, &docs)
+	if err != nil {
+		return result, err
+	}
+	macros := make(map[string]macrosDoc, len(docs))
+	for _, doc := range docs {
+		macros[doc.Symbol] = doc
+	}
+
+	evaluated := map[string]bool{}
+	for i := range mediums {
+		medium := &mediums[i]
+		doc, ok := macros[medium.Symbol]
+		if !ok {
+			continue
+		}
+		reasons := Evaluate(e.rules, Input{
+			Symbol:      medium.Symbol,
+			Fundamental: doc.Fundamental,
+			Medium:      medium,
+			Short:       short[medium.Symbol],
+		})
+		evaluated[medium.Symbol] = true
+		result.Evaluated++
+		if err := e.apply(medium.Symbol, doc.Signal, reasons, &result); err != nil {
+			return result, err
+		}
+	}
+
+	// flagged symbols that dropped out of Medium
+	var flagged []macrosDoc
+	err = e.store.Fundamentals.Find(etl.Query{Filters: []etl.Filter{{Field: "signal", Op: "eq", Value: true}}}, &flagged)
+	if err != nil {
+		return result, err
+	}
+	for _, doc := range flagged {
+		if evaluated[doc.Symbol] {
+			continue
+		}
+		if err := e.apply(doc.Symbol, true, nil, &result); err != nil {
+			return result, err
+		}
+	}
+
+	e.store.Logs.Insert("Signal engine", fmt.Sprintf("run complete, evaluated %v, entered %v, exited %v",
+		result.Evaluated, result.Entered, result.Exited))
+	return result, nil
+}
+
+// apply updates the Macros flag and records history when the state changes
+func (e *Engine) apply(symbol string, wasSignal bool, reasons []string, result *Result) error {
+	now := time.Now()
+	signal := len(reasons) > 0
+	set := bson.M{"signal": signal, "signalReasons": reasons, "signalEvaluatedAt": now}
+	if signal != wasSignal {
+		set["signalAt"] = now
+	}
+	if err := e.store.Fundamentals.Update(map[string]etl.FieldUpdate{symbol: {Set: set}}); err != nil {
+		return err
+	}
+	if signal == wasSignal {
+		return nil
+	}
+
+	event := Exited
+	if signal {
+		event = Entered
+		result.Entered++
+	} else {
+		result.Exited++
+	}
+	log.Println("Signal", event, symbol, strings.Join(reasons, "; "))
+	err := e.history.Insert(HistoryDocument{Symbol: symbol, Event: event, Reasons: reasons, At: now})
+	if err != nil {
+		return err
+	}
+	if e.store.Events != nil {
+		err := e.store.Events.Publish(events.Event{
+			Kind:   events.SignalChanged,
+			Symbol: symbol,
+			Signal: &events.SignalChange{Active: signal, Reasons: reasons},
+			At:     now,
+		})
+		if err != nil {
+			log.Println("Publishing signal change failed ", symbol, err)
+		}
+	}
+	return nil
+}
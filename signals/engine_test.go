@@ -0,0 +1,54 @@
+package signals
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/jaredtokuz/market-trader/etl"
+)
+
+/* triggers for the symbols in the set */
+type listed map[string]bool
+
+func (r listed) Name() string {
+	return "listed"
+}
+
+func (r listed) Evaluate(in Input) (bool, string) {
+	return r[in.Symbol], in.Symbol
+}
+
+func TestEngine(t *testing.T) {
+	store := etl.NewMemoryStore()
+	for _, symbol := range []string{"TSLA", "MSFT", "GONE"} {
+		symbol := symbol
+		store.Fundamentals.Upsert(symbol, &etl.Instrument{Symbol: &symbol})
+	}
+	store.Snapshots.Save(etl.Medium, &etl.PriceHistory{Symbol: "TSLA"})
+	store.Snapshots.Save(etl.Medium, &etl.PriceHistory{Symbol: "MSFT"})
+	store.Fundamentals.Update(map[string]etl.FieldUpdate{"GONE": {Set: bson.M{"signal": true}}})
+
+	result, err := NewEngine(store, []Rule{listed{"TSLA": true}}).Run()
+	if err != nil {
+		t.Fatal("Run failed ", err)
+	}
+	if result.Evaluated != 2 || result.Entered != 1 || result.Exited != 1 {
+		t.Error("Unexpected result ", result)
+	}
+	var flagged []etl.SymbolDoc
+	store.Fundamentals.Find(etl.Query{Filters: []etl.Filter{{Field: "signal", Op: "eq", Value: true}}}, &flagged)
+	if len(flagged) != 1 || flagged[0].Symbol != "TSLA" {
+		t.Error("Expected only TSLA flagged ", flagged)
+	}
+	var history []HistoryDocument
+	store.Documents(SignalHistory).Find(etl.Query{Sort: []string{"symbol"}}, &history)
+	if len(history) != 2 || history[0].Symbol != "GONE" || history[0].Event != Exited || history[1].Event != Entered {
+		t.Error("Unexpected history ", history)
+	}
+
+	result, _ = NewEngine(store, []Rule{listed{"TSLA": true}}).Run()
+	if result.Entered != 0 || result.Exited != 0 {
+		t.Error("A second run should not change anything ", result)
+	}
+}
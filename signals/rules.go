@@ -0,0 +1,154 @@
+package signals
+
+import (
+	"fmt"
+
+	"github.com/jaredtokuz/market-trader/etl"
+	"github.com/jaredtokuz/market-trader/indicators"
+)
+
+// Input is everything stored for a symbol that rules may look at
+type Input struct {
+	Symbol      string
+	Fundamental etl.Fundamental
+	Medium      *etl.PriceHistory /* 30 minute bars, nil when not fetched */
+	Short       *etl.PriceHistory /* 15 minute bars, nil when not fetched */
+}
+
+// Rule triggers a signal, reason explains why for the Macros doc and history
+type Rule interface {
+	Name() string
+	Evaluate(in Input) (triggered bool, reason string)
+}
+
+func DefaultRules() []Rule {
+	return []Rule{
+		VolumeSpike{StdDevs: 3},
+		Breakout52{},
+		MACDCross{},
+		SMACross{Fast: 20, Slow: 50},
+	}
+}
+
+// Evaluate returns the reason of every rule that triggered
+func Evaluate(rules []Rule, in Input) []string {
+	var reasons []string
+	for _, rule := range rules {
+		if triggered, reason := rule.Evaluate(in); triggered {
+			reasons = append(reasons, rule.Name()+": "+reason)
+		}
+	}
+	return reasons
+}
+
+// latest prefers the short series for the most recent bars
+func latest(in Input) *etl.PriceHistory {
+	if in.Short != nil && len(in.Short.Candles) > 0 {
+		return in.Short
+	}
+	if in.Medium != nil && len(in.Medium.Candles) > 0 {
+		return in.Medium
+	}
+	return nil
+}
+
+// VolumeSpike triggers when the last bar's volume is StdDevs above the series mean
+type VolumeSpike struct {
+	StdDevs float64
+}
+
+func (r VolumeSpike) Name() string {
+	return "volume spike"
+}
+
+func (r VolumeSpike) Evaluate(in Input) (bool, string) {
+	ph := latest(in)
+	if ph == nil || ph.StdVolume == 0 {
+		return false, ""
+	}
+	last := ph.Candles[len(ph.Candles)-1]
+	threshold := float64(ph.MeanVolume) + r.StdDevs*float64(ph.StdVolume)
+	if float64(last.Volume) <= threshold {
+		return false, ""
+	}
+	return true, fmt.Sprintf("volume %v is %.1fx the mean %v", last.Volume, float64(last.Volume)/float64(ph.MeanVolume), ph.MeanVolume)
+}
+
+// Breakout52 triggers when the last close is above the 52 week high
+type Breakout52 struct{}
+
+func (r Breakout52) Name() string {
+	return "52 week breakout"
+}
+
+func (r Breakout52) Evaluate(in Input) (bool, string) {
+	ph := latest(in)
+	if ph == nil || in.Fundamental.High52 == nil || *in.Fundamental.High52 <= 0 {
+		return false, ""
+	}
+	close := ph.Candles[len(ph.Candles)-1].Close
+	if close <= *in.Fundamental.High52 {
+		return false, ""
+	}
+	return true, fmt.Sprintf("close %v above high52 %v", close, *in.Fundamental.High52)
+}
+
+// MACDCross triggers when the Medium MACD line crossed above its signal on the last bar
+type MACDCross struct{}
+
+func (r MACDCross) Name() string {
+	return "macd cross"
+}
+
+func (r MACDCross) Evaluate(in Input) (bool, string) {
+	if in.Medium == nil {
+		return false, ""
+	}
+	macd := indicators.NewMACD(12, 26, 9)
+	var prevHist, hist float64
+	bars := 0
+	for _, c := range in.Medium.Candles {
+		macd.Update(c.Close)
+		if macd.Ready() {
+			prevHist = hist
+			_, _, hist = macd.Values()
+			bars++
+		}
+	}
+	if bars < 2 || !(prevHist <= 0 && hist > 0) {
+		return false, ""
+	}
+	line, signal, _ := macd.Values()
+	return true, fmt.Sprintf("macd %.4f crossed above signal %.4f", line, signal)
+}
+
+// SMACross triggers when the Medium Fast SMA crossed above the Slow SMA on the last bar
+type SMACross struct {
+	Fast int
+	Slow int
+}
+
+func (r SMACross) Name() string {
+	return fmt.Sprintf("sma %v/%v cross", r.Fast, r.Slow)
+}
+
+func (r SMACross) Evaluate(in Input) (bool, string) {
+	if in.Medium == nil {
+		return false, ""
+	}
+	fast, slow := indicators.NewSMA(r.Fast), indicators.NewSMA(r.Slow)
+	var prevDiff, diff float64
+	bars := 0
+	for _, c := range in.Medium.Candles {
+		fast.Update(c.Close)
+		slow.Update(c.Close)
+		if slow.Ready() {
+			prevDiff, diff = diff, fast.Value()-slow.Value()
+			bars++
+		}
+	}
+	if bars < 2 || !(prevDiff <= 0 && diff > 0) {
+		return false, ""
+	}
+	return true, fmt.Sprintf("sma%v %.2f crossed above sma%v %.2f", r.Fast, fast.Value(), r.Slow, slow.Value())
+}
@@ -0,0 +1,103 @@
+package signals
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/etl"
+)
+
+func history(closes []float64, volume int) *etl.PriceHistory {
+	start := time.Date(2023, 2, 1, 14, 30, 0, 0, time.UTC)
+	ph := &etl.PriceHistory{Symbol: "TSLA", MeanVolume: volume, StdVolume: volume / 10}
+	for i, c := range closes {
+		ph.Candles = append(ph.Candles, etl.Candle{
+			Datetime: uint64(start.Add(time.Duration(i) * 30 * time.Minute).UnixMilli()),
+			Open:     c, High: c + 0.5, Low: c - 0.5, Close: c, Volume: volume,
+		})
+	}
+	return ph
+}
+
+func flat(n int, price float64) []float64 {
+	closes := make([]float64, n)
+	for i := range closes {
+		closes[i] = price
+	}
+	return closes
+}
+
+func TestVolumeSpike(t *testing.T) {
+	short := history(flat(20, 100), 1000)
+	rule := VolumeSpike{StdDevs: 3}
+
+	if triggered, _ := rule.Evaluate(Input{Short: short}); triggered {
+		t.Error("Normal volume should not trigger")
+	}
+	short.Candles[len(short.Candles)-1].Volume = 1500
+	if triggered, reason := rule.Evaluate(Input{Short: short}); !triggered || !strings.Contains(reason, "1500") {
+		t.Error("Expected a volume spike ", reason)
+	}
+	if triggered, _ := rule.Evaluate(Input{}); triggered {
+		t.Error("No data should not trigger")
+	}
+}
+
+func TestBreakout52(t *testing.T) {
+	high52 := 105.0
+	in := Input{Fundamental: etl.Fundamental{High52: &high52}, Medium: history(flat(20, 100), 1000)}
+	if triggered, _ := (Breakout52{}).Evaluate(in); triggered {
+		t.Error("Close under high52 should not trigger")
+	}
+
+	// short has the more recent close
+	in.Short = history(append(flat(5, 100), 106), 1000)
+	if triggered, _ := (Breakout52{}).Evaluate(in); !triggered {
+		t.Error("Close over high52 should trigger")
+	}
+
+	in.Fundamental.High52 = nil
+	if triggered, _ := (Breakout52{}).Evaluate(in); triggered {
+		t.Error("Missing high52 should not trigger")
+	}
+}
+
+func TestCrosses(t *testing.T) {
+	// accelerating decline then a sharp reversal on the last bars
+	var closes []float64
+	for i := 0; i < 80; i++ {
+		closes = append(closes, 300-float64(i*i)/40)
+	}
+	rules := []Rule{MACDCross{}, SMACross{Fast: 5, Slow: 20}}
+
+	for _, rule := range rules {
+		if triggered, _ := rule.Evaluate(Input{Medium: history(closes, 1000)}); triggered {
+			t.Error(rule.Name(), " triggered in a downtrend")
+		}
+	}
+
+	// find the bar each cross happens on, it should trigger exactly there
+	for _, rule := range rules {
+		crossed := 0
+		series := append([]float64{}, closes...)
+		for i := 0; i < 30; i++ {
+			series = append(series, series[len(series)-1]+4)
+			if triggered, _ := rule.Evaluate(Input{Medium: history(series, 1000)}); triggered {
+				crossed++
+			}
+		}
+		if crossed != 1 {
+			t.Error(rule.Name(), " expected a single cross during the reversal, got ", crossed)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	high52 := 90.0
+	in := Input{Fundamental: etl.Fundamental{High52: &high52}, Medium: history(flat(60, 100), 1000)}
+	reasons := Evaluate(DefaultRules(), in)
+	if len(reasons) != 1 || !strings.HasPrefix(reasons[0], "52 week breakout: ") {
+		t.Error("Expected only the breakout reason ", reasons)
+	}
+}
@@ -2,44 +2,184 @@ package token
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
 type AccessTokenService interface {
-	Fetch() string
+	Fetch() (string, error)
+	Invalidate(accessToken string) /* the api rejected accessToken, the next Fetch refreshes it */
+}
+
+const TDA_TOKEN_URL = "https://api.tdameritrade.com/v1/oauth2/token"
+
+// DefaultRefreshSkew refreshes the access token this long before it expires
+const DefaultRefreshSkew = 5 * time.Minute
+
+type Config struct {
+	Path         string        /* json token file, rewritten after every refresh */
+	TokenURL     string        /* oauth2 token endpoint */
+	ClientID     string        /* TD: <API_KEY>@AMER.OAUTHAP, Schwab: app key */
+	ClientSecret string        /* optional, sent as basic auth when set (Schwab) */
+	RefreshSkew  time.Duration /* refresh proactively this long before expiry */
+}
+
+// ConfigFromEnv reads TOKEN_PATH, TOKEN_URL, CLIENT_ID and CLIENT_SECRET.
+// CLIENT_ID falls back to the TD form of API_KEY.
+func ConfigFromEnv() Config {
+	config := Config{
+		Path:         os.Getenv("TOKEN_PATH"),
+		TokenURL:     os.Getenv("TOKEN_URL"),
+		ClientID:     os.Getenv("CLIENT_ID"),
+		ClientSecret: os.Getenv("CLIENT_SECRET"),
+		RefreshSkew:  DefaultRefreshSkew,
+	}
+	if config.TokenURL == "" {
+		config.TokenURL = TDA_TOKEN_URL
+	}
+	if config.ClientID == "" && os.Getenv("API_KEY") != "" {
+		config.ClientID = os.Getenv("API_KEY") + "@AMER.OAUTHAP"
+	}
+	return config
 }
 
 type tokenHandler struct {
-	Path       string
+	mu         sync.Mutex
+	config     Config
+	client     *http.Client
 	Token      string
+	Refresh    string
 	Expiration time.Time
+	rejected   string /* access token the api answered 401, refreshed even before expiry */
 }
 
-func NewAccessTokenService(file_path string) AccessTokenService {
-	accessTokenPayload := getAccessToken(file_path)
-	access_response_date, err := time.Parse(time.RFC1123, accessTokenPayload.Headers.Date)
-	if err != nil {
-		log.Fatal("Failure to parse access token header date", err.Error())
+func NewAccessTokenService(config Config) (AccessTokenService, error) {
+	if config.Path == "" {
+		return nil, errors.New("token path is required")
 	}
-	return &tokenHandler{
-		Path:       file_path,
-		Token:      accessTokenPayload.Data.AccessToken,
-		Expiration: access_response_date.Add(time.Second * time.Duration(accessTokenPayload.Data.ExpiresIn)),
+	a := &tokenHandler{config: config, client: &http.Client{Timeout: 30 * time.Second}}
+	if err := a.load(); err != nil {
+		return nil, err
 	}
+	return a, nil
 }
 
-func (a *tokenHandler) Fetch() string {
-	if a.isTokenExpired() == true {
-		accessTokenPayload := getAccessToken(a.Path)
-		a.Token = accessTokenPayload.Data.AccessToken
+// Fetch returns a valid access token, refreshing it when it is about to expire.
+// Safe for concurrent use, only one caller refreshes at a time.
+func (a *tokenHandler) Fetch() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isTokenExpired() {
+		return a.Token, nil
+	}
+
+	// another process sharing the token file may have refreshed already
+	if err := a.load(); err != nil {
+		return "", err
+	}
+	if !a.isTokenExpired() {
+		return a.Token, nil
+	}
+
+	if err := a.refresh(); err != nil {
+		return "", err
+	}
+	return a.Token, nil
+}
+
+// Invalidate forces a refresh on the next Fetch, unless another caller has
+// already replaced accessToken
+func (a *tokenHandler) Invalidate(accessToken string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if accessToken == a.Token {
+		a.rejected = accessToken
 	}
-	return a.Token
 }
 
 func (a *tokenHandler) isTokenExpired() bool {
-	return time.Now().After(a.Expiration)
+	return (a.rejected != "" && a.Token == a.rejected) || time.Now().Add(a.config.RefreshSkew).After(a.Expiration)
+}
+
+func (a *tokenHandler) load() error {
+	payload, err := getAccessToken(a.config.Path)
+	if err != nil {
+		return err
+	}
+	issued, err := time.Parse(time.RFC1123, payload.Headers.Date)
+	if err != nil {
+		return fmt.Errorf("parsing access token header date: %w", err)
+	}
+	a.Token = payload.Data.AccessToken
+	a.Refresh = payload.Data.RefreshToken
+	a.Expiration = issued.Add(time.Second * time.Duration(payload.Data.ExpiresIn))
+	return nil
+}
+
+// refresh runs the oauth2 refresh_token grant and persists the result
+func (a *tokenHandler) refresh() error {
+	if a.Refresh == "" {
+		return errors.New("access token expired and no refresh token in " + a.config.Path)
+	}
+
+	form := url.Values{}
+	form.Add("grant_type", "refresh_token")
+	form.Add("refresh_token", a.Refresh)
+	if a.config.ClientSecret == "" {
+		form.Add("client_id", a.config.ClientID)
+	}
+	req, err := http.NewRequest("POST", a.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if a.config.ClientSecret != "" {
+		req.SetBasicAuth(a.config.ClientID, a.config.ClientSecret)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token refresh failed with status code: %v", resp.StatusCode)
+	}
+
+	issued := time.Now()
+	var data accessTokenData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return fmt.Errorf("parsing token refresh response: %w", err)
+	}
+	if data.AccessToken == "" {
+		return errors.New("token refresh response has no access_token")
+	}
+	// refresh tokens are only returned when they rotate
+	if data.RefreshToken == "" {
+		data.RefreshToken = a.Refresh
+	}
+
+	payload := accessTokenPayload{
+		Headers: accessTokenHeader{Date: issued.UTC().Format(http.TimeFormat)},
+		Data:    data,
+	}
+	if err := writeAccessToken(a.config.Path, payload); err != nil {
+		return err
+	}
+
+	a.Token = data.AccessToken
+	a.Refresh = data.RefreshToken
+	a.Expiration = issued.Add(time.Second * time.Duration(data.ExpiresIn))
+	return nil
 }
 
 type accessTokenPayload struct {
@@ -52,18 +192,52 @@ type accessTokenHeader struct {
 }
 
 type accessTokenData struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
+	AccessToken           string `json:"access_token"`
+	RefreshToken          string `json:"refresh_token,omitempty"`
+	TokenType             string `json:"token_type,omitempty"`
+	Scope                 string `json:"scope,omitempty"`
+	ExpiresIn             int    `json:"expires_in"`
+	RefreshTokenExpiresIn int    `json:"refresh_token_expires_in,omitempty"`
 }
 
-func getAccessToken(file_path string) accessTokenPayload {
+func getAccessToken(file_path string) (accessTokenPayload, error) {
+	accessTokenPayload := accessTokenPayload{}
 	tokenFile, err := ioutil.ReadFile(file_path)
 	if err != nil {
-		log.Fatal("opening config file", err.Error())
+		return accessTokenPayload, fmt.Errorf("opening token file: %w", err)
 	}
-	accessTokenPayload := accessTokenPayload{}
 	if err = json.Unmarshal(tokenFile, &accessTokenPayload); err != nil {
-		log.Fatal("parsing config file", err.Error())
+		return accessTokenPayload, fmt.Errorf("parsing token file: %w", err)
+	}
+	return accessTokenPayload, nil
+}
+
+// writeAccessToken replaces the token file through a rename so readers in
+// other processes never see a partially written file
+func writeAccessToken(file_path string, payload accessTokenPayload) error {
+	b, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file_path), ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
 	}
-	return accessTokenPayload
+	return os.Rename(tmp.Name(), file_path)
 }
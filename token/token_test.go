@@ -0,0 +1,167 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeTokenFile(t *testing.T, issued time.Time, data accessTokenData) string {
+	path := filepath.Join(t.TempDir(), "token.json")
+	payload := accessTokenPayload{
+		Headers: accessTokenHeader{Date: issued.UTC().Format(http.TimeFormat)},
+		Data:    data,
+	}
+	if err := writeAccessToken(path, payload); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// tokenServer answers refresh_token grants, counting the refreshes
+func tokenServer(t *testing.T, refreshes *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("client_id") != "KEY@AMER.OAUTHAP" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(refreshes, 1)
+		time.Sleep(10 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("access-%v", n+1),
+			"token_type":   "Bearer",
+			"expires_in":   1800,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchValidToken(t *testing.T) {
+	var refreshes int32
+	server := tokenServer(t, &refreshes)
+	path := writeTokenFile(t, time.Now(), accessTokenData{AccessToken: "access-1", RefreshToken: "refresh-1", ExpiresIn: 1800})
+
+	tokens, err := NewAccessTokenService(Config{Path: path, TokenURL: server.URL, ClientID: "KEY@AMER.OAUTHAP", RefreshSkew: DefaultRefreshSkew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := tokens.Fetch()
+	if err != nil || token != "access-1" {
+		t.Error("Expected the token from file ", token, err)
+	}
+	if refreshes != 0 {
+		t.Error("Valid token should not be refreshed")
+	}
+}
+
+func TestFetchRefreshesBeforeExpiry(t *testing.T) {
+	var refreshes int32
+	server := tokenServer(t, &refreshes)
+	// expires in 2 minutes, inside the 5 minute skew
+	path := writeTokenFile(t, time.Now().Add(-28*time.Minute), accessTokenData{AccessToken: "access-1", RefreshToken: "refresh-1", ExpiresIn: 1800})
+
+	tokens, err := NewAccessTokenService(Config{Path: path, TokenURL: server.URL, ClientID: "KEY@AMER.OAUTHAP", RefreshSkew: DefaultRefreshSkew})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tokens.Fetch()
+			if err != nil || token != "access-2" {
+				t.Error("Expected the refreshed token ", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshes != 1 {
+		t.Error("Expected a single refresh, got ", refreshes)
+	}
+
+	// new token is persisted, the refresh token is kept when not rotated
+	payload, err := getAccessToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Data.AccessToken != "access-2" || payload.Data.RefreshToken != "refresh-1" {
+		t.Error("Token file not updated ", payload.Data)
+	}
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Error("Temp files left behind ", len(files))
+	}
+
+	// a fresh handler reading the file should not need to refresh again
+	reloaded, err := NewAccessTokenService(Config{Path: path, TokenURL: server.URL, ClientID: "KEY@AMER.OAUTHAP", RefreshSkew: DefaultRefreshSkew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := reloaded.Fetch(); token != "access-2" || refreshes != 1 {
+		t.Error("Persisted token not reused ", token, refreshes)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	var refreshes int32
+	server := tokenServer(t, &refreshes)
+
+	if _, err := NewAccessTokenService(Config{Path: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("Expected an error for a missing token file")
+	}
+
+	path := writeTokenFile(t, time.Now().Add(-time.Hour), accessTokenData{AccessToken: "access-1", ExpiresIn: 1800})
+	tokens, err := NewAccessTokenService(Config{Path: path, TokenURL: server.URL, ClientID: "KEY@AMER.OAUTHAP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Fetch(); err == nil {
+		t.Error("Expected an error without a refresh token")
+	}
+
+	path = writeTokenFile(t, time.Now().Add(-time.Hour), accessTokenData{AccessToken: "access-1", RefreshToken: "refresh-1", ExpiresIn: 1800})
+	tokens, err = NewAccessTokenService(Config{Path: path, TokenURL: server.URL, ClientID: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Fetch(); err == nil {
+		t.Error("Expected an error when the refresh is rejected")
+	}
+}
+
+func TestInvalidateRefreshesRejectedToken(t *testing.T) {
+	var refreshes int32
+	server := tokenServer(t, &refreshes)
+	path := writeTokenFile(t, time.Now(), accessTokenData{AccessToken: "access-1", RefreshToken: "refresh-1", ExpiresIn: 1800})
+
+	tokens, err := NewAccessTokenService(Config{Path: path, TokenURL: server.URL, ClientID: "KEY@AMER.OAUTHAP", RefreshSkew: DefaultRefreshSkew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file still holds access-1 unexpired, it must not be reloaded as valid
+	tokens.Invalidate("access-1")
+	token, err := tokens.Fetch()
+	if err != nil || token != "access-2" || refreshes != 1 {
+		t.Error("Expected a refresh after the token was rejected ", token, refreshes, err)
+	}
+	// a rejection reported late for a token already replaced is ignored
+	tokens.Invalidate("access-1")
+	if token, _ := tokens.Fetch(); token != "access-2" || refreshes != 1 {
+		t.Error("Stale invalidate should not refresh again ", token, refreshes)
+	}
+}
@@ -0,0 +1,199 @@
+package universe
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/jaredtokuz/market-trader/eoddata"
+	"github.com/jaredtokuz/market-trader/etl"
+)
+
+type ImportOptions struct {
+	Source            string  /* file name recorded in the audit trail */
+	MinVolume         int     /* for symbols new to Macros */
+	MaxDelistFraction float64 /* refuse imports that delist more of the exchange than this */
+	Force             bool    /* skip the delist and out of order checks */
+	DryRun            bool
+}
+
+type Service interface {
+	Import(exchange string, date time.Time, rows []eoddata.Row, opts ImportOptions) (Plan, error)
+	Members(exchange string, status string) ([]MemberDocument, error)
+	Audit(symbol string, limit int64) ([]AuditDocument, error)
+}
+
+type MemberDocument struct {
+	Symbol   string `json:"symbol" bson:"symbol"`
+	Universe Member `json:"universe" bson:"universe"`
+}
+
+type service struct {
+	store *etl.Store
+	audit etl.DocumentStore
+}
+
+func NewService(store *etl.Store) Service {
+	return &service{store: store, audit: store.Documents(UniverseAudit)}
+}
+
+func (s *service) Import(exchange string, date time.Time, rows []eoddata.Row, opts ImportOptions) (Plan, error) {
+	symbols := make([]string, len(rows))
+	for i, row := range rows {
+		symbols[i] = row.Symbol
+	}
+	current, lastImport, err := s.current(exchange, symbols)
+	if err != nil {
+		return Plan{}, err
+	}
+	if !opts.Force && date.Before(lastImport) {
+		return Plan{}, fmt.Errorf("%v import for %v is older than the last import %v",
+			exchange, date.Format("2006-01-02"), lastImport.Format("2006-01-02"))
+	}
+
+	plan := Diff(exchange, date, current, rows, opts.MinVolume)
+	if !opts.Force && opts.MaxDelistFraction > 0 && plan.DelistedFraction() > opts.MaxDelistFraction {
+		return plan, fmt.Errorf("%v import would delist %v of %v active symbols, check the file or force it",
+			exchange, len(plan.Delisted), plan.Active)
+	}
+	if opts.DryRun {
+		return plan, nil
+	}
+	return plan, s.apply(plan, opts.Source)
+}
+
+// current loads the exchange's members and untracked Macros docs for symbols
+// in the file, plus the date of the latest import for the exchange
+func (s *service) current(exchange string, symbols []string) (map[string]Member, time.Time, error) {
+	var members, untracked []MemberDocument
+	err := s.store.Fundamentals.Find(etl.Query{Filters: []etl.Filter{
+		{Field: "universe.exchange", Op: "eq", Value: exchange},
+	}}, &members)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	err = s.store.Fundamentals.Find(etl.Query{Filters: []etl.Filter{
+		{Field: "universe", Op: "exists", Value: false},
+		{Field: "symbol", Op: "in", Value: symbols},
+	}}, &untracked)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	current := make(map[string]Member, len(members)+len(untracked))
+	var lastImport time.Time
+	for _, doc := range append(members, untracked...) {
+		current[doc.Symbol] = doc.Universe
+		if doc.Universe.LastSeen.After(lastImport) {
+			lastImport = doc.Universe.LastSeen
+		}
+	}
+	return current, lastImport, nil
+}
+
+func (s *service) apply(plan Plan, source string) error {
+	now := time.Now()
+	listed := map[string]bool{}
+	updates := map[string]etl.FieldUpdate{}
+	var audits []interface{}
+	audit := func(symbol string, event string) {
+		audits = append(audits, AuditDocument{
+			Symbol: symbol, Exchange: plan.Exchange, Event: event, Date: plan.Date, Source: source, ImportedAt: now,
+		})
+	}
+
+	for _, symbol := range plan.Listed {
+		listed[symbol] = true
+		member := Member{Exchange: plan.Exchange, Status: Active, ListedAt: plan.Date, LastSeen: plan.Date, Volume: plan.Seen[symbol]}
+		updates[symbol] = etl.FieldUpdate{
+			Set:         bson.M{"universe": member},
+			SetOnInsert: bson.M{"onInsertDate": now},
+			Upsert:      true,
+		}
+		audit(symbol, Listed)
+	}
+	for symbol, volume := range plan.Seen {
+		if listed[symbol] {
+			continue
+		}
+		updates[symbol] = etl.FieldUpdate{
+			Set:   bson.M{"universe.status": Active, "universe.lastSeen": plan.Date, "universe.volume": volume},
+			Unset: []string{"universe.delistedAt"},
+		}
+	}
+	for _, symbol := range plan.Relisted {
+		audit(symbol, Relisted)
+	}
+	// a symbol that moved to another exchange since the plan was made stays listed there
+	onExchange := []etl.Filter{{Field: "universe.exchange", Op: "eq", Value: plan.Exchange}}
+	for _, symbol := range plan.Delisted {
+		updates[symbol] = etl.FieldUpdate{
+			Set:   bson.M{"universe.status": Delisted, "universe.delistedAt": plan.Date},
+			Where: onExchange,
+		}
+	}
+
+	if err := s.store.Fundamentals.Update(updates); err != nil {
+		return err
+	}
+	delisted, err := s.delisted(plan)
+	if err != nil {
+		return err
+	}
+	for _, symbol := range delisted {
+		audit(symbol, Removed)
+	}
+	if err := s.audit.Insert(audits...); err != nil {
+		return err
+	}
+	if len(delisted) > 0 {
+		// jobs not yet claimed for dead tickers would only fail
+		if _, err := s.store.ApiQueue.Cancel(delisted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delisted is the plan's delisted symbols that are still members of its exchange
+func (s *service) delisted(plan Plan) ([]string, error) {
+	if len(plan.Delisted) == 0 {
+		return nil, nil
+	}
+	var docs []MemberDocument
+	err := s.store.Fundamentals.Find(etl.Query{Filters: []etl.Filter{
+		{Field: "symbol", Op: "in", Value: plan.Delisted},
+		{Field: "universe.exchange", Op: "eq", Value: plan.Exchange},
+	}, Sort: []string{"symbol"}}, &docs)
+	if err != nil {
+		return nil, err
+	}
+	symbols := make([]string, len(docs))
+	for i, doc := range docs {
+		symbols[i] = doc.Symbol
+	}
+	return symbols, nil
+}
+
+func (s *service) Members(exchange string, status string) ([]MemberDocument, error) {
+	filters := []etl.Filter{{Field: "universe", Op: "exists", Value: true}}
+	if exchange != "" {
+		filters = append(filters, etl.Filter{Field: "universe.exchange", Op: "eq", Value: exchange})
+	}
+	if status != "" {
+		filters = append(filters, etl.Filter{Field: "universe.status", Op: "eq", Value: status})
+	}
+	var docs []MemberDocument
+	err := s.store.Fundamentals.Find(etl.Query{Filters: filters, Sort: []string{"symbol"}}, &docs)
+	return docs, err
+}
+
+func (s *service) Audit(symbol string, limit int64) ([]AuditDocument, error) {
+	var filters []etl.Filter
+	if symbol != "" {
+		filters = append(filters, etl.Filter{Field: "symbol", Op: "eq", Value: symbol})
+	}
+	var docs []AuditDocument
+	err := s.audit.Find(etl.Query{Filters: filters, Sort: []string{"-date", "-importedAt"}, Limit: limit}, &docs)
+	return docs, err
+}
@@ -0,0 +1,100 @@
+// Package universe tracks which symbols are listed on each exchange from
+// EODData imports. Membership lives on the Macros document under universe so
+// screens can skip delisted symbols, every change is also kept in UniverseAudit.
+package universe
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jaredtokuz/market-trader/eoddata"
+)
+
+const UniverseAudit = "UniverseAudit"
+
+/* member status */
+const (
+	Active   = "active"
+	Delisted = "delisted"
+)
+
+/* audit events */
+const (
+	Listed   = "listed"
+	Relisted = "relisted"
+	Removed  = "delisted"
+)
+
+// Member is the universe field of a Macros document
+type Member struct {
+	Exchange   string     `json:"exchange" bson:"exchange"`
+	Status     string     `json:"status" bson:"status"`
+	ListedAt   time.Time  `json:"listedAt" bson:"listedAt"` /* first import the symbol appeared in */
+	DelistedAt *time.Time `json:"delistedAt,omitempty" bson:"delistedAt,omitempty"`
+	LastSeen   time.Time  `json:"lastSeen" bson:"lastSeen"`
+	Volume     int        `json:"volume" bson:"volume"` /* in the last import it appeared in */
+}
+
+type AuditDocument struct {
+	Symbol     string    `json:"symbol" bson:"symbol"`
+	Exchange   string    `json:"exchange" bson:"exchange"`
+	Event      string    `json:"event" bson:"event"`
+	Date       time.Time `json:"date" bson:"date"` /* trading date of the import */
+	Source     string    `json:"source" bson:"source"`
+	ImportedAt time.Time `json:"importedAt" bson:"importedAt"`
+}
+
+// Plan is what an import changes
+type Plan struct {
+	Exchange string
+	Date     time.Time
+	Listed   []string       /* new, or already in Macros without universe tracking */
+	Relisted []string       /* delisted before, back in the file */
+	Delisted []string       /* active before, missing from the file */
+	Seen     map[string]int /* volume of every tracked symbol in the file */
+	Skipped  int            /* new symbols under the minimum volume */
+	Active   int            /* members active before the import */
+}
+
+// Diff compares the rows of an import with the current members of the
+// exchange. current also holds Macros symbols from the file that are not
+// tracked yet, with a zero Member. Symbols already tracked stay listed at any
+// volume, minVolume only applies to symbols new to Macros.
+func Diff(exchange string, date time.Time, current map[string]Member, rows []eoddata.Row, minVolume int) Plan {
+	plan := Plan{Exchange: exchange, Date: date, Seen: map[string]int{}}
+	inFile := map[string]bool{}
+	for _, row := range rows {
+		inFile[row.Symbol] = true
+		member, known := current[row.Symbol]
+		switch {
+		case !known && row.Volume < minVolume:
+			plan.Skipped++
+			continue
+		case !known || member.Status == "":
+			plan.Listed = append(plan.Listed, row.Symbol)
+		case member.Status == Delisted:
+			plan.Relisted = append(plan.Relisted, row.Symbol)
+		}
+		plan.Seen[row.Symbol] = row.Volume
+	}
+	for symbol, member := range current {
+		if member.Status == Active {
+			plan.Active++
+			if !inFile[symbol] {
+				plan.Delisted = append(plan.Delisted, symbol)
+			}
+		}
+	}
+	sort.Strings(plan.Listed)
+	sort.Strings(plan.Relisted)
+	sort.Strings(plan.Delisted)
+	return plan
+}
+
+// DelistedFraction guards against a truncated download delisting everything
+func (p Plan) DelistedFraction() float64 {
+	if p.Active == 0 {
+		return 0
+	}
+	return float64(len(p.Delisted)) / float64(p.Active)
+}
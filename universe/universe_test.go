@@ -0,0 +1,136 @@
+package universe
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/jaredtokuz/market-trader/eoddata"
+	"github.com/jaredtokuz/market-trader/etl"
+)
+
+func TestDiff(t *testing.T) {
+	date := time.Date(2023, 2, 8, 0, 0, 0, 0, time.UTC)
+	current := map[string]Member{
+		"AAPL": {Exchange: "NASDAQ", Status: Active},
+		"MSFT": {Exchange: "NASDAQ", Status: Active},
+		"DEAD": {Exchange: "NASDAQ", Status: Active},
+		"BACK": {Exchange: "NASDAQ", Status: Delisted},
+		"OLD":  {}, /* in Macros from before universe tracking */
+	}
+	rows := []eoddata.Row{
+		{Symbol: "AAPL", Volume: 50000000},
+		{Symbol: "MSFT", Volume: 100}, /* tracked symbols stay at any volume */
+		{Symbol: "BACK", Volume: 300000},
+		{Symbol: "OLD", Volume: 10},
+		{Symbol: "NEWCO", Volume: 250000},
+		{Symbol: "TINYW", Volume: 6900},
+	}
+
+	plan := Diff("NASDAQ", date, current, rows, 200000)
+	if !reflect.DeepEqual(plan.Listed, []string{"NEWCO", "OLD"}) {
+		t.Error("Unexpected listed ", plan.Listed)
+	}
+	if !reflect.DeepEqual(plan.Relisted, []string{"BACK"}) {
+		t.Error("Unexpected relisted ", plan.Relisted)
+	}
+	if !reflect.DeepEqual(plan.Delisted, []string{"DEAD"}) {
+		t.Error("Unexpected delisted ", plan.Delisted)
+	}
+	if plan.Skipped != 1 || plan.Active != 3 {
+		t.Error("Expected 1 skipped and 3 active got ", plan.Skipped, plan.Active)
+	}
+	if len(plan.Seen) != 5 || plan.Seen["MSFT"] != 100 {
+		t.Error("Unexpected seen ", plan.Seen)
+	}
+	if f := plan.DelistedFraction(); f != 1.0/3 {
+		t.Error("Unexpected delisted fraction ", f)
+	}
+
+	// the same file again changes nothing
+	for _, s := range plan.Listed {
+		current[s] = Member{Status: Active}
+	}
+	for _, s := range plan.Relisted {
+		current[s] = Member{Status: Active}
+	}
+	for _, s := range plan.Delisted {
+		current[s] = Member{Status: Delisted}
+	}
+	again := Diff("NASDAQ", date, current, rows, 200000)
+	if len(again.Listed)+len(again.Relisted)+len(again.Delisted) != 0 {
+		t.Error("Reimport should be a no-op ", again)
+	}
+}
+
+func TestServiceImport(t *testing.T) {
+	store := etl.NewMemoryStore()
+	old := "OLD"
+	store.Fundamentals.Upsert(old, &etl.Instrument{Symbol: &old})
+	service := NewService(store)
+	first := time.Date(2023, 2, 8, 0, 0, 0, 0, time.UTC)
+	rows := []eoddata.Row{{Symbol: "AAPL", Volume: 50000000}, {Symbol: "DEAD", Volume: 300000}, {Symbol: "OLD", Volume: 10}}
+	if _, err := service.Import("NASDAQ", first, rows, ImportOptions{Source: "NASDAQ_20230208.csv"}); err != nil {
+		t.Fatal("First import failed ", err)
+	}
+	members, _ := service.Members("NASDAQ", Active)
+	if len(members) != 3 || members[0].Symbol != "AAPL" || members[2].Symbol != "OLD" {
+		t.Fatal("Expected 3 active members ", members)
+	}
+
+	store.ApiQueue.Enqueue([]string{"DEAD", "AAPL"}, etl.Short)
+	if _, err := service.Import("NASDAQ", first.AddDate(0, 0, -1), rows[:1], ImportOptions{Source: "NASDAQ_20230207.csv"}); err == nil {
+		t.Error("Expected an import older than the last one to be refused")
+	}
+	plan, err := service.Import("NASDAQ", first.AddDate(0, 0, 1), rows[:1], ImportOptions{Source: "NASDAQ_20230209.csv"})
+	if err != nil || !reflect.DeepEqual(plan.Delisted, []string{"DEAD", "OLD"}) {
+		t.Fatal("Expected DEAD and OLD delisted ", plan.Delisted, err)
+	}
+	if delisted, _ := service.Members("", Delisted); len(delisted) != 2 || delisted[0].Universe.DelistedAt == nil {
+		t.Error("Unexpected delisted members ", delisted)
+	}
+	job, _ := store.ApiQueue.Claim("test", time.Minute)
+	next, _ := store.ApiQueue.Claim("test", time.Minute)
+	if job == nil || job.Symbol != "AAPL" || next != nil {
+		t.Error("Expected DEAD's queued job cancelled ", job)
+	}
+	audit, _ := service.Audit("DEAD", 10)
+	if len(audit) != 2 || audit[0].Event != Removed || audit[1].Event != Listed {
+		t.Error("Unexpected DEAD audit ", audit)
+	}
+}
+
+func TestServiceDelistsOnlyOnExchange(t *testing.T) {
+	store := etl.NewMemoryStore()
+	s := NewService(store).(*service)
+	first := time.Date(2023, 2, 8, 0, 0, 0, 0, time.UTC)
+	rows := []eoddata.Row{{Symbol: "MOVED", Volume: 300000}, {Symbol: "STAY", Volume: 300000}}
+	if _, err := s.Import("NYSE", first, rows, ImportOptions{}); err != nil {
+		t.Fatal("Import failed ", err)
+	}
+	store.ApiQueue.Enqueue([]string{"MOVED", "STAY"}, etl.Short)
+
+	// MOVED lists on NASDAQ after the NYSE plan was made
+	plan := Plan{Exchange: "NYSE", Date: first.AddDate(0, 0, 1), Delisted: []string{"MOVED", "STAY"}}
+	store.Fundamentals.Update(map[string]etl.FieldUpdate{"MOVED": {Set: bson.M{"universe.exchange": "NASDAQ"}}})
+	if err := s.apply(plan, "NYSE_20230209.csv"); err != nil {
+		t.Fatal("apply failed ", err)
+	}
+
+	if active, _ := s.Members("NASDAQ", Active); len(active) != 1 || active[0].Symbol != "MOVED" {
+		t.Error("MOVED should stay active on NASDAQ ", active)
+	}
+	if delisted, _ := s.Members("", Delisted); len(delisted) != 1 || delisted[0].Symbol != "STAY" {
+		t.Error("Expected only STAY delisted ", delisted)
+	}
+	job, _ := store.ApiQueue.Claim("test", time.Minute)
+	next, _ := store.ApiQueue.Claim("test", time.Minute)
+	if job == nil || job.Symbol != "MOVED" || next != nil {
+		t.Error("Expected only STAY's job cancelled ", job, next)
+	}
+	if audit, _ := s.Audit("MOVED", 10); len(audit) != 1 || audit[0].Event != Listed {
+		t.Error("MOVED should not be audited as removed ", audit)
+	}
+}